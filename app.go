@@ -16,12 +16,12 @@ import (
 	"github.com/kardianos/service"
 	_ "go.uber.org/automaxprocs"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 
 	"github.com/zly-app/zapp/config"
 	"github.com/zly-app/zapp/core"
 	"github.com/zly-app/zapp/log"
 	"github.com/zly-app/zapp/pkg/depender"
+	"github.com/zly-app/zapp/pkg/zlog"
 )
 
 var defaultApp core.IApp
@@ -77,9 +77,10 @@ func NewApp(appName string, opts ...Option) core.IApp {
 	}
 
 	app.ILogger = log.NewLogger(appName, app.config, app.opt.LogOpts...)
+	app.watchLogLevel()
 
 	if app.config.Config().Frame.PrintConfig {
-		data, err := yaml.Marshal(app.config.GetViper().AllSettings())
+		data, err := config.DumpConfig(app.config)
 		if err != nil {
 			app.Error("打印配置时序列化失败", zap.Error(err))
 		} else {
@@ -139,6 +140,9 @@ func (app *appCli) exit() {
 	// app退出后
 	app.Warn("app已退出")
 	app.handler(AfterExitHandler)
+
+	// 写入缓冲中的日志
+	_ = zlog.Close(app.ILogger)
 }
 
 func (app *appCli) Name() string {
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func gaugeFamily(name, help string, v float64) *MetricFamily {
+	return &MetricFamily{Name: name, Help: help, Type: GaugeType, Metrics: []*Metric{{Value: v}}}
+}
+
+func counterFamily(name, help string, v float64) *MetricFamily {
+	return &MetricFamily{Name: name, Help: help, Type: CounterType, Metrics: []*Metric{{Value: v}}}
+}
+
+type goCollector struct{}
+
+// 创建go运行时采集器, 输出 go_ 开头的协程, 线程, gc和内存指标
+func NewGoCollector() Collector { return goCollector{} }
+
+func (goCollector) Collect() []*MetricFamily {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	gcStats := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&gcStats)
+	gcSummary := &SummaryData{Count: uint64(gcStats.NumGC), Sum: gcStats.PauseTotal.Seconds()}
+	for i, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		gcSummary.Quantiles = append(gcSummary.Quantiles, Quantile{Quantile: q, Value: gcStats.PauseQuantiles[i].Seconds()})
+	}
+
+	return []*MetricFamily{
+		gaugeFamily("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())),
+		gaugeFamily("go_threads", "Number of OS threads created.", float64(pprof.Lookup("threadcreate").Count())),
+		{
+			Name: "go_info", Help: "Information about the Go environment.", Type: GaugeType,
+			Metrics: []*Metric{{Labels: []LabelPair{{Name: "version", Value: runtime.Version()}}, Value: 1}},
+		},
+		{
+			Name: "go_gc_duration_seconds", Help: "A summary of the pause duration of garbage collection cycles.", Type: SummaryType,
+			Metrics: []*Metric{{Summary: gcSummary}},
+		},
+		gaugeFamily("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(ms.Alloc)),
+		counterFamily("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(ms.TotalAlloc)),
+		gaugeFamily("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(ms.Sys)),
+		counterFamily("go_memstats_mallocs_total", "Total number of mallocs.", float64(ms.Mallocs)),
+		counterFamily("go_memstats_frees_total", "Total number of frees.", float64(ms.Frees)),
+		gaugeFamily("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", float64(ms.HeapAlloc)),
+		gaugeFamily("go_memstats_heap_sys_bytes", "Number of heap bytes obtained from system.", float64(ms.HeapSys)),
+		gaugeFamily("go_memstats_heap_idle_bytes", "Number of heap bytes waiting to be used.", float64(ms.HeapIdle)),
+		gaugeFamily("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(ms.HeapInuse)),
+		gaugeFamily("go_memstats_heap_released_bytes", "Number of heap bytes released to OS.", float64(ms.HeapReleased)),
+		gaugeFamily("go_memstats_heap_objects", "Number of allocated objects.", float64(ms.HeapObjects)),
+		gaugeFamily("go_memstats_stack_inuse_bytes", "Number of bytes in use by the stack allocator.", float64(ms.StackInuse)),
+		gaugeFamily("go_memstats_next_gc_bytes", "Number of heap bytes when next garbage collection will take place.", float64(ms.NextGC)),
+		gaugeFamily("go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", float64(ms.LastGC)/1e9),
+	}
+}
+
+type processCollector struct {
+	proc *process.Process
+}
+
+// 创建进程采集器, 输出 process_ 开头的cpu, 内存, 文件描述符和启动时间指标, 获取失败的指标不会输出
+func NewProcessCollector() Collector {
+	proc, _ := process.NewProcess(int32(os.Getpid()))
+	return &processCollector{proc: proc}
+}
+
+func (c *processCollector) Collect() []*MetricFamily {
+	if c.proc == nil {
+		return nil
+	}
+	var out []*MetricFamily
+	if t, err := c.proc.Times(); err == nil {
+		out = append(out, counterFamily("process_cpu_seconds_total", "Total user and system CPU time spent in seconds.", t.User+t.System))
+	}
+	if mem, err := c.proc.MemoryInfo(); err == nil {
+		out = append(out,
+			gaugeFamily("process_resident_memory_bytes", "Resident memory size in bytes.", float64(mem.RSS)),
+			gaugeFamily("process_virtual_memory_bytes", "Virtual memory size in bytes.", float64(mem.VMS)),
+		)
+	}
+	if n, err := c.proc.NumFDs(); err == nil {
+		out = append(out, gaugeFamily("process_open_fds", "Number of open file descriptors.", float64(n)))
+	}
+	if limits, err := c.proc.Rlimit(); err == nil {
+		for _, l := range limits {
+			if l.Resource == process.RLIMIT_NOFILE {
+				out = append(out, gaugeFamily("process_max_fds", "Maximum number of open file descriptors.", float64(l.Soft)))
+			}
+		}
+	}
+	if ms, err := c.proc.CreateTime(); err == nil {
+		out = append(out, gaugeFamily("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(ms)/1e3))
+	}
+	return out
+}
@@ -1,10 +1,23 @@
 package metrics
 
-var defaultClient Client = DefNoopClient
+import (
+	"sync/atomic"
+)
 
-func GetClient() Client { return defaultClient }
+type clientHolder struct {
+	client Client
+}
+
+// 默认client, 设置时可能已有协程在上报指标, 所以使用原子操作
+var defaultClient atomic.Pointer[clientHolder]
+
+func init() {
+	SetClient(DefNoopClient)
+}
+
+func GetClient() Client { return defaultClient.Load().client }
 
-func SetClient(client Client) { defaultClient = client }
+func SetClient(client Client) { defaultClient.Store(&clientHolder{client: client}) }
 
 /*
 注册计数器
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// prometheus text 格式
+	TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// OpenMetrics 格式
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var (
+	textHelpEscaper        = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	openMetricsHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	labelValueEscaper      = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 写入一行样本, extra 为额外的标签, 如直方图的 le
+func writeSample(w *bufio.Writer, name string, labels []LabelPair, extraName, extraValue string, value string) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.Name)
+			w.WriteString(`="`)
+			w.WriteString(labelValueEscaper.Replace(l.Value))
+			w.WriteByte('"')
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+}
+
+// 写入 OpenMetrics 的样例
+func writeExemplar(w *bufio.Writer, ex *Exemplar) {
+	if ex == nil {
+		return
+	}
+	w.WriteString(" # ")
+	writeSample(w, "", makeLabelPairs(ex.Labels), "", "", formatFloat(ex.Value))
+	if !ex.Timestamp.IsZero() {
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatFloat(float64(ex.Timestamp.UnixNano())/1e9, 'f', 3, 64))
+	}
+}
+
+// 以 prometheus text 格式写入指标
+func WriteText(out io.Writer, families []*MetricFamily) error {
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		if f.Help != "" {
+			w.WriteString("# HELP " + f.Name + " " + textHelpEscaper.Replace(f.Help) + "\n")
+		}
+		w.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+		for _, m := range f.Metrics {
+			writeMetric(w, f, f.Name, f.Name, m, false)
+		}
+	}
+	return w.Flush()
+}
+
+// 以 OpenMetrics 格式写入指标, 计数器的样本名会以 _total 结尾, 会输出样例
+func WriteOpenMetrics(out io.Writer, families []*MetricFamily) error {
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		name, sampleName := f.Name, f.Name
+		if f.Type == CounterType {
+			name = strings.TrimSuffix(f.Name, "_total")
+			sampleName = name + "_total"
+		}
+		w.WriteString("# TYPE " + name + " " + string(f.Type) + "\n")
+		if f.Help != "" {
+			w.WriteString("# HELP " + name + " " + openMetricsHelpEscaper.Replace(f.Help) + "\n")
+		}
+		for _, m := range f.Metrics {
+			writeMetric(w, f, name, sampleName, m, true)
+		}
+	}
+	w.WriteString("# EOF\n")
+	return w.Flush()
+}
+
+func writeMetric(w *bufio.Writer, f *MetricFamily, name, sampleName string, m *Metric, openMetrics bool) {
+	switch {
+	case f.Type == HistogramType && m.Histogram != nil:
+		h := m.Histogram
+		for _, b := range h.Buckets {
+			writeSample(w, name+"_bucket", m.Labels, "le", formatFloat(b.UpperBound), strconv.FormatUint(b.Count, 10))
+			if openMetrics {
+				writeExemplar(w, b.Exemplar)
+			}
+			w.WriteByte('\n')
+		}
+		writeSample(w, name+"_bucket", m.Labels, "le", "+Inf", strconv.FormatUint(h.Count, 10))
+		if openMetrics {
+			writeExemplar(w, h.InfExemplar)
+		}
+		w.WriteByte('\n')
+		writeSample(w, name+"_sum", m.Labels, "", "", formatFloat(h.Sum))
+		w.WriteByte('\n')
+		writeSample(w, name+"_count", m.Labels, "", "", strconv.FormatUint(h.Count, 10))
+		w.WriteByte('\n')
+	case f.Type == SummaryType && m.Summary != nil:
+		s := m.Summary
+		for _, q := range s.Quantiles {
+			writeSample(w, name, m.Labels, "quantile", formatFloat(q.Quantile), formatFloat(q.Value))
+			w.WriteByte('\n')
+		}
+		writeSample(w, name+"_sum", m.Labels, "", "", formatFloat(s.Sum))
+		w.WriteByte('\n')
+		writeSample(w, name+"_count", m.Labels, "", "", strconv.FormatUint(s.Count, 10))
+		w.WriteByte('\n')
+	default:
+		writeSample(w, sampleName, m.Labels, "", "", formatFloat(m.Value))
+		if openMetrics && f.Type == CounterType {
+			writeExemplar(w, m.Exemplar)
+		}
+		w.WriteByte('\n')
+	}
+}
+
+// 检查请求是否接受 OpenMetrics 格式
+func acceptOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if mediaType == "application/openmetrics-text" {
+			return true
+		}
+	}
+	return false
+}
+
+// 指标的http处理器, 根据请求头 Accept 选择 OpenMetrics 或 prometheus text 格式
+func Handler(g Gatherer) http.Handler {
+	return HandlerWithOptions(g, true)
+}
+
+// 指标的http处理器, enableOpenMetrics 为 false 时总是使用 prometheus text 格式
+func HandlerWithOptions(g Gatherer, enableOpenMetrics bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families := g.Gather()
+		if enableOpenMetrics && acceptOpenMetrics(r.Header.Get("Accept")) {
+			w.Header().Set("Content-Type", OpenMetricsContentType)
+			_ = WriteOpenMetrics(w, families)
+			return
+		}
+		w.Header().Set("Content-Type", TextContentType)
+		_ = WriteText(w, families)
+	})
+}
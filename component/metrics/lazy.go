@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// 跟随默认client的指标, 默认client变化后会在下次使用时注册到新的client
+type lazyMetric[T any] struct {
+	register func(c Client) T
+
+	mx     sync.Mutex
+	client Client // 已注册的client
+	metric T
+}
+
+func (l *lazyMetric[T]) get() T {
+	c := GetClient()
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.client != c {
+		l.metric = l.register(c)
+		l.client = c
+	}
+	return l.metric
+}
+
+type lazyCounter struct{ lazyMetric[ICounter] }
+
+func (l *lazyCounter) Inc(labels Labels, exemplar Labels) { l.get().Inc(labels, exemplar) }
+func (l *lazyCounter) Add(v float64, labels Labels, exemplar Labels) {
+	l.get().Add(v, labels, exemplar)
+}
+
+/*
+创建跟随默认client的计数器, 参数同 RegistryCounter
+
+	在使用时才注册到默认client, 默认client被替换后会重新注册
+	用于在插件设置默认client之前就可能上报的指标, 如配置加载和日志
+*/
+func NewLazyCounter(name, help string, constLabels Labels, labels ...string) ICounter {
+	l := &lazyCounter{}
+	l.register = func(c Client) ICounter { return c.RegistryCounter(name, help, constLabels, labels...) }
+	return l
+}
+
+type lazyHistogram struct{ lazyMetric[IHistogram] }
+
+func (l *lazyHistogram) Observe(v float64, labels Labels, exemplar Labels) {
+	l.get().Observe(v, labels, exemplar)
+}
+
+// 创建跟随默认client的直方图, 参数同 RegistryHistogram, 说明见 NewLazyCounter
+func NewLazyHistogram(name, help string, buckets []float64, constLabels Labels, labels ...string) IHistogram {
+	l := &lazyHistogram{}
+	l.register = func(c Client) IHistogram { return c.RegistryHistogram(name, help, buckets, constLabels, labels...) }
+	return l
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// 指标类型
+type MetricType string
+
+const (
+	CounterType   MetricType = "counter"
+	GaugeType     MetricType = "gauge"
+	HistogramType MetricType = "histogram"
+	SummaryType   MetricType = "summary"
+)
+
+// 指标族, 同名指标的所有标签组合
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Metrics []*Metric
+}
+
+// 标签
+type LabelPair struct {
+	Name  string
+	Value string
+}
+
+// 一个标签组合的指标数据
+type Metric struct {
+	Labels    []LabelPair    // 按标签名排序
+	Value     float64        // counter 和 gauge 的值
+	Exemplar  *Exemplar      // counter 的样例
+	Histogram *HistogramData // histogram 的数据
+	Summary   *SummaryData   // summary 的数据
+}
+
+// 样例, 一般用于关联 trace
+type Exemplar struct {
+	Labels    Labels
+	Value     float64
+	Timestamp time.Time
+}
+
+// 直方图数据
+type HistogramData struct {
+	Count   uint64
+	Sum     float64
+	Buckets []Bucket // 不包含 +Inf 桶, +Inf 桶的计数为 Count
+	// +Inf 桶的样例
+	InfExemplar *Exemplar
+}
+
+// 直方图桶
+type Bucket struct {
+	UpperBound float64
+	Count      uint64 // 累计计数, 即小于等于 UpperBound 的观测值数量
+	Exemplar   *Exemplar
+}
+
+// 汇总数据
+type SummaryData struct {
+	Count     uint64
+	Sum       float64
+	Quantiles []Quantile
+}
+
+// 分位数
+type Quantile struct {
+	Quantile float64
+	Value    float64
+}
+
+// 指标收集者, 如 Registry
+type Gatherer interface {
+	// 收集所有指标, 按指标名排序
+	Gather() []*MetricFamily
+}
+
+// 采集器, 每次收集时生成指标, 用于运行时和进程信息等不需要主动上报的指标
+type Collector interface {
+	Collect() []*MetricFamily
+}
+
+// 将 Labels 转为按标签名排序的标签列表
+func makeLabelPairs(labels Labels) []LabelPair {
+	pairs := make([]LabelPair, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, LabelPair{Name: k, Value: v})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
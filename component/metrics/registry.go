@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type metricVec interface {
+	metricType() MetricType
+	collect() *MetricFamily
+}
+
+/*
+进程内的指标注册表, 实现了 Client, 可以通过 Handler 输出 prometheus text 和 OpenMetrics 格式的指标
+
+	重复注册同名同类型的指标会返回已注册的指标, 同名不同类型会panic
+	使用时传入的标签中缺少的标签值为空字符串, 未注册的标签会被忽略
+*/
+type Registry struct {
+	mx         sync.RWMutex
+	metrics    map[string]metricVec
+	collectors []Collector
+}
+
+var _ Client = (*Registry)(nil)
+var _ Gatherer = (*Registry)(nil)
+
+// 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metricVec)}
+}
+
+// 注册采集器, 每次收集时调用, 和已注册的指标同名的指标族会被忽略
+func (r *Registry) RegistryCollector(c Collector) {
+	r.mx.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mx.Unlock()
+}
+
+func (r *Registry) register(name string, typ MetricType, create func() metricVec) metricVec {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if m, ok := r.metrics[name]; ok {
+		if m.metricType() != typ {
+			panic(fmt.Sprintf("指标<%s>已注册为%s, 无法注册为%s", name, m.metricType(), typ))
+		}
+		return m
+	}
+	m := create()
+	r.metrics[name] = m
+	return m
+}
+
+func (r *Registry) get(name string) metricVec {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	return r.metrics[name]
+}
+
+func (r *Registry) RegistryCounter(name, help string, constLabels Labels, labels ...string) ICounter {
+	return r.register(name, CounterType, func() metricVec {
+		return newCounterVec(newMetricDesc(name, help, constLabels, labels))
+	}).(*counterVec)
+}
+
+func (r *Registry) Counter(name string) ICounter {
+	if v, ok := r.get(name).(*counterVec); ok {
+		return v
+	}
+	return DefNoopCounter
+}
+
+func (r *Registry) RegistryGauge(name, help string, constLabels Labels, labels ...string) IGauge {
+	return r.register(name, GaugeType, func() metricVec {
+		return newGaugeVec(newMetricDesc(name, help, constLabels, labels))
+	}).(*gaugeVec)
+}
+
+func (r *Registry) Gauge(name string) IGauge {
+	if v, ok := r.get(name).(*gaugeVec); ok {
+		return v
+	}
+	return DefNoopGauge
+}
+
+func (r *Registry) RegistryHistogram(name, help string, buckets []float64, constLabels Labels, labels ...string) IHistogram {
+	return r.register(name, HistogramType, func() metricVec {
+		return newHistogramVec(newMetricDesc(name, help, constLabels, labels, "le"), buckets)
+	}).(*histogramVec)
+}
+
+func (r *Registry) Histogram(name string) IHistogram {
+	if v, ok := r.get(name).(*histogramVec); ok {
+		return v
+	}
+	return DefNoopHistogram
+}
+
+func (r *Registry) RegistrySummary(name, help string, constLabels Labels, labels ...string) ISummary {
+	return r.register(name, SummaryType, func() metricVec {
+		return newSummaryVec(newMetricDesc(name, help, constLabels, labels, "quantile"))
+	}).(*summaryVec)
+}
+
+func (r *Registry) Summary(name string) ISummary {
+	if v, ok := r.get(name).(*summaryVec); ok {
+		return v
+	}
+	return DefNoopSummary
+}
+
+// 收集所有指标, 按指标名排序
+func (r *Registry) Gather() []*MetricFamily {
+	r.mx.RLock()
+	vecs := make([]metricVec, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		vecs = append(vecs, m)
+	}
+	collectors := append([]Collector{}, r.collectors...)
+	r.mx.RUnlock()
+
+	families := make([]*MetricFamily, 0, len(vecs))
+	seen := make(map[string]struct{}, len(vecs))
+	for _, m := range vecs {
+		f := m.collect()
+		seen[f.Name] = struct{}{}
+		if len(f.Metrics) > 0 {
+			families = append(families, f)
+		}
+	}
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			if _, ok := seen[f.Name]; ok || len(f.Metrics) == 0 {
+				continue
+			}
+			seen[f.Name] = struct{}{}
+			families = append(families, f)
+		}
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// 指标描述
+type metricDesc struct {
+	name        string
+	help        string
+	constLabels Labels
+	labelNames  []string
+}
+
+// 创建指标描述, 指标名或标签名无效时会panic, reserved 为该类型指标保留的标签名
+func newMetricDesc(name, help string, constLabels Labels, labelNames []string, reserved ...string) *metricDesc {
+	if !metricNameRe.MatchString(name) {
+		panic(fmt.Sprintf("指标名<%s>无效", name))
+	}
+	seen := make(map[string]struct{}, len(constLabels)+len(labelNames))
+	check := func(label string) {
+		if !labelNameRe.MatchString(label) || strings.HasPrefix(label, "__") {
+			panic(fmt.Sprintf("指标<%s>的标签名<%s>无效", name, label))
+		}
+		for _, r := range reserved {
+			if label == r {
+				panic(fmt.Sprintf("指标<%s>的标签名<%s>是保留的", name, label))
+			}
+		}
+		if _, ok := seen[label]; ok {
+			panic(fmt.Sprintf("指标<%s>的标签名<%s>重复", name, label))
+		}
+		seen[label] = struct{}{}
+	}
+	for label := range constLabels {
+		check(label)
+	}
+	for _, label := range labelNames {
+		check(label)
+	}
+
+	d := &metricDesc{
+		name:        name,
+		help:        help,
+		constLabels: make(Labels, len(constLabels)),
+		labelNames:  append([]string{}, labelNames...),
+	}
+	for k, v := range constLabels {
+		d.constLabels[k] = v
+	}
+	return d
+}
+
+// 获取标签值, 缺少的标签值为空字符串
+func (d *metricDesc) labelValues(labels Labels) []string {
+	values := make([]string, len(d.labelNames))
+	for i, name := range d.labelNames {
+		values[i] = labels[name]
+	}
+	return values
+}
+
+// 生成包含固定标签的完整标签列表
+func (d *metricDesc) makeLabels(values []string) []LabelPair {
+	labels := make(Labels, len(d.constLabels)+len(values))
+	for k, v := range d.constLabels {
+		labels[k] = v
+	}
+	for i, name := range d.labelNames {
+		labels[name] = values[i]
+	}
+	return makeLabelPairs(labels)
+}
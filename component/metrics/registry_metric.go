@@ -0,0 +1,388 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// 默认直方图桶
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+/*
+生成指数增长的桶, 第一个桶的上界为 start, 之后每个桶是前一个的 factor 倍, 共 count 个
+
+	start <= 0, factor <= 1 或 count < 1 时会panic
+*/
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if start <= 0 || factor <= 1 || count < 1 {
+		panic(fmt.Sprintf("指数桶参数无效, start=%v, factor=%v, count=%d", start, factor, count))
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// 汇总默认计算的分位数
+var DefObjectives = []float64{0.5, 0.9, 0.99}
+
+const (
+	summaryMaxAge     = 10 * time.Minute // 汇总只使用该时间内的观测值计算分位数
+	summaryMaxSamples = 1000             // 汇总计算分位数时最多使用的观测值数量
+
+	exemplarMaxRunes = 128 // OpenMetrics 规定样例的标签名和标签值总长度不能超过128个字符
+)
+
+// 按标签值保存子指标
+type vec[T any] struct {
+	desc     *metricDesc
+	newChild func(labels []LabelPair) T
+
+	mx       sync.RWMutex
+	children map[string]T
+}
+
+func newVec[T any](desc *metricDesc, newChild func(labels []LabelPair) T) *vec[T] {
+	v := &vec[T]{desc: desc, newChild: newChild, children: make(map[string]T)}
+	if len(desc.labelNames) == 0 { // 没有标签时立即创建, 使其在使用前也能被收集
+		v.child(nil)
+	}
+	return v
+}
+
+// 获取子指标, 不存在时创建
+func (v *vec[T]) child(labels Labels) T {
+	values := v.desc.labelValues(labels)
+	key := strings.Join(values, "\xff")
+
+	v.mx.RLock()
+	c, ok := v.children[key]
+	v.mx.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	if c, ok = v.children[key]; !ok {
+		c = v.newChild(v.desc.makeLabels(values))
+		v.children[key] = c
+	}
+	return c
+}
+
+// 收集指标, 子指标按标签值排序
+func (v *vec[T]) collect(typ MetricType, fn func(c T) *Metric) *MetricFamily {
+	v.mx.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]T, len(keys))
+	for i, k := range keys {
+		children[i] = v.children[k]
+	}
+	v.mx.RUnlock()
+
+	f := &MetricFamily{Name: v.desc.name, Help: v.desc.help, Type: typ, Metrics: make([]*Metric, 0, len(children))}
+	for _, c := range children {
+		f.Metrics = append(f.Metrics, fn(c))
+	}
+	return f
+}
+
+// 原子的增加浮点数
+func atomicAddFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(bits, old, n) {
+			return
+		}
+	}
+}
+
+// 生成样例, 没有标签或超过长度限制时返回nil
+func makeExemplar(labels Labels, v float64) *Exemplar {
+	if len(labels) == 0 {
+		return nil
+	}
+	var n int
+	for k, val := range labels {
+		n += utf8.RuneCountInString(k) + utf8.RuneCountInString(val)
+	}
+	if n > exemplarMaxRunes {
+		return nil
+	}
+	ex := &Exemplar{Labels: make(Labels, len(labels)), Value: v, Timestamp: time.Now()}
+	for k, val := range labels {
+		ex.Labels[k] = val
+	}
+	return ex
+}
+
+// ---------- counter ----------
+
+type counter struct {
+	labels   []LabelPair
+	bits     uint64
+	exemplar atomic.Pointer[Exemplar]
+}
+
+type counterVec struct {
+	*vec[*counter]
+}
+
+func newCounterVec(desc *metricDesc) *counterVec {
+	return &counterVec{newVec(desc, func(labels []LabelPair) *counter {
+		return &counter{labels: labels}
+	})}
+}
+
+func (v *counterVec) metricType() MetricType { return CounterType }
+
+func (v *counterVec) Inc(labels Labels, exemplar Labels) { v.Add(1, labels, exemplar) }
+
+// 增加计数, 计数器只能增加, v 小于0时忽略
+func (v *counterVec) Add(val float64, labels Labels, exemplar Labels) {
+	if val < 0 {
+		return
+	}
+	c := v.child(labels)
+	atomicAddFloat(&c.bits, val)
+	if ex := makeExemplar(exemplar, val); ex != nil {
+		c.exemplar.Store(ex)
+	}
+}
+
+func (v *counterVec) collect() *MetricFamily {
+	return v.vec.collect(CounterType, func(c *counter) *Metric {
+		return &Metric{
+			Labels:   c.labels,
+			Value:    math.Float64frombits(atomic.LoadUint64(&c.bits)),
+			Exemplar: c.exemplar.Load(),
+		}
+	})
+}
+
+// ---------- gauge ----------
+
+type gauge struct {
+	labels []LabelPair
+	bits   uint64
+}
+
+type gaugeVec struct {
+	*vec[*gauge]
+}
+
+func newGaugeVec(desc *metricDesc) *gaugeVec {
+	return &gaugeVec{newVec(desc, func(labels []LabelPair) *gauge {
+		return &gauge{labels: labels}
+	})}
+}
+
+func (v *gaugeVec) metricType() MetricType { return GaugeType }
+
+func (v *gaugeVec) Set(val float64, labels Labels) {
+	atomic.StoreUint64(&v.child(labels).bits, math.Float64bits(val))
+}
+func (v *gaugeVec) Inc(labels Labels)              { v.Add(1, labels) }
+func (v *gaugeVec) Dec(labels Labels)              { v.Add(-1, labels) }
+func (v *gaugeVec) Add(val float64, labels Labels) { atomicAddFloat(&v.child(labels).bits, val) }
+func (v *gaugeVec) Sub(val float64, labels Labels) { v.Add(-val, labels) }
+func (v *gaugeVec) SetToCurrentTime(labels Labels) {
+	v.Set(float64(time.Now().UnixNano())/1e9, labels)
+}
+
+func (v *gaugeVec) collect() *MetricFamily {
+	return v.vec.collect(GaugeType, func(g *gauge) *Metric {
+		return &Metric{Labels: g.labels, Value: math.Float64frombits(atomic.LoadUint64(&g.bits))}
+	})
+}
+
+// ---------- histogram ----------
+
+type histogram struct {
+	labels      []LabelPair
+	upperBounds []float64
+
+	mx        sync.Mutex
+	counts    []uint64    // 每个桶的计数, 最后一个为 +Inf 桶
+	exemplars []*Exemplar // 每个桶最后的样例
+	count     uint64
+	sum       float64
+}
+
+func (h *histogram) observe(v float64, ex *Exemplar) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.mx.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	if ex != nil {
+		h.exemplars[i] = ex
+	}
+	h.mx.Unlock()
+}
+
+func (h *histogram) data() *HistogramData {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	d := &HistogramData{
+		Count:       h.count,
+		Sum:         h.sum,
+		Buckets:     make([]Bucket, len(h.upperBounds)),
+		InfExemplar: h.exemplars[len(h.upperBounds)],
+	}
+	var cumulative uint64
+	for i, ub := range h.upperBounds {
+		cumulative += h.counts[i]
+		d.Buckets[i] = Bucket{UpperBound: ub, Count: cumulative, Exemplar: h.exemplars[i]}
+	}
+	return d
+}
+
+type histogramVec struct {
+	*vec[*histogram]
+}
+
+// 整理桶, 为空时使用默认桶, 会排序去重并移除 +Inf
+func normalizeBuckets(buckets []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	out := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if math.IsInf(b, 1) || math.IsNaN(b) {
+			continue
+		}
+		out = append(out, b)
+	}
+	sort.Float64s(out)
+	n := 0
+	for i, b := range out {
+		if i == 0 || b != out[n-1] {
+			out[n] = b
+			n++
+		}
+	}
+	return out[:n]
+}
+
+func newHistogramVec(desc *metricDesc, buckets []float64) *histogramVec {
+	upperBounds := normalizeBuckets(buckets)
+	return &histogramVec{newVec(desc, func(labels []LabelPair) *histogram {
+		return &histogram{
+			labels:      labels,
+			upperBounds: upperBounds,
+			counts:      make([]uint64, len(upperBounds)+1),
+			exemplars:   make([]*Exemplar, len(upperBounds)+1),
+		}
+	})}
+}
+
+func (v *histogramVec) metricType() MetricType { return HistogramType }
+
+func (v *histogramVec) Observe(val float64, labels Labels, exemplar Labels) {
+	v.child(labels).observe(val, makeExemplar(exemplar, val))
+}
+
+func (v *histogramVec) collect() *MetricFamily {
+	return v.vec.collect(HistogramType, func(h *histogram) *Metric {
+		return &Metric{Labels: h.labels, Histogram: h.data()}
+	})
+}
+
+// ---------- summary ----------
+
+type summarySample struct {
+	v float64
+	t time.Time
+}
+
+/*
+汇总, 分位数根据最近 summaryMaxAge 内最多 summaryMaxSamples 个观测值计算
+
+	样例不会被输出, 因为 OpenMetrics 的 summary 不支持样例
+*/
+type summary struct {
+	labels []LabelPair
+
+	mx      sync.Mutex
+	samples []summarySample // 环形缓冲区
+	next    int
+	count   uint64
+	sum     float64
+}
+
+func (s *summary) observe(v float64) {
+	s.mx.Lock()
+	if len(s.samples) < summaryMaxSamples {
+		s.samples = append(s.samples, summarySample{v: v, t: time.Now()})
+	} else {
+		s.samples[s.next] = summarySample{v: v, t: time.Now()}
+		s.next = (s.next + 1) % summaryMaxSamples
+	}
+	s.count++
+	s.sum += v
+	s.mx.Unlock()
+}
+
+func (s *summary) data() *SummaryData {
+	cutoff := time.Now().Add(-summaryMaxAge)
+	s.mx.Lock()
+	values := make([]float64, 0, len(s.samples))
+	for _, sample := range s.samples {
+		if sample.t.After(cutoff) {
+			values = append(values, sample.v)
+		}
+	}
+	d := &SummaryData{Count: s.count, Sum: s.sum}
+	s.mx.Unlock()
+
+	sort.Float64s(values)
+	for _, q := range DefObjectives {
+		value := math.NaN()
+		if len(values) > 0 {
+			i := int(math.Ceil(q*float64(len(values)))) - 1
+			if i < 0 {
+				i = 0
+			}
+			value = values[i]
+		}
+		d.Quantiles = append(d.Quantiles, Quantile{Quantile: q, Value: value})
+	}
+	return d
+}
+
+type summaryVec struct {
+	*vec[*summary]
+}
+
+func newSummaryVec(desc *metricDesc) *summaryVec {
+	return &summaryVec{newVec(desc, func(labels []LabelPair) *summary {
+		return &summary{labels: labels}
+	})}
+}
+
+func (v *summaryVec) metricType() MetricType { return SummaryType }
+
+func (v *summaryVec) Observe(val float64, labels Labels, exemplar Labels) {
+	v.child(labels).observe(val)
+}
+
+func (v *summaryVec) collect() *MetricFamily {
+	return v.vec.collect(SummaryType, func(s *summary) *Metric {
+		return &Metric{Labels: s.labels, Summary: s.data()}
+	})
+}
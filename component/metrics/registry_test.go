@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryText(t *testing.T) {
+	r := NewRegistry()
+	c := r.RegistryCounter("req_total", "请求数", Labels{"app": "a"}, "code")
+	c.Inc(Labels{"code": "0"}, nil)
+	c.Add(2, Labels{"code": "1"}, nil)
+	c.Add(-1, Labels{"code": "1"}, nil) // 计数器不能减少
+	require.Equal(t, c, r.RegistryCounter("req_total", "请求数", Labels{"app": "a"}, "code"))
+	require.Panics(t, func() { r.RegistryGauge("req_total", "", nil) })
+
+	g := r.RegistryGauge("temp", "温度\n第二行", nil)
+	g.Set(3, nil)
+	g.Sub(0.5, nil)
+
+	h := r.RegistryHistogram("cost", "", []float64{10, 1, 5}, nil, "kind")
+	h.Observe(1, Labels{"kind": "x"}, nil)
+	h.Observe(7, Labels{"kind": "x"}, nil)
+	h.Observe(100, Labels{"kind": "x"}, nil)
+
+	r.Counter("req_total").Inc(Labels{"code": "0"}, nil)
+	r.Counter("not_exists").Inc(nil, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, r.Gather()))
+	expect := `# TYPE cost histogram
+cost_bucket{kind="x",le="1"} 1
+cost_bucket{kind="x",le="5"} 1
+cost_bucket{kind="x",le="10"} 2
+cost_bucket{kind="x",le="+Inf"} 3
+cost_sum{kind="x"} 108
+cost_count{kind="x"} 3
+# HELP req_total 请求数
+# TYPE req_total counter
+req_total{app="a",code="0"} 2
+req_total{app="a",code="1"} 2
+# HELP temp 温度\n第二行
+# TYPE temp gauge
+temp 2.5
+`
+	require.Equal(t, expect, buf.String())
+}
+
+func TestRegistryOpenMetrics(t *testing.T) {
+	r := NewRegistry()
+	r.RegistryCounter("req_total", "请求数", nil).Inc(nil, Labels{"trace_id": "abc"})
+	r.RegistryHistogram("cost", "耗时", []float64{1}, nil).Observe(0.5, nil, Labels{"trace_id": "def"})
+	s := r.RegistrySummary("size", "大小", nil)
+	for i := 1; i <= 100; i++ {
+		s.Observe(float64(i), nil, nil)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	Handler(r).ServeHTTP(rec, req)
+	require.Equal(t, OpenMetricsContentType, rec.Header().Get("Content-Type"))
+
+	out := rec.Body.String()
+	require.Contains(t, out, "# TYPE req counter\n")
+	require.Contains(t, out, `req_total 1 # {trace_id="abc"} 1 `)
+	require.Contains(t, out, `cost_bucket{le="1"} 1 # {trace_id="def"} 0.5 `)
+	require.Contains(t, out, `size{quantile="0.5"} 50`+"\n")
+	require.Contains(t, out, `size{quantile="0.99"} 99`+"\n")
+	require.Contains(t, out, "size_count 100\n")
+	require.True(t, strings.HasSuffix(out, "# EOF\n"))
+
+	// 不接受 OpenMetrics 时使用 text 格式, 不输出样例
+	rec = httptest.NewRecorder()
+	Handler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, TextContentType, rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "req_total 1\n")
+	require.NotContains(t, rec.Body.String(), "# EOF")
+}
+
+func TestCollectors(t *testing.T) {
+	r := NewRegistry()
+	r.RegistryCollector(NewGoCollector())
+	r.RegistryCollector(NewProcessCollector())
+
+	names := make(map[string]bool)
+	for _, f := range r.Gather() {
+		names[f.Name] = true
+	}
+	require.True(t, names["go_goroutines"])
+	require.True(t, names["go_gc_duration_seconds"])
+	require.True(t, names["go_memstats_heap_alloc_bytes"])
+	require.True(t, names["process_resident_memory_bytes"])
+}
+
+func TestLazyCounter(t *testing.T) {
+	old := GetClient()
+	defer SetClient(old)
+
+	SetClient(DefNoopClient)
+	c := NewLazyCounter("lazy_total", "", nil)
+	c.Inc(nil, nil)
+
+	// 设置默认client后注册到新的client
+	r := NewRegistry()
+	SetClient(r)
+	c.Inc(nil, nil)
+	c.Add(2, nil, nil)
+	families := r.Gather()
+	require.Len(t, families, 1)
+	require.Equal(t, 3.0, families[0].Metrics[0].Value)
+}
+
+func TestSetClientConcurrent(t *testing.T) {
+	old := GetClient()
+	defer SetClient(old)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			Counter("x").Inc(nil, nil)
+		}
+	}()
+	r := NewRegistry()
+	SetClient(r)
+	<-done
+	require.Equal(t, Client(r), GetClient())
+}
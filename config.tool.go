@@ -5,3 +5,5 @@ import (
 )
 
 type UserMatcher = config.UserMatcher
+type RuleMatcher = config.RuleMatcher
+type RuleAttrs = config.RuleAttrs
@@ -19,3 +19,8 @@ func WatchConfigJson[T any](groupName, keyName string, opts ...core.ConfigWatchO
 func WatchConfigYaml[T any](groupName, keyName string, opts ...core.ConfigWatchOption) core.IConfigWatchKeyStruct[T] {
 	return config.WatchYaml[T](groupName, keyName, opts...)
 }
+
+// 将主配置中的配置段绑定为结构化观察对象, 配置变更后会重新解析, 失败会fatal, 支持在定义变量时初始化
+func BindConfigSection[T any](key string, opts ...core.ConfigWatchOption) core.IConfigWatchKeyStruct[T] {
+	return config.BindSection[T](key, opts...)
+}
@@ -50,6 +50,12 @@ type ApolloConfig struct {
 	ApplicationParseKeys    []string // application命名空间下哪些key数据会被解析, 无论如何默认的key(frame/components/plugins/services)会被解析
 	Namespaces              []string // 其他自定义命名空间
 	IgnoreNamespaceNotFound bool     // 是否忽略命名空间不存在
+	Label                   string   // 灰度发布标签
+	ClientIP                string   // 客户端ip, 用于灰度发布, 为空时自动获取本机ip
+	LongPollTimeout         int      // 长轮询超时时间(秒), 默认65
+	RetryMinInterval        int      // 失败重试的最小间隔(毫秒), 默认1000, 连续失败时间隔翻倍
+	RetryMaxInterval        int      // 失败重试的最大间隔(毫秒), 默认60000
+	FallbackClusters        []string // 命名空间在当前集群不存在时依次回退的集群, 最后总是会回退到default集群
 	client                  *apollo_sdk.ApolloClient
 }
 
@@ -96,6 +102,12 @@ func makeApolloConfigFromViper(vi *viper.Viper) (*ApolloConfig, error) {
 		AlwaysLoadFromRemote: conf.AlwaysLoadFromRemote,
 		BackupFile:           conf.BackupFile,
 		Namespaces:           append([]string{}, conf.Namespaces...),
+		Label:                conf.Label,
+		ClientIP:             conf.ClientIP,
+		LongPollTimeout:      conf.LongPollTimeout,
+		RetryMinInterval:     conf.RetryMinInterval,
+		RetryMaxInterval:     conf.RetryMaxInterval,
+		FallbackClusters:     append([]string{}, conf.FallbackClusters...),
 	}
 	switch v := strings.ToLower(conf.ApplicationDataType); v {
 	case "yaml", "yml", "json":
@@ -116,7 +128,7 @@ func makeApolloConfigFromViper(vi *viper.Viper) (*ApolloConfig, error) {
 }
 
 // 从apollo中获取配置构建viper
-func makeViperFromApollo(conf *ApolloConfig) (*viper.Viper, error) {
+func makeViperFromApollo(conf *ApolloConfig, sources configSources) (*viper.Viper, error) {
 	dataList, err := conf.client.GetNamespacesData()
 	if err != nil {
 		return nil, fmt.Errorf("获取apollo配置数据失败: %s", err)
@@ -124,10 +136,15 @@ func makeViperFromApollo(conf *ApolloConfig) (*viper.Viper, error) {
 
 	configs := make(map[string]interface{}, len(dataList))
 	for namespace, data := range dataList {
-		err := analyseApolloConfig(configs, namespace, data.Configurations, conf)
+		nsConfigs := make(map[string]interface{})
+		err := analyseApolloConfig(nsConfigs, namespace, data.Configurations, conf)
 		if err != nil {
 			return nil, fmt.Errorf("分析apollo配置数据失败: %v", err)
 		}
+		for k, v := range nsConfigs {
+			configs[k] = v
+		}
+		sources.record(makeSource(ConfigSourceApollo, namespace), nsConfigs)
 	}
 
 	// 检查命名空间必须存在
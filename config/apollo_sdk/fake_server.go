@@ -0,0 +1,252 @@
+package apollo_sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+进程内的apollo配置服务模拟服务, 用于离线测试
+
+	支持获取配置api和通知长轮询api, 以及按ip和label的灰度发布
+*/
+type FakeServer struct {
+	*httptest.Server
+
+	mx              sync.Mutex
+	longPollTimeout time.Duration             // 长轮询的超时时间, 超时后返回304
+	namespaces      map[string]*fakeNamespace // key为 cluster/namespace
+	notifyId        int
+	notify          chan struct{} // 数据变更时关闭并重建
+	requests        []*FakeRequest
+	unavailable     bool
+}
+
+type fakeNamespace struct {
+	data           *NamespaceData
+	notificationId int
+	grays          []*fakeGray
+}
+
+// 灰度发布规则
+type fakeGray struct {
+	ips            []string
+	labels         []string
+	configurations map[string]string
+	releaseKey     string
+}
+
+// 模拟服务收到的请求
+type FakeRequest struct {
+	Api        string // config 或 notification
+	Cluster    string
+	Namespace  string // 仅 config 请求有值
+	ReleaseKey string // 仅 config 请求有值
+	IP         string
+	Label      string // 仅 config 请求有值
+}
+
+// 创建模拟服务
+func NewFakeServer() *FakeServer {
+	s := &FakeServer{
+		longPollTimeout: time.Second,
+		namespaces:      make(map[string]*fakeNamespace),
+		notify:          make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/configs/", s.handleConfigs)
+	mux.HandleFunc("/notifications/v2", s.handleNotifications)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *FakeServer) getNamespace(cluster, namespace string) *fakeNamespace {
+	key := cluster + "/" + namespace
+	ns, ok := s.namespaces[key]
+	if !ok {
+		ns = &fakeNamespace{data: &NamespaceData{Cluster: cluster, Namespace: namespace}}
+		s.namespaces[key] = ns
+	}
+	return ns
+}
+
+// 变更通知
+func (s *FakeServer) changed(ns *fakeNamespace) {
+	s.notifyId++
+	ns.notificationId = s.notifyId
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// 发布命名空间的配置
+func (s *FakeServer) SetNamespace(cluster, namespace string, configurations map[string]string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	ns := s.getNamespace(cluster, namespace)
+	ns.data.Configurations = configurations
+	ns.data.ReleaseKey = fmt.Sprintf("release-%d", s.notifyId+1)
+	s.changed(ns)
+}
+
+// 对命名空间进行灰度发布, 请求的ip或label任意一个匹配时使用灰度配置
+func (s *FakeServer) SetGrayRelease(cluster, namespace string, ips, labels []string, configurations map[string]string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	ns := s.getNamespace(cluster, namespace)
+	ns.grays = append(ns.grays, &fakeGray{
+		ips:            ips,
+		labels:         labels,
+		configurations: configurations,
+		releaseKey:     fmt.Sprintf("gray-release-%d", s.notifyId+1),
+	})
+	s.changed(ns)
+}
+
+// 删除命名空间
+func (s *FakeServer) DeleteNamespace(cluster, namespace string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.namespaces, cluster+"/"+namespace)
+}
+
+// 设置长轮询的超时时间, 超时后返回304
+func (s *FakeServer) SetLongPollTimeout(timeout time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.longPollTimeout = timeout
+}
+
+// 设置服务是否不可用, 不可用时所有请求都会返回500
+func (s *FakeServer) SetUnavailable(unavailable bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.unavailable = unavailable
+}
+
+// 获取收到的请求
+func (s *FakeServer) Requests() []*FakeRequest {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]*FakeRequest{}, s.requests...)
+}
+
+func (s *FakeServer) handleConfigs(w http.ResponseWriter, r *http.Request) {
+	// /configs/{appId}/{clusterName}/{namespaceName}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/configs/"), "/")
+	if len(parts) != 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	appId, cluster, namespace := parts[0], parts[1], parts[2]
+	query := r.URL.Query()
+	req := &FakeRequest{
+		Api:        apiTypeConfig,
+		Cluster:    cluster,
+		Namespace:  namespace,
+		ReleaseKey: query.Get("releaseKey"),
+		IP:         query.Get("ip"),
+		Label:      query.Get("label"),
+	}
+
+	s.mx.Lock()
+	s.requests = append(s.requests, req)
+	if s.unavailable {
+		s.mx.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ns, ok := s.namespaces[cluster+"/"+namespace]
+	if !ok || ns.data.Configurations == nil {
+		s.mx.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	result := *ns.data
+	result.AppId = appId
+	for _, g := range ns.grays {
+		if inStrings(g.ips, req.IP) || inStrings(g.labels, req.Label) {
+			result.Configurations = g.configurations
+			result.ReleaseKey = g.releaseKey
+			break
+		}
+	}
+	s.mx.Unlock()
+
+	if result.ReleaseKey == req.ReleaseKey {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(&result)
+}
+
+func (s *FakeServer) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cluster := query.Get("cluster")
+	var params []*NotificationParam
+	if err := json.Unmarshal([]byte(query.Get("notifications")), &params); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mx.Lock()
+	s.requests = append(s.requests, &FakeRequest{
+		Api:     apiTypeNotification,
+		Cluster: cluster,
+		IP:      query.Get("ip"),
+	})
+	timeout := time.After(s.longPollTimeout)
+	s.mx.Unlock()
+
+	for {
+		s.mx.Lock()
+		if s.unavailable {
+			s.mx.Unlock()
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var rsp []*NotificationRsp
+		for _, p := range params {
+			// 和真实服务一样, 当前集群不存在时使用default集群的通知
+			ns, ok := s.namespaces[cluster+"/"+p.NamespaceName]
+			if !ok {
+				ns, ok = s.namespaces[DefaultCluster+"/"+p.NamespaceName]
+			}
+			if ok && ns.notificationId > p.NotificationId {
+				rsp = append(rsp, &NotificationRsp{NamespaceName: p.NamespaceName, NotificationId: ns.notificationId})
+			}
+		}
+		notify := s.notify
+		s.mx.Unlock()
+
+		if len(rsp) > 0 {
+			_ = json.NewEncoder(w).Encode(rsp)
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-timeout:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func inStrings(ss []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
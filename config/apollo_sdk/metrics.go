@@ -0,0 +1,40 @@
+package apollo_sdk
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+const (
+	metricsApolloRequestMsec        = "apollo_request_msec"         // apollo请求耗时
+	metricsApolloRequestFailedTotal = "apollo_request_failed_total" // apollo请求失败计数器
+)
+
+// 请求的api类型
+const (
+	apiTypeConfig       = "config"
+	apiTypeNotification = "notification"
+)
+
+var requestMsecBuckets = []float64{5, 10, 50, 100, 500, 1000, 3000, 10000, 30000, 65000}
+
+// 配置加载时指标插件还未设置默认client, 所以使用跟随默认client的指标
+var (
+	requestMsecHistogram = metrics.NewLazyHistogram(metricsApolloRequestMsec, "apollo请求耗时", requestMsecBuckets, nil, "api", "cluster", "code")
+	requestFailedCounter = metrics.NewLazyCounter(metricsApolloRequestFailedTotal, "apollo请求失败计数器", nil, "api", "cluster", "code")
+)
+
+// 记录请求结果, code为0表示请求未得到响应
+func (a *ApolloClient) reportRequest(api, cluster string, startTime time.Time, code int, failed bool) {
+	labels := metrics.Labels{
+		"api":     api,
+		"cluster": cluster,
+		"code":    strconv.Itoa(code),
+	}
+	requestMsecHistogram.Observe(float64(time.Since(startTime).Milliseconds()), labels, nil)
+	if failed {
+		requestFailedCounter.Inc(labels, nil)
+	}
+}
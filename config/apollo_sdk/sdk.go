@@ -20,24 +20,36 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
 	"github.com/zly-app/zapp/log"
+	"github.com/zly-app/zapp/pkg/utils"
 )
 
 // apollo获取配置api
 // https://github.com/ctripcorp/apollo/wiki/%E5%85%B6%E5%AE%83%E8%AF%AD%E8%A8%80%E5%AE%A2%E6%88%B7%E7%AB%AF%E6%8E%A5%E5%85%A5%E6%8C%87%E5%8D%97
 // https://www.apolloconfig.com/#/zh/usage/other-language-client-user-guide?id=_13-%e9%80%9a%e8%bf%87%e4%b8%8d%e5%b8%a6%e7%bc%93%e5%ad%98%e7%9a%84http%e6%8e%a5%e5%8f%a3%e4%bb%8eapollo%e8%af%bb%e5%8f%96%e9%85%8d%e7%bd%ae
-// {config_server_url}/configs/{appId}/{clusterName}/{namespaceName}?releaseKey={releaseKey}&ip={clientIp}
-const ApolloGetNamespaceDataApiUrl = "/configs/%s/%s/%s?releaseKey=%s&ip=%s"
+// {config_server_url}/configs/{appId}/{clusterName}/{namespaceName}?releaseKey={releaseKey}&ip={clientIp}&label={label}
+const ApolloGetNamespaceDataApiUrl = "/configs/%s/%s/%s?releaseKey=%s&ip=%s&label=%s"
 
 const (
 	// apollo获取通知api
-	// {config_server_url}/notifications/v2?appId={appId}&cluster={clusterName}&notifications={notifications}
-	ApolloWatchNamespaceChangedApiUrl = "/notifications/v2?appId=%s&cluster=%s&notifications=%s"
+	// {config_server_url}/notifications/v2?appId={appId}&cluster={clusterName}&notifications={notifications}&ip={clientIp}
+	ApolloWatchNamespaceChangedApiUrl = "/notifications/v2?appId=%s&cluster=%s&notifications=%s&ip=%s"
+)
+
+// 默认集群名
+const DefaultCluster = "default"
+
+const (
+	// 默认失败重试的最小间隔
+	DefaultRetryMinInterval = time.Second
+	// 默认失败重试的最大间隔
+	DefaultRetryMaxInterval = time.Minute
 )
 
 var (
@@ -81,7 +93,14 @@ type ApolloClient struct {
 	AlwaysLoadFromRemote bool     // 总是从远程获取, 在远程加载失败时不会从备份文件加载
 	BackupFile           string   // 备份文件名
 	Namespaces           []string // 其他自定义命名空间
+	Label                string   // 灰度发布标签
+	ClientIP             string   // 客户端ip, 用于灰度发布, 为空时自动获取本机ip
+	LongPollTimeout      int      // 长轮询超时时间(秒), <= 0 时使用 HttpReqNotificationTimeout
+	RetryMinInterval     int      // 失败重试的最小间隔(毫秒), <= 0 时使用 DefaultRetryMinInterval
+	RetryMaxInterval     int      // 失败重试的最大间隔(毫秒), <= 0 时使用 DefaultRetryMaxInterval
+	FallbackClusters     []string // 命名空间在当前集群不存在时依次回退的集群, 最后总是会回退到default集群
 	cache                MultiNamespaceData
+	cacheMx              sync.RWMutex // 用于锁 cache, 长轮询协程会并发写入
 }
 
 type (
@@ -108,14 +127,54 @@ type (
 )
 
 func (a *ApolloClient) clientIP() string {
-	return ""
+	return a.ClientIP
 }
 
 func (a *ApolloClient) Init() error {
 	a.cache = make(MultiNamespaceData)
+	if a.ClientIP == "" {
+		a.ClientIP = utils.GetInstance("")
+	}
 	return nil
 }
 
+// 获取命名空间的集群回退链, 当前集群 > 回退集群 > default
+func (a *ApolloClient) clusterChain() []string {
+	chain := make([]string, 0, len(a.FallbackClusters)+2)
+	seen := make(map[string]struct{}, cap(chain))
+	for _, c := range append(append([]string{a.Cluster}, a.FallbackClusters...), DefaultCluster) {
+		if c == "" {
+			continue
+		}
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		chain = append(chain, c)
+	}
+	return chain
+}
+
+// 获取失败重试的间隔, failCount 为连续失败的次数, 从1开始, 每次失败间隔翻倍
+func (a *ApolloClient) RetryInterval(failCount int) time.Duration {
+	minInterval := DefaultRetryMinInterval
+	if a.RetryMinInterval > 0 {
+		minInterval = time.Duration(a.RetryMinInterval) * time.Millisecond
+	}
+	maxInterval := DefaultRetryMaxInterval
+	if a.RetryMaxInterval > 0 {
+		maxInterval = time.Duration(a.RetryMaxInterval) * time.Millisecond
+	}
+	interval := minInterval
+	for i := 1; i < failCount && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
 // 获取所有命名空间的数据
 func (a *ApolloClient) GetNamespacesData() (MultiNamespaceData, error) {
 	namespaces := append([]string{ApplicationNamespace}, a.Namespaces...)
@@ -137,16 +196,12 @@ func (a *ApolloClient) GetNamespacesData() (MultiNamespaceData, error) {
 		// 从远程获取数据
 		remoteData, _, err := a.loadNamespaceDataFromRemote(namespace)
 		if err == nil { // 成功拿到则覆盖数据
-			a.cache[namespace] = remoteData
+			a.setCache(namespace, remoteData)
 			continue
 		}
 
 		// 如果远程命名空间不存在则使用本地配置
 		if err == os.ErrNotExist {
-			localData, ok := a.cache[namespace]
-			if ok {
-				a.cache[namespace] = localData
-			}
 			continue
 		}
 
@@ -156,16 +211,21 @@ func (a *ApolloClient) GetNamespacesData() (MultiNamespaceData, error) {
 		}
 
 		log.Log.Error("从远程获取配置失败", zap.String("namespace", namespace), zap.Error(err))
-		_, ok := a.cache[namespace]
-		if !ok {
+		if a.getCache(namespace) == nil {
 			return nil, fmt.Errorf("本地命名空间<%s>的数据不存在", namespace)
 		}
 	}
 
-	return a.cache, nil
+	a.cacheMx.RLock()
+	defer a.cacheMx.RUnlock()
+	result := make(MultiNamespaceData, len(a.cache))
+	for k, v := range a.cache {
+		result[k] = v
+	}
+	return result, nil
 }
 
-// 从远程加载命名空间数据
+// 从远程加载命名空间数据, 命名空间在当前集群不存在时会按回退链依次尝试其它集群
 func (a *ApolloClient) loadNamespaceDataFromRemote(namespace string) (data *NamespaceData, changed bool, err error) {
 	// 检查配置
 	if a.Address == "" {
@@ -175,17 +235,36 @@ func (a *ApolloClient) loadNamespaceDataFromRemote(namespace string) (data *Name
 		return nil, false, errors.New("apollo的appid是空的")
 	}
 	if a.Cluster == "" {
-		a.Cluster = "default"
+		a.Cluster = DefaultCluster
 	}
 
-	cacheData, hasCache := a.cache[namespace]
+	for _, cluster := range a.clusterChain() {
+		data, changed, err = a.loadNamespaceDataFromCluster(cluster, namespace)
+		if err == os.ErrNotExist {
+			continue
+		}
+		if err == nil && cluster != a.Cluster && changed {
+			log.Log.Warn("命名空间在当前集群不存在, 使用回退集群的数据",
+				zap.String("namespace", namespace),
+				zap.String("cluster", a.Cluster),
+				zap.String("fallbackCluster", cluster),
+			)
+		}
+		return data, changed, err
+	}
+	return nil, false, os.ErrNotExist
+}
 
-	var requestUri string
-	if hasCache {
-		requestUri = fmt.Sprintf(ApolloGetNamespaceDataApiUrl, a.AppId, a.Cluster, namespace, cacheData.ReleaseKey, a.clientIP())
-	} else {
-		requestUri = fmt.Sprintf(ApolloGetNamespaceDataApiUrl, a.AppId, a.Cluster, namespace, "", a.clientIP())
+// 从远程指定集群加载命名空间数据
+func (a *ApolloClient) loadNamespaceDataFromCluster(cluster, namespace string) (data *NamespaceData, changed bool, err error) {
+	// 只有缓存数据来自同一个集群时才能使用它的releaseKey
+	cacheData := a.getCache(namespace)
+	releaseKey := ""
+	if cacheData != nil && (cacheData.Cluster == "" || cacheData.Cluster == cluster) {
+		releaseKey = cacheData.ReleaseKey
 	}
+	requestUri := fmt.Sprintf(ApolloGetNamespaceDataApiUrl, a.AppId, cluster, namespace,
+		url.QueryEscape(releaseKey), url.QueryEscape(a.clientIP()), url.QueryEscape(a.Label))
 
 	// 构建请求体
 	// 超时
@@ -199,14 +278,18 @@ func (a *ApolloClient) loadNamespaceDataFromRemote(namespace string) (data *Name
 	a.officialSignature(req) // 认证
 
 	// 请求
+	startTime := time.Now()
 	resp, err := HttpClient.Do(req)
 	if err != nil {
+		a.reportRequest(apiTypeConfig, cluster, startTime, 0, true)
 		return nil, false, err
 	}
 	defer resp.Body.Close()
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
+		a.reportRequest(apiTypeConfig, cluster, startTime, resp.StatusCode,
+			resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusNotModified)
 		if resp.StatusCode == http.StatusNotFound { // 命名空间不存在
 			return nil, false, os.ErrNotExist
 		}
@@ -224,9 +307,13 @@ func (a *ApolloClient) loadNamespaceDataFromRemote(namespace string) (data *Name
 	// 解码
 	var result NamespaceData
 	err = json.NewDecoder(resp.Body).Decode(&result)
+	a.reportRequest(apiTypeConfig, cluster, startTime, resp.StatusCode, err != nil)
 	if err != nil {
 		return nil, false, fmt.Errorf("解码失败: %v", err)
 	}
+	if result.Cluster == "" {
+		result.Cluster = cluster
+	}
 	if result.Configurations == nil {
 		result.Configurations = make(map[string]string)
 	}
@@ -240,7 +327,7 @@ func (a *ApolloClient) loadNamespaceDataFromRemote(namespace string) (data *Name
 	如果 oldData.ReleaseKey 不为空则检查是否会改变了
 */
 func (a *ApolloClient) GetNamespaceData(namespace string, ignoreRemoteErr bool) (oldData, newData *NamespaceData, changed bool, err error) {
-	oldData = a.cache[namespace]
+	oldData = a.getCache(namespace)
 	if oldData == nil {
 		oldData = &NamespaceData{
 			AppId:          a.AppId,
@@ -259,7 +346,7 @@ func (a *ApolloClient) GetNamespaceData(namespace string, ignoreRemoteErr bool)
 		return oldData, oldData, false, nil
 	}
 	if changed {
-		a.cache[namespace] = newData
+		a.setCache(namespace, newData)
 		a.saveDataToBackupFile()
 	}
 	return
@@ -282,15 +369,19 @@ func (a *ApolloClient) WaitNotification(ctx context.Context, param []*Notificati
 		return nil, errors.New("apollo的appid是空的")
 	}
 	if a.Cluster == "" {
-		a.Cluster = "default"
+		a.Cluster = DefaultCluster
 	}
 
 	paramData, _ := json.Marshal(param)
-	requestUri := fmt.Sprintf(ApolloWatchNamespaceChangedApiUrl, a.AppId, a.Cluster, url.QueryEscape(string(paramData)))
+	requestUri := fmt.Sprintf(ApolloWatchNamespaceChangedApiUrl, a.AppId, a.Cluster, url.QueryEscape(string(paramData)), url.QueryEscape(a.clientIP()))
 
 	// 超时
+	timeout := HttpReqNotificationTimeout
+	if a.LongPollTimeout > 0 {
+		timeout = time.Duration(a.LongPollTimeout) * time.Second
+	}
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, HttpReqNotificationTimeout)
+	ctx, cancel = context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	// 构建请求体
@@ -300,6 +391,7 @@ func (a *ApolloClient) WaitNotification(ctx context.Context, param []*Notificati
 	}
 	a.officialSignature(req) // 认证
 
+	startTime := time.Now()
 	resp, err := HttpClient.Do(req)
 	if err != nil {
 		if err == context.Canceled { // 被主动取消
@@ -310,12 +402,14 @@ func (a *ApolloClient) WaitNotification(ctx context.Context, param []*Notificati
 				return nil, nil
 			}
 		}
+		a.reportRequest(apiTypeNotification, a.Cluster, startTime, 0, true)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
+		a.reportRequest(apiTypeNotification, a.Cluster, startTime, resp.StatusCode, resp.StatusCode != http.StatusNotModified)
 		if resp.StatusCode == http.StatusNotModified { // 状态未改变
 			return nil, nil
 		}
@@ -330,6 +424,7 @@ func (a *ApolloClient) WaitNotification(ctx context.Context, param []*Notificati
 	// 解码
 	var result []*NotificationRsp
 	err = json.NewDecoder(resp.Body).Decode(&result)
+	a.reportRequest(apiTypeNotification, a.Cluster, startTime, resp.StatusCode, err != nil)
 	if err != nil {
 		return nil, fmt.Errorf("解码失败: %v", err)
 	}
@@ -338,11 +433,17 @@ func (a *ApolloClient) WaitNotification(ctx context.Context, param []*Notificati
 
 // 保存数据到备份文件
 func (a *ApolloClient) saveDataToBackupFile() {
-	if len(a.cache) == 0 || a.BackupFile == "" {
+	if a.BackupFile == "" {
 		return
 	}
 
+	a.cacheMx.RLock()
+	if len(a.cache) == 0 {
+		a.cacheMx.RUnlock()
+		return
+	}
 	bs, err := yaml.Marshal(a.cache)
+	a.cacheMx.RUnlock()
 	if err == nil {
 		err = os.WriteFile(a.BackupFile, bs, 0644)
 	}
@@ -375,8 +476,33 @@ func (a *ApolloClient) loadDataFromBackupFile() (MultiNamespaceData, error) {
 	return result, nil
 }
 
+// 获取命名空间缓存数据的releaseKey, 不存在时返回空
+func (a *ApolloClient) GetReleaseKey(namespace string) string {
+	data := a.getCache(namespace)
+	if data == nil {
+		return ""
+	}
+	return data.ReleaseKey
+}
+
+// 获取命名空间缓存数据, 不存在时返回nil
+func (a *ApolloClient) getCache(namespace string) *NamespaceData {
+	a.cacheMx.RLock()
+	defer a.cacheMx.RUnlock()
+	return a.cache[namespace]
+}
+
+// 写入命名空间缓存数据
+func (a *ApolloClient) setCache(namespace string, data *NamespaceData) {
+	a.cacheMx.Lock()
+	a.cache[namespace] = data
+	a.cacheMx.Unlock()
+}
+
 // 写入缓存
 func (a *ApolloClient) writeCache(data MultiNamespaceData) {
+	a.cacheMx.Lock()
+	defer a.cacheMx.Unlock()
 	for k, v := range data {
 		a.cache[k] = v
 	}
@@ -0,0 +1,140 @@
+package apollo_sdk
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(s *FakeServer) *ApolloClient {
+	a := &ApolloClient{
+		Address:  s.URL,
+		AppId:    "test",
+		Cluster:  "c1",
+		ClientIP: "10.0.0.1",
+		Label:    "canary",
+	}
+	_ = a.Init()
+	return a
+}
+
+func TestApolloClientGrayRelease(t *testing.T) {
+	s := NewFakeServer()
+	defer s.Close()
+	s.SetNamespace("c1", ApplicationNamespace, map[string]string{"a": "1"})
+
+	a := newTestClient(s)
+	_, data, changed, err := a.GetNamespaceData(ApplicationNamespace, false)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "1", data.Configurations["a"])
+
+	reqs := s.Requests()
+	require.Equal(t, "10.0.0.1", reqs[len(reqs)-1].IP)
+	require.Equal(t, "canary", reqs[len(reqs)-1].Label)
+
+	// 未变更时返回304, 使用缓存数据
+	_, data, changed, err = a.GetNamespaceData(ApplicationNamespace, false)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, "1", data.Configurations["a"])
+
+	// 按label灰度
+	s.SetGrayRelease("c1", ApplicationNamespace, nil, []string{"canary"}, map[string]string{"a": "2"})
+	_, data, changed, err = a.GetNamespaceData(ApplicationNamespace, false)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "2", data.Configurations["a"])
+}
+
+func TestApolloClientFallbackCluster(t *testing.T) {
+	s := NewFakeServer()
+	defer s.Close()
+	s.SetNamespace("c2", "ns1", map[string]string{"k": "c2"})
+	s.SetNamespace(DefaultCluster, "ns1", map[string]string{"k": "default"})
+	s.SetNamespace(DefaultCluster, "ns2", map[string]string{"k": "default"})
+	s.SetNamespace(DefaultCluster, ApplicationNamespace, map[string]string{})
+
+	a := newTestClient(s)
+	a.FallbackClusters = []string{"c2"}
+	a.Namespaces = []string{"ns1", "ns2"}
+	a.BackupFile = filepath.Join(t.TempDir(), "backup.yaml")
+
+	data, err := a.GetNamespacesData()
+	require.NoError(t, err)
+	require.Equal(t, "c2", data["ns1"].Cluster)
+	require.Equal(t, "c2", data["ns1"].Configurations["k"])
+	require.Equal(t, DefaultCluster, data["ns2"].Cluster)
+	require.Equal(t, "default", data["ns2"].Configurations["k"])
+
+	// 当前集群发布后使用当前集群的数据
+	s.SetNamespace("c1", "ns2", map[string]string{"k": "c1"})
+	_, newData, changed, err := a.GetNamespaceData("ns2", false)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "c1", newData.Cluster)
+	require.Equal(t, "c1", newData.Configurations["k"])
+
+	// 所有集群都不存在
+	_, _, _, err = a.GetNamespaceData("ns3", false)
+	require.Error(t, err)
+}
+
+func TestApolloClientWaitNotification(t *testing.T) {
+	s := NewFakeServer()
+	defer s.Close()
+	s.SetLongPollTimeout(time.Millisecond * 100)
+	s.SetNamespace(DefaultCluster, ApplicationNamespace, map[string]string{"a": "1"})
+
+	a := newTestClient(s)
+	param := []*NotificationParam{{NamespaceName: ApplicationNamespace, NotificationId: -1}}
+	rsp, err := a.WaitNotification(context.Background(), param)
+	require.NoError(t, err)
+	require.Len(t, rsp, 1)
+
+	// 没有变更时服务端超时返回304
+	param[0].NotificationId = rsp[0].NotificationId
+	rsp, err = a.WaitNotification(context.Background(), param)
+	require.NoError(t, err)
+	require.Len(t, rsp, 0)
+
+	// 长轮询期间的变更
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		s.SetNamespace(DefaultCluster, ApplicationNamespace, map[string]string{"a": "2"})
+	}()
+	rsp, err = a.WaitNotification(context.Background(), param)
+	require.NoError(t, err)
+	require.Len(t, rsp, 1)
+	require.Greater(t, rsp[0].NotificationId, param[0].NotificationId)
+
+	// 客户端长轮询超时
+	s.SetLongPollTimeout(time.Second * 3)
+	a.LongPollTimeout = 1
+	startTime := time.Now()
+	param[0].NotificationId = rsp[0].NotificationId
+	_, err = a.WaitNotification(context.Background(), param)
+	require.Error(t, err)
+	require.Less(t, time.Since(startTime), time.Second*2)
+
+	// 服务不可用
+	s.SetUnavailable(true)
+	_, err = a.WaitNotification(context.Background(), param)
+	require.Error(t, err)
+}
+
+func TestApolloClientRetryInterval(t *testing.T) {
+	a := &ApolloClient{RetryMinInterval: 100, RetryMaxInterval: 500}
+	require.Equal(t, time.Millisecond*100, a.RetryInterval(1))
+	require.Equal(t, time.Millisecond*200, a.RetryInterval(2))
+	require.Equal(t, time.Millisecond*400, a.RetryInterval(3))
+	require.Equal(t, time.Millisecond*500, a.RetryInterval(4))
+	require.Equal(t, time.Millisecond*500, a.RetryInterval(100))
+
+	a = &ApolloClient{}
+	require.Equal(t, DefaultRetryMinInterval, a.RetryInterval(1))
+	require.Equal(t, DefaultRetryMaxInterval, a.RetryInterval(100))
+}
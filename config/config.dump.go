@@ -0,0 +1,250 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zly-app/zapp/consts"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/pkg/utils"
+)
+
+// 配置差异
+type ConfigDiff struct {
+	Key    string      // 配置key, 观察的key以 watch.<groupName>.<keyName> 表示
+	Source string      // 当前值的来源
+	Old    interface{} // 启动时的值, nil表示启动时不存在
+	New    interface{} // 当前值, nil表示当前已不存在
+}
+
+// 获取配置脱敏key, 包含默认的脱敏key
+func getMaskKeys(c core.IConfig) []string {
+	keys := strings.Split(consts.DefaultConfigMaskKeys, ",")
+	if c != nil && c.Config() != nil {
+		for _, k := range c.Config().Frame.PrintConfigMaskKeys {
+			keys = append(keys, strings.ToLower(k))
+		}
+	}
+	return keys
+}
+
+// 检查key是否需要脱敏, 完整路径或任意一段路径匹配时都会脱敏
+func isMaskKey(key string, maskKeys []string) bool {
+	key = strings.ToLower(key)
+	if utils.Text.IsMatchWildcardAny(key, maskKeys...) {
+		return true
+	}
+	for _, k := range strings.Split(key, ".") {
+		if utils.Text.IsMatchWildcardAny(k, maskKeys...) {
+			return true
+		}
+	}
+	return false
+}
+
+// 脱敏配置值, 会递归处理值中的map和列表, 列表不会产生路径
+func maskValue(key string, value interface{}, maskKeys []string) interface{} {
+	if value == nil {
+		return value
+	}
+	if isMaskKey(key, maskKeys) {
+		return consts.ConfigMaskValue
+	}
+	if m, ok := toStringMap(value); ok {
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = maskValue(key+"."+k, v, maskKeys)
+		}
+		return out
+	}
+	if list, ok := value.([]interface{}); ok {
+		out := make([]interface{}, len(list))
+		for i, v := range list {
+			out[i] = maskValue(key, v, maskKeys)
+		}
+		return out
+	}
+	return value
+}
+
+/*
+脱敏观察的配置数据
+
+	json, yaml, properties, mapstructure 类型的数据会解码后按内容脱敏, 无法解码时整个值都会脱敏
+	txt 类型只按 key 脱敏
+*/
+func maskWatchData(key string, structType StructType, data []byte, maskKeys []string) interface{} {
+	if len(data) == 0 || structType == Txt || isMaskKey(key, maskKeys) {
+		return maskValue(key, string(data), maskKeys)
+	}
+	var v interface{}
+	var err error
+	if structType == Yaml {
+		err = yaml.Unmarshal(data, &v)
+	} else {
+		err = json.Unmarshal(data, &v)
+	}
+	if err != nil {
+		return consts.ConfigMaskValue
+	}
+	return maskValue(key, v, maskKeys)
+}
+
+// 获取生效的配置数据, frame配置会合并默认值
+func getEffectiveSettings(c core.IConfig) map[string]interface{} {
+	settings := make(map[string]interface{})
+	if c.Config() != nil {
+		if frame, err := structToSettings(c.Config().Frame); err == nil {
+			settings["frame"] = frame
+		}
+	}
+	mergeSettings(settings, c.GetViper().AllSettings())
+	return settings
+}
+
+// 将结构体转为key为小写的配置数据
+func structToSettings(a interface{}) (map[string]interface{}, error) {
+	bs, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	return lowerSettingsKey(m), nil
+}
+
+func lowerSettingsKey(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if mm, ok := toStringMap(v); ok {
+			v = lowerSettingsKey(mm)
+		}
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+// 将src深度合并到dst
+func mergeSettings(dst, src map[string]interface{}) {
+	for k, v := range src {
+		k = strings.ToLower(k)
+		srcMap, srcOk := toStringMap(v)
+		dstMap, dstOk := toStringMap(dst[k])
+		if srcOk && dstOk {
+			merged := lowerSettingsKey(dstMap)
+			mergeSettings(merged, srcMap)
+			dst[k] = merged
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// 输出脱敏后的yaml格式配置数据, 每个叶子节点会以注释标明来源
+func DumpConfig(c core.IConfig) ([]byte, error) {
+	cc, _ := c.(*configCli)
+	var sources configSources
+	if cc != nil {
+		sources = cc.getSources()
+	}
+
+	node, err := makeDumpNode("", getEffectiveSettings(c), sources, getMaskKeys(c))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(node)
+}
+
+func makeDumpNode(prefix string, settings map[string]interface{}, sources configSources, maskKeys []string) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range sortedKeys(settings) {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: k}
+
+		v := settings[k]
+		if m, ok := toStringMap(v); ok && len(m) > 0 {
+			valueNode, err := makeDumpNode(key, m, sources, maskKeys)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, keyNode, valueNode)
+			continue
+		}
+
+		valueNode := new(yaml.Node)
+		if err := valueNode.Encode(maskValue(key, v, maskKeys)); err != nil {
+			return nil, fmt.Errorf("序列化配置<%s>失败: %v", key, err)
+		}
+		if sources != nil {
+			// 非标量的注释放在key上, 否则yaml会把注释输出到下一个节点
+			if valueNode.Kind == yaml.ScalarNode || len(valueNode.Content) == 0 {
+				valueNode.LineComment = sources.get(key)
+			} else {
+				keyNode.LineComment = sources.get(key)
+			}
+		}
+		node.Content = append(node.Content, keyNode, valueNode)
+	}
+	return node, nil
+}
+
+// 对比启动时和当前的配置, 包括已观察的key, 返回的值已脱敏
+func DiffStartupConfig(c core.IConfig) []*ConfigDiff {
+	maskKeys := getMaskKeys(c)
+	var out []*ConfigDiff
+
+	if cc, ok := c.(*configCli); ok && cc.startup != nil {
+		current := flattenSettings(cc.GetViper().AllSettings())
+		sources := cc.getSources()
+		keys := make(map[string]struct{}, len(current)+len(cc.startup))
+		for k := range current {
+			keys[k] = struct{}{}
+		}
+		for k := range cc.startup {
+			keys[k] = struct{}{}
+		}
+		for k := range keys {
+			oldValue, newValue := cc.startup[k], current[k]
+			if reflect.DeepEqual(oldValue, newValue) {
+				continue
+			}
+			out = append(out, &ConfigDiff{
+				Key:    k,
+				Source: sources.get(k),
+				Old:    maskValue(k, oldValue, maskKeys),
+				New:    maskValue(k, newValue, maskKeys),
+			})
+		}
+	}
+
+	for _, w := range getWatchKeyObjects() {
+		initData, ok := w.initData.Load().([]byte)
+		if !ok {
+			continue
+		}
+		newData := w.getRawData()
+		if string(initData) == string(newData) {
+			continue
+		}
+		key := "watch." + w.groupName + "." + w.keyName
+		out = append(out, &ConfigDiff{
+			Key:    key,
+			Source: "watch",
+			Old:    maskWatchData(key, w.Opts().StructType, initData, maskKeys),
+			New:    maskWatchData(key, w.Opts().StructType, newData, maskKeys),
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/consts"
+)
+
+// 测试结束后恢复全局配置
+func restoreConf(t *testing.T) {
+	old := Conf
+	t.Cleanup(func() { Conf = old })
+}
+
+func TestDumpConfig(t *testing.T) {
+	restoreConf(t)
+	isolateWatchKeyObjects(t)
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "a.yaml")
+	file2 := filepath.Join(dir, "b.yaml")
+	require.NoError(t, os.WriteFile(file1, []byte(`
+frame:
+  debug: false
+components:
+  redis:
+    default:
+      address: 127.0.0.1:6379
+      password: abc
+`), 0644))
+	require.NoError(t, os.WriteFile(file2, []byte(`
+frame:
+  printConfigMaskKeys: [address]
+components:
+  redis:
+    default:
+      password: xyz
+`), 0644))
+
+	c := NewConfig("test", WithoutFlag(), WithFiles(file1, file2))
+	require.Equal(t, "file:"+file1, GetConfigSource(c, "frame.debug"))
+	require.Equal(t, "file:"+file2, GetConfigSource(c, "components.redis.default.password"))
+	require.Equal(t, ConfigSourceDefault, GetConfigSource(c, "frame.log.level"))
+
+	data, err := DumpConfig(c)
+	require.NoError(t, err)
+	text := string(data)
+	require.NotContains(t, text, "xyz")
+	require.NotContains(t, text, "127.0.0.1")
+	require.Contains(t, text, consts.ConfigMaskValue)
+	require.Contains(t, text, "# file:"+file2)
+	require.Contains(t, text, "# "+ConfigSourceDefault)
+
+	require.Empty(t, DiffStartupConfig(c))
+	c.GetViper().Set("components.redis.default.password", "new")
+	c.GetViper().Set("components.redis.default.db", 1)
+	diffs := DiffStartupConfig(c)
+	require.Len(t, diffs, 2)
+	require.Equal(t, "components.redis.default.db", diffs[0].Key)
+	require.Nil(t, diffs[0].Old)
+	require.Equal(t, 1, diffs[0].New)
+	require.Equal(t, "components.redis.default.password", diffs[1].Key)
+	require.Equal(t, consts.ConfigMaskValue, diffs[1].New)
+	require.True(t, strings.HasPrefix(diffs[1].Source, ConfigSourceFile))
+}
+
+func TestDumpConfigMaskList(t *testing.T) {
+	restoreConf(t)
+	file := filepath.Join(t.TempDir(), "a.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+frame:
+  log:
+    sinks:
+      - type: http
+        url: http://127.0.0.1:8080
+        headers:
+          Authorization: Bearer abc
+services:
+  api:
+    users:
+      - name: foo
+        password: xyz
+`), 0644))
+
+	c := NewConfig("test", WithoutFlag(), WithFiles(file))
+	data, err := DumpConfig(c)
+	require.NoError(t, err)
+	text := string(data)
+	require.NotContains(t, text, "Bearer abc")
+	require.NotContains(t, text, "xyz")
+	require.Contains(t, text, "http://127.0.0.1:8080")
+	require.Contains(t, text, "foo")
+}
+
+func TestDiffStartupConfigMaskWatch(t *testing.T) {
+	restoreConf(t)
+	isolateWatchKeyObjects(t)
+	p := registryTestWatchProvider(t, "dump_test")
+	p.Set("g", "json", []byte(`{"db":{"host":"127.0.0.1","password":"abc"},"users":[{"token":"t1"}]}`))
+	p.Set("g", "yaml", []byte("db:\n  password: abc\n"))
+
+	file := filepath.Join(t.TempDir(), "a.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("frame:\n  debug: false\n"), 0644))
+	c := NewConfig("test", WithoutFlag(), WithFiles(file))
+
+	jsonKey := WatchKey("g", "json", WithWatchProvider("dump_test"))
+	yamlKey := WatchKey("g", "yaml", WithWatchProvider("dump_test"), WithWatchStructType(Yaml))
+	require.Contains(t, jsonKey.GetString(), "127.0.0.1")
+	require.NotEmpty(t, yamlKey.GetString())
+
+	p.Set("g", "json", []byte(`{"db":{"host":"127.0.0.2","password":"xyz"},"users":[{"token":"t2"}]}`))
+	p.Set("g", "yaml", []byte("db:\n  password: [xyz"))
+	diffs := DiffStartupConfig(c)
+	require.Len(t, diffs, 2)
+
+	require.Equal(t, "watch.g.json", diffs[0].Key)
+	require.Equal(t, map[string]interface{}{
+		"db":    map[string]interface{}{"host": "127.0.0.2", "password": consts.ConfigMaskValue},
+		"users": []interface{}{map[string]interface{}{"token": consts.ConfigMaskValue}},
+	}, diffs[0].New)
+	require.NotContains(t, fmt.Sprint(diffs[0].Old), "abc")
+
+	// 无法解码时整个值都会脱敏
+	require.Equal(t, "watch.g.yaml", diffs[1].Key)
+	require.Equal(t, consts.ConfigMaskValue, diffs[1].New)
+	require.NotContains(t, fmt.Sprint(diffs[1].Old), "abc")
+}
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -29,10 +30,19 @@ import (
 var Conf core.IConfig
 
 type configCli struct {
-	vi     *viper.Viper
-	conf   *core.Config
-	flags  map[string]struct{}
-	labels map[string]string
+	vi      *viper.Viper
+	conf    *core.Config
+	flags   map[string]struct{}
+	labels  map[string]string
+	sources configSources          // 配置来源
+	startup map[string]interface{} // 启动时的配置快照
+
+	fileStats map[string]fileStat // 加载配置时配置文件的状态
+	viMx      sync.RWMutex        // 用于锁 vi, sources, fileStats
+
+	reload     func() (*viper.Viper, configSources, error) // 重新加载配置
+	reloadMx   sync.Mutex                                  // 用于保证同时只有一个重新加载
+	reloadOnce sync.Once
 }
 
 func newConfig(appName string) *core.Config {
@@ -67,79 +77,105 @@ func NewConfig(appName string, opts ...Option) core.IConfig {
 		flag.Parse()
 	}
 
+	vi, sources, err := loadViper(opt, *confText)
+	if err != nil {
+		log.Log.Fatal("加载配置失败", zap.Error(err))
+	}
+
+	c := &configCli{
+		vi:      vi,
+		conf:    newConfig(appName),
+		sources: sources,
+		startup: flattenSettings(vi.AllSettings()),
+		reload: func() (*viper.Viper, configSources, error) {
+			return loadViper(opt, *confText)
+		},
+		fileStats: statFiles(getSourceFiles(sources)),
+	}
+	// 解析配置
+	if err = vi.Unmarshal(c.conf); err != nil {
+		log.Log.Fatal("配置解析失败", zap.Error(err))
+	}
+
+	c.checkDefaultConfig(appName, c.conf)
+
+	if *testFlag {
+		log.Log.Info("配置文件测试成功")
+		os.Exit(0)
+	}
+
+	c.fill()
+
+	Conf = c
+	return c
+}
+
+/*
+按配置来源优先级加载配置
+
+	配置来源优先级 命令行 > WithViper > WithConfig > WithFiles > WithApollo > 默认配置文件, 之后会加载include和apollo
+*/
+func loadViper(opt *Options, confText string) (*viper.Viper, configSources, error) {
+	sources := make(configSources)
 	var rawVi *viper.Viper
 	var err error
-	if *confText != "" { // 命令行
-		files := strings.Split(*confText, ",")
-		rawVi, err = makeViperFromFile(files, false)
+	if confText != "" { // 命令行
+		files := strings.Split(confText, ",")
+		rawVi, err = makeViperFromFile(files, false, sources, ConfigSourceFlagFile)
 		if err != nil {
-			log.Log.Fatal("从命令指定文件加载失败", zap.Error(err))
+			return nil, nil, fmt.Errorf("从命令指定文件加载失败: %v", err)
 		}
 	} else if opt.vi != nil { // WithViper
 		rawVi = opt.vi
+		sources.record(ConfigSourceViper, rawVi.AllSettings())
 	} else if opt.conf != nil { // WithConfig
 		rawVi, err = makeViperFromStruct(opt.conf)
 		if err != nil {
-			log.Log.Fatal("从配置结构构建viper失败", zap.Any("config", opt.conf), zap.Error(err))
+			return nil, nil, fmt.Errorf("从配置结构构建viper失败: %v", err)
 		}
+		sources.record(ConfigSourceStruct, rawVi.AllSettings())
 	} else if len(opt.files) > 0 { // WithFiles
-		rawVi, err = makeViperFromFile(opt.files, false)
+		rawVi, err = makeViperFromFile(opt.files, false, sources, ConfigSourceFile)
 		if err != nil {
-			log.Log.Fatal("从用户指定文件构建viper失败", zap.Error(err))
+			return nil, nil, fmt.Errorf("从用户指定文件构建viper失败: %v", err)
 		}
 	} else if opt.apolloConfig != nil { // WithApollo
 		rawVi = newViper()
 		rawVi.Set(consts.ApolloConfigKey, opt.apolloConfig)
-	} else if rawVi = loadDefaultFiles(); rawVi != nil {
+		sources.record(ConfigSourceStruct, rawVi.AllSettings())
+	} else if rawVi, err = loadDefaultFiles(sources); err != nil {
+		return nil, nil, err
 	}
 
 	vi := viper.New() // 这个不要使用自定义定界符, 否则导致 parseXXX 配置失败
 	if rawVi != nil {
 		if err := vi.MergeConfigMap(rawVi.AllSettings()); err != nil {
-			log.Log.Fatal("合并配置文件失败", zap.Error(err))
+			return nil, nil, fmt.Errorf("合并配置文件失败: %v", err)
 		}
 	}
 
 	// 如果发现包含配置
 	if vi.IsSet(consts.IncludeConfigFileKey) {
-		vi = loadIncludeConfigFile(vi)
+		if err = loadIncludeConfigFile(vi, sources); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// 如果从viper中发现了apollo配置
 	if vi.IsSet(consts.ApolloConfigKey) {
 		apolloConf, err := makeApolloConfigFromViper(vi)
 		if err != nil {
-			log.Log.Fatal("解析apollo配置失败", zap.Error(err))
+			return nil, nil, fmt.Errorf("解析apollo配置失败: %v", err)
 		}
-		rawVi, err = makeViperFromApollo(apolloConf)
+		rawVi, err = makeViperFromApollo(apolloConf, sources)
 		if err != nil {
-			log.Log.Fatal("从apollo构建viper失败", zap.Error(err))
+			return nil, nil, fmt.Errorf("从apollo构建viper失败: %v", err)
 		}
 		if err = vi.MergeConfigMap(rawVi.AllSettings()); err != nil {
-			log.Log.Fatal("合并apollo配置失败", zap.Error(err))
+			return nil, nil, fmt.Errorf("合并apollo配置失败: %v", err)
 		}
 	}
-
-	c := &configCli{
-		vi:   vi,
-		conf: newConfig(appName),
-	}
-	// 解析配置
-	if err = vi.Unmarshal(c.conf); err != nil {
-		log.Log.Fatal("配置解析失败", zap.Error(err))
-	}
-
-	c.checkDefaultConfig(appName, c.conf)
-
-	if *testFlag {
-		log.Log.Info("配置文件测试成功")
-		os.Exit(0)
-	}
-
-	c.fill()
-
-	Conf = c
-	return c
+	return vi, sources, nil
 }
 
 func (c *configCli) fill() {
@@ -172,7 +208,7 @@ func (c *configCli) makeLabels() {
 }
 
 // 加载默认配置文件, 默认配置文件不存在返回nil
-func loadDefaultFiles() *viper.Viper {
+func loadDefaultFiles(sources configSources) (*viper.Viper, error) {
 	files := strings.Split(consts.DefaultConfigFiles, ",")
 	vi := newViper()
 	for _, file := range files {
@@ -181,21 +217,20 @@ func loadDefaultFiles() *viper.Viper {
 			if os.IsNotExist(err) {
 				continue
 			}
-			log.Log.Fatal("读取配置文件信息失败", zap.String("file", file), zap.Error(err))
+			return nil, fmt.Errorf("读取配置文件信息失败 file: %s, err: %v", file, err)
 		}
 
-		vi.SetConfigFile(file)
-		if err = vi.MergeInConfig(); err != nil {
-			log.Log.Fatal("合并配置文件失败", zap.String("file", file), zap.Error(err))
+		if err = mergeFile(vi, file, false, sources, ConfigSourceDefaultFile); err != nil {
+			return nil, fmt.Errorf("合并配置文件失败 file: %s, err: %v", file, err)
 		}
 		log.Log.Info("使用默认配置文件", zap.String("file", file))
-		return vi
+		return vi, nil
 	}
-	return vi
+	return vi, nil
 }
 
-// 合并文件到viper
-func mergeFile(vi *viper.Viper, file string, ignoreNotExist bool) error {
+// 合并文件到viper, 并记录文件中配置的来源
+func mergeFile(vi *viper.Viper, file string, ignoreNotExist bool, sources configSources, sourceKind string) error {
 	_, err := os.Stat(file)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -208,18 +243,24 @@ func mergeFile(vi *viper.Viper, file string, ignoreNotExist bool) error {
 		return fmt.Errorf("读取配置文件信息失败: %s", err)
 	}
 
-	vi.SetConfigFile(file)
-	if err = vi.MergeInConfig(); err != nil {
+	fileVi := newViper()
+	fileVi.SetConfigFile(file)
+	if err = fileVi.ReadInConfig(); err != nil {
+		return err
+	}
+	settings := fileVi.AllSettings()
+	if err = vi.MergeConfigMap(settings); err != nil {
 		return err
 	}
+	sources.record(makeSource(sourceKind, file), settings)
 	return nil
 }
 
 // 从文件构建viper
-func makeViperFromFile(files []string, ignoreNotExist bool) (*viper.Viper, error) {
+func makeViperFromFile(files []string, ignoreNotExist bool, sources configSources, sourceKind string) (*viper.Viper, error) {
 	vi := newViper()
 	for _, file := range files {
-		if err := mergeFile(vi, file, ignoreNotExist); err != nil {
+		if err := mergeFile(vi, file, ignoreNotExist, sources, sourceKind); err != nil {
 			return nil, fmt.Errorf("合并配置文件'%s'失败: %s", file, err)
 		}
 	}
@@ -243,22 +284,22 @@ func makeViperFromStruct(a interface{}) (*viper.Viper, error) {
 }
 
 // 加载包含配置文件
-func loadIncludeConfigFile(vi *viper.Viper) *viper.Viper {
+func loadIncludeConfigFile(vi *viper.Viper, sources configSources) error {
 	var temp struct {
 		Files string
 	}
 	err := vi.UnmarshalKey(consts.IncludeConfigFileKey, &temp)
 	if err != nil {
-		log.Log.Fatal("include配置错误", zap.Error(err))
+		return fmt.Errorf("include配置错误: %v", err)
 	}
 
 	files := strings.Split(temp.Files, ",")
 	for _, file := range files {
-		if err := mergeFile(vi, file, false); err != nil {
-			log.Log.Fatal("合并包含文件失败", zap.String("file", file), zap.Error(err))
+		if err := mergeFile(vi, file, false, sources, ConfigSourceInclude); err != nil {
+			return fmt.Errorf("合并包含文件失败 file: %s, err: %v", file, err)
 		}
 	}
-	return vi
+	return nil
 }
 
 func (c *configCli) checkDefaultConfig(appName string, conf *core.Config) {
@@ -266,6 +307,9 @@ func (c *configCli) checkDefaultConfig(appName string, conf *core.Config) {
 	conf.Frame.Log.Name = conf.Frame.Name
 	conf.Frame.WaitServiceRunTime = utils.Ternary.Or(conf.Frame.WaitServiceRunTime, consts.DefaultWaitServiceRunTime).(int)
 	conf.Frame.ServiceUnstableObserveTime = utils.Ternary.Or(conf.Frame.ServiceUnstableObserveTime, consts.DefaultServiceUnstableObserveTime).(int)
+	if conf.Frame.ConfigReloadInterval <= 0 {
+		conf.Frame.ConfigReloadInterval = consts.DefaultConfigReloadInterval
+	}
 }
 
 func (c *configCli) Config() *core.Config {
@@ -273,17 +317,20 @@ func (c *configCli) Config() *core.Config {
 }
 
 func (c *configCli) GetViper() *viper.Viper {
+	c.viMx.RLock()
+	defer c.viMx.RUnlock()
 	return c.vi
 }
 
 func (c *configCli) Parse(key string, outPtr interface{}, ignoreNotSet ...bool) error {
-	if !c.vi.IsSet(key) {
+	vi := c.GetViper()
+	if !vi.IsSet(key) {
 		if len(ignoreNotSet) > 0 && ignoreNotSet[0] {
 			return nil
 		}
 		return fmt.Errorf("key<%s>不存在", key)
 	}
-	if err := c.vi.UnmarshalKey(key, outPtr); err != nil {
+	if err := vi.UnmarshalKey(key, outPtr); err != nil {
 		return fmt.Errorf("无法解析key<%s>配置: %s", key, err)
 	}
 	return nil
@@ -292,13 +339,14 @@ func (c *configCli) Parse(key string, outPtr interface{}, ignoreNotSet ...bool)
 func (c *configCli) ParseComponentConfig(componentType core.ComponentType, componentName string, outPtr interface{}, ignoreNotSet ...bool) error {
 	componentName = utils.Ternary.Or(componentName, consts.DefaultComponentName).(string)
 	key := "components." + string(componentType) + "." + componentName
-	if !c.vi.IsSet(key) {
+	vi := c.GetViper()
+	if !vi.IsSet(key) {
 		if len(ignoreNotSet) > 0 && ignoreNotSet[0] {
 			return nil
 		}
 		return fmt.Errorf("组件配置<%s.%s>不存在", componentType, componentName)
 	}
-	if err := c.vi.UnmarshalKey(key, outPtr); err != nil {
+	if err := vi.UnmarshalKey(key, outPtr); err != nil {
 		return fmt.Errorf("无法解析<%s.%s>组件配置: %s", componentType, componentName, err)
 	}
 	return nil
@@ -306,13 +354,14 @@ func (c *configCli) ParseComponentConfig(componentType core.ComponentType, compo
 
 func (c *configCli) ParsePluginConfig(pluginType core.PluginType, outPtr interface{}, ignoreNotSet ...bool) error {
 	key := "plugins." + string(pluginType)
-	if !c.vi.IsSet(key) {
+	vi := c.GetViper()
+	if !vi.IsSet(key) {
 		if len(ignoreNotSet) > 0 && ignoreNotSet[0] {
 			return nil
 		}
 		return fmt.Errorf("插件配置<%s>不存在", pluginType)
 	}
-	if err := c.vi.UnmarshalKey(key, outPtr); err != nil {
+	if err := vi.UnmarshalKey(key, outPtr); err != nil {
 		return fmt.Errorf("无法解析<%s>插件配置: %s", pluginType, err)
 	}
 	return nil
@@ -320,13 +369,14 @@ func (c *configCli) ParsePluginConfig(pluginType core.PluginType, outPtr interfa
 
 func (c *configCli) ParseFilterConfig(filterType core.PluginType, outPtr interface{}, ignoreNotSet ...bool) error {
 	key := "filters.config." + string(filterType)
-	if !c.vi.IsSet(key) {
+	vi := c.GetViper()
+	if !vi.IsSet(key) {
 		if len(ignoreNotSet) > 0 && ignoreNotSet[0] {
 			return nil
 		}
 		return fmt.Errorf("过滤器配置<%s>不存在", filterType)
 	}
-	if err := c.vi.UnmarshalKey(key, outPtr); err != nil {
+	if err := vi.UnmarshalKey(key, outPtr); err != nil {
 		return fmt.Errorf("无法解析<%s>过滤器配置: %s", filterType, err)
 	}
 	return nil
@@ -334,13 +384,14 @@ func (c *configCli) ParseFilterConfig(filterType core.PluginType, outPtr interfa
 
 func (c *configCli) ParseServiceConfig(serviceType core.ServiceType, outPtr interface{}, ignoreNotSet ...bool) error {
 	key := "services." + string(serviceType)
-	if !c.vi.IsSet(key) {
+	vi := c.GetViper()
+	if !vi.IsSet(key) {
 		if len(ignoreNotSet) > 0 && ignoreNotSet[0] {
 			return nil
 		}
 		return fmt.Errorf("服务配置<%s>不存在", serviceType)
 	}
-	if err := c.vi.UnmarshalKey(key, outPtr); err != nil {
+	if err := vi.UnmarshalKey(key, outPtr); err != nil {
 		return fmt.Errorf("无法解析<%s>服务配置: %s", serviceType, err)
 	}
 	return nil
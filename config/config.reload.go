@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/config/apollo_sdk"
+	"github.com/zly-app/zapp/consts"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/handler"
+	"github.com/zly-app/zapp/log"
+)
+
+// 配置文件状态
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// 重新加载主配置, 配置发生变化时会替换 viper 并通知绑定的配置段
+func ReloadConfig() error {
+	c, err := getConfigCli()
+	if err != nil {
+		return err
+	}
+	_, err = c.reloadConfig()
+	return err
+}
+
+// 重新加载主配置, 返回配置是否发生变化
+func (c *configCli) reloadConfig() (bool, error) {
+	c.reloadMx.Lock()
+	defer c.reloadMx.Unlock()
+
+	// 在加载前获取文件状态, 加载期间的变更会在下次检查时发现
+	stats := statFiles(c.getSourceFiles())
+	vi, sources, err := c.reload()
+	if err != nil {
+		c.setFileStats(stats)
+		return false, err
+	}
+	for file, stat := range statFiles(getSourceFiles(sources)) { // 重新加载后文件列表可能会变化
+		if _, ok := stats[file]; !ok {
+			stats[file] = stat
+		}
+	}
+	if reflect.DeepEqual(vi.AllSettings(), c.GetViper().AllSettings()) {
+		c.setFileStats(stats)
+		return false, nil
+	}
+
+	c.viMx.Lock()
+	c.vi = vi
+	c.sources = sources
+	c.fileStats = stats
+	c.viMx.Unlock()
+	log.Log.Info("主配置已重新加载")
+
+	defSectionProvider.onReload(c)
+	return true, nil
+}
+
+// 开始检查配置变更, 只有绑定了配置段才会开始
+func (c *configCli) startReloadLoop() {
+	c.reloadOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		handler.AddHandler(handler.BeforeExitHandler, func(app core.IApp, handlerType handler.HandlerType) {
+			cancel()
+		})
+
+		go c.watchFiles(ctx)
+		if c.GetViper().IsSet(consts.ApolloConfigKey) {
+			go c.watchApollo(ctx)
+		}
+	})
+}
+
+func (c *configCli) getFileStats() map[string]fileStat {
+	c.viMx.RLock()
+	defer c.viMx.RUnlock()
+	return c.fileStats
+}
+
+func (c *configCli) setFileStats(stats map[string]fileStat) {
+	c.viMx.Lock()
+	c.fileStats = stats
+	c.viMx.Unlock()
+}
+
+func (c *configCli) getSourceFiles() []string {
+	return getSourceFiles(c.getSources())
+}
+
+// 获取配置来源中的文件
+func getSourceFiles(sources configSources) []string {
+	var files []string
+	seen := make(map[string]struct{})
+	for _, source := range sources {
+		kind, name, ok := strings.Cut(source, ":")
+		if !ok {
+			continue
+		}
+		switch kind {
+		case ConfigSourceFlagFile, ConfigSourceFile, ConfigSourceDefaultFile, ConfigSourceInclude:
+		default:
+			continue
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// 获取文件状态, 文件不存在时状态为零值
+func statFiles(files []string) map[string]fileStat {
+	stats := make(map[string]fileStat, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			stats[file] = fileStat{}
+			continue
+		}
+		stats[file] = fileStat{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stats
+}
+
+// 定时检查配置文件是否变更
+func (c *configCli) watchFiles(ctx context.Context) {
+	interval := time.Duration(c.conf.Frame.ConfigReloadInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Duration(consts.DefaultConfigReloadInterval) * time.Millisecond
+	}
+	if len(c.getFileStats()) == 0 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if reflect.DeepEqual(c.getFileStats(), statFiles(c.getSourceFiles())) {
+			continue
+		}
+		if _, err := c.reloadConfig(); err != nil {
+			log.Log.Error("配置文件变更后重新加载配置失败, 保留旧配置", zap.Error(err))
+		}
+	}
+}
+
+// 观察apollo命名空间变更
+func (c *configCli) watchApollo(ctx context.Context) {
+	conf, err := makeApolloConfigFromViper(c.GetViper())
+	if err != nil {
+		log.Log.Error("解析apollo配置失败, 无法观察apollo配置变更", zap.Error(err))
+		return
+	}
+	client := conf.client
+
+	notificationIds := make(map[string]int)
+	for _, ns := range append([]string{apollo_sdk.ApplicationNamespace}, client.Namespaces...) {
+		notificationIds[ns] = -1
+	}
+
+	failCount := 0 // 连续失败次数
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		param := make([]*apollo_sdk.NotificationParam, 0, len(notificationIds))
+		for ns, id := range notificationIds {
+			param = append(param, &apollo_sdk.NotificationParam{NamespaceName: ns, NotificationId: id})
+		}
+		rsp, err := client.WaitNotification(ctx, param)
+		if err != nil {
+			failCount++
+			waitTime := client.RetryInterval(failCount)
+			log.Log.Error("观察apollo配置变更失败", zap.Duration("waitTime", waitTime), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(waitTime):
+			}
+			continue
+		}
+		failCount = 0
+		if len(rsp) == 0 {
+			continue
+		}
+
+		for _, v := range rsp {
+			notificationIds[v.NamespaceName] = v.NotificationId
+		}
+		if _, err := c.reloadConfig(); err != nil {
+			log.Log.Error("apollo配置变更后重新加载配置失败, 保留旧配置", zap.Error(err))
+		}
+	}
+}
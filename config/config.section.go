@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zly-app/zapp/core"
+)
+
+// 绑定配置段时使用的组名
+const SectionGroupName = "section"
+
+/*
+配置段提供者, 数据来自主配置
+
+	获取的数据为配置段的json, 主配置重新加载后如果配置段发生变化会触发回调
+*/
+type sectionProvider struct {
+	keys map[string]*sectionKey
+	mx   sync.Mutex // 用于锁 keys
+}
+
+type sectionKey struct {
+	data      []byte
+	callbacks []core.ConfigWatchProviderCallback
+}
+
+var defSectionProvider = &sectionProvider{keys: make(map[string]*sectionKey)}
+
+func getConfigCli() (*configCli, error) {
+	c, ok := Conf.(*configCli)
+	if !ok || c == nil {
+		return nil, errors.New("config未初始化")
+	}
+	return c, nil
+}
+
+// 获取配置段的json
+func (s *sectionProvider) getSection(c *configCli, key string) ([]byte, error) {
+	vi := c.GetViper()
+	if !vi.IsSet(key) {
+		return nil, fmt.Errorf("配置<%s>不存在", key)
+	}
+	return json.Marshal(normalizeSettingValue(vi.Get(key)))
+}
+
+func (s *sectionProvider) Get(_, keyName string) ([]byte, error) {
+	c, err := getConfigCli()
+	if err != nil {
+		return nil, err
+	}
+	return s.getSection(c, keyName)
+}
+
+func (s *sectionProvider) Watch(groupName, keyName string, callback core.ConfigWatchProviderCallback) error {
+	c, err := getConfigCli()
+	if err != nil {
+		return err
+	}
+	data, err := s.getSection(c, keyName)
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	k, ok := s.keys[keyName]
+	if !ok {
+		k = &sectionKey{data: data}
+		s.keys[keyName] = k
+	}
+	k.callbacks = append(k.callbacks, callback)
+	s.mx.Unlock()
+
+	c.startReloadLoop()
+	return nil
+}
+
+// 主配置重新加载后检查配置段是否变化
+func (s *sectionProvider) onReload(c *configCli) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for key, k := range s.keys {
+		data, err := s.getSection(c, key)
+		if err != nil { // 配置段被删除, 保留旧值
+			continue
+		}
+		if bytes.Equal(data, k.data) {
+			continue
+		}
+		oldData := k.data
+		k.data = data
+		for _, fn := range k.callbacks {
+			go fn(SectionGroupName, key, oldData, data)
+		}
+	}
+}
+
+// 将配置值中的 map[interface{}]interface{} 转为 map[string]interface{}, 否则无法序列化为json
+func normalizeSettingValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, vv := range t {
+			out[k] = normalizeSettingValue(vv)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, vv := range t {
+			out[fmt.Sprint(k)] = normalizeSettingValue(vv)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, vv := range t {
+			out[i] = normalizeSettingValue(vv)
+		}
+		return out
+	}
+	return v
+}
+
+/*
+将主配置中的配置段绑定为结构化观察对象, 失败会fatal
+
+	key 为配置段的路径, 如 components.redis.default
+	配置文件或apollo的application命名空间变更时会重新加载主配置, 配置段变化后会重新解析并触发回调
+	解析规则和 viper 一致, 字段名不区分大小写, 支持 mapstructure 标签
+	注意: frame 配置在启动后不会被重新解析
+*/
+func BindSection[T any](key string, opts ...core.ConfigWatchOption) core.IConfigWatchKeyStruct[T] {
+	opts = append(make([]core.ConfigWatchOption, 0, len(opts)+1), opts...)
+	opts = append(opts, func(a interface{}) {
+		o := getWatchOptions(a)
+		o.Provider = defSectionProvider
+		o.StructType = MapStructure
+	})
+	return newWatchKeyStruct[T](SectionGroupName, key, opts...)
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSection struct {
+	Addr    string
+	Num     int
+	Timeout time.Duration
+	Other   string `mapstructure:"other_name"`
+}
+
+func writeSectionFile(t *testing.T, file, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(file, modTime, modTime))
+}
+
+func TestBindSection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	now := time.Now()
+	writeSectionFile(t, file, `
+frame:
+  ConfigReloadInterval: 20
+components:
+  test:
+    default:
+      Addr: a
+      Num: 1
+      Timeout: 3s
+      other_name: x
+`, now)
+	c := NewConfig("test", WithFiles(file), WithoutFlag())
+
+	w := BindSection[*testSection]("components.test.default")
+	require.Equal(t, &testSection{Addr: "a", Num: 1, Timeout: time.Second * 3, Other: "x"}, w.Get())
+
+	type change struct{ old, new *testSection }
+	ch := make(chan change, 10)
+	w.AddCallback(func(isInit bool, oldData, newData *testSection) {
+		if !isInit {
+			ch <- change{oldData, newData}
+		}
+	})
+
+	// 修改其它配置段不会触发回调
+	writeSectionFile(t, file, `
+frame:
+  ConfigReloadInterval: 20
+components:
+  test:
+    default:
+      Addr: a
+      Num: 1
+      Timeout: 3s
+      other_name: x
+    other:
+      Addr: b
+`, now.Add(time.Second))
+	time.Sleep(time.Millisecond * 200)
+	require.Len(t, ch, 0)
+
+	var other testSection
+	require.NoError(t, c.Parse("components.test.other", &other))
+	require.Equal(t, "b", other.Addr)
+
+	// 修改绑定的配置段
+	writeSectionFile(t, file, `
+frame:
+  ConfigReloadInterval: 20
+components:
+  test:
+    default:
+      Addr: a
+      Num: 2
+      Timeout: 3s
+      other_name: x
+`, now.Add(time.Second*2))
+	select {
+	case v := <-ch:
+		require.Equal(t, 1, v.old.Num)
+		require.Equal(t, 2, v.new.Num)
+	case <-time.After(time.Second * 3):
+		t.Fatal("等待配置段变更超时")
+	}
+	require.Equal(t, 2, w.Get().Num)
+
+	// 加载失败时保留旧配置
+	writeSectionFile(t, file, `components: [`, now.Add(time.Second*3))
+	require.Error(t, ReloadConfig())
+	require.Equal(t, 2, w.Get().Num)
+}
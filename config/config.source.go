@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zly-app/zapp/core"
+)
+
+// 配置来源
+const (
+	// 默认值, 未在任何配置来源中设置
+	ConfigSourceDefault = "default"
+	// 命令行 -c 指定的文件
+	ConfigSourceFlagFile = "flag_file"
+	// WithFiles 指定的文件
+	ConfigSourceFile = "file"
+	// 默认配置文件
+	ConfigSourceDefaultFile = "default_file"
+	// include 包含的文件
+	ConfigSourceInclude = "include"
+	// WithViper
+	ConfigSourceViper = "viper"
+	// WithConfig
+	ConfigSourceStruct = "struct"
+	// apollo命名空间
+	ConfigSourceApollo = "apollo"
+)
+
+// 配置来源记录, key为展开后的叶子节点路径(小写, 用.连接), value为来源
+type configSources map[string]string
+
+// 记录配置数据中所有叶子节点的来源, 后记录的覆盖先记录的
+func (s configSources) record(source string, settings map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	for k := range flattenSettings(settings) {
+		s[k] = source
+	}
+}
+
+func (s configSources) get(key string) string {
+	if v, ok := s[strings.ToLower(key)]; ok {
+		return v
+	}
+	return ConfigSourceDefault
+}
+
+// 获取配置来源记录, 重新加载配置后会被替换, 所以不要修改它
+func (c *configCli) getSources() configSources {
+	c.viMx.RLock()
+	defer c.viMx.RUnlock()
+	return c.sources
+}
+
+func makeSource(kind, name string) string {
+	if name == "" {
+		return kind
+	}
+	return kind + ":" + name
+}
+
+// 展开配置数据, 返回叶子节点路径到值的映射
+func flattenSettings(settings map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	flattenTo(out, "", settings)
+	return out
+}
+
+func flattenTo(out map[string]interface{}, prefix string, value interface{}) {
+	m, ok := toStringMap(value)
+	if !ok || (len(m) == 0 && prefix != "") {
+		out[prefix] = value
+		return
+	}
+	for k, v := range m {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenTo(out, key, v)
+	}
+}
+
+// 将各种map类型转为 map[string]interface{}
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[k] = vv
+		}
+		return m, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[fmt.Sprint(k)] = vv
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// 获取配置key的来源, key为用.连接的叶子节点路径, 未知来源返回 ConfigSourceDefault
+func GetConfigSource(c core.IConfig, key string) string {
+	if cc, ok := c.(*configCli); ok {
+		return cc.getSources().get(key)
+	}
+	return ConfigSourceDefault
+}
+
+// 获取所有已记录来源的配置key
+func GetConfigSources(c core.IConfig) map[string]string {
+	cc, ok := c.(*configCli)
+	if !ok {
+		return map[string]string{}
+	}
+	sources := cc.getSources()
+	out := make(map[string]string, len(sources))
+	for k, v := range sources {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
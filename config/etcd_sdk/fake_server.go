@@ -0,0 +1,249 @@
+package etcd_sdk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+/*
+进程内的etcd v3 json网关模拟服务, 用于离线测试
+
+	仅支持单key的 range 和 watch, 以及用户名密码认证
+*/
+type FakeServer struct {
+	*httptest.Server
+
+	mx          sync.Mutex
+	revision    int64
+	compactRev  int64
+	kvs         map[string]*rspKV
+	history     []*fakeEvent
+	notify      chan struct{} // 数据变更时关闭并重建
+	drop        chan struct{} // 断开所有watch时关闭并重建
+	unavailable bool
+	user        string
+	password    string
+}
+
+type fakeEvent struct {
+	typ string
+	kv  *rspKV
+}
+
+const fakeToken = "fake-etcd-token"
+
+// 创建模拟服务
+func NewFakeServer() *FakeServer {
+	s := &FakeServer{
+		kvs:    make(map[string]*rspKV),
+		notify: make(chan struct{}),
+		drop:   make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(EtcdRangeApiUrl, s.handleRange)
+	mux.HandleFunc(EtcdWatchApiUrl, s.handleWatch)
+	mux.HandleFunc(EtcdAuthenticateApiUrl, s.handleAuth)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// 设置数据, 返回新的版本号
+func (s *FakeServer) Put(key string, value []byte) int64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.revision++
+	kv := &rspKV{
+		Key:         base64.StdEncoding.EncodeToString([]byte(key)),
+		Value:       base64.StdEncoding.EncodeToString(value),
+		ModRevision: jsonInt64(s.revision),
+	}
+	s.kvs[key] = kv
+	s.appendEvent(EventTypePut, kv)
+	return s.revision
+}
+
+// 删除数据, 返回新的版本号
+func (s *FakeServer) Delete(key string) int64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.revision++
+	delete(s.kvs, key)
+	s.appendEvent(EventTypeDelete, &rspKV{
+		Key:         base64.StdEncoding.EncodeToString([]byte(key)),
+		ModRevision: jsonInt64(s.revision),
+	})
+	return s.revision
+}
+
+// 压缩历史版本, 小于 revision 的历史事件将被丢弃
+func (s *FakeServer) Compact(revision int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.compactRev = revision
+	history := s.history[:0]
+	for _, e := range s.history {
+		if int64(e.kv.ModRevision) >= revision {
+			history = append(history, e)
+		}
+	}
+	s.history = history
+}
+
+// 断开所有watch连接, 用于模拟网络中断
+func (s *FakeServer) DropWatchers() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	close(s.drop)
+	s.drop = make(chan struct{})
+}
+
+// 关闭服务, 会先断开所有watch连接
+func (s *FakeServer) Close() {
+	s.DropWatchers()
+	s.Server.Close()
+}
+
+// 设置服务是否不可用, 不可用时所有请求返回503
+func (s *FakeServer) SetUnavailable(unavailable bool) {
+	s.mx.Lock()
+	s.unavailable = unavailable
+	s.mx.Unlock()
+	if unavailable {
+		s.DropWatchers()
+	}
+}
+
+// 开启认证
+func (s *FakeServer) SetAuth(user, password string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.user, s.password = user, password
+}
+
+func (s *FakeServer) appendEvent(typ string, kv *rspKV) {
+	s.history = append(s.history, &fakeEvent{typ: typ, kv: kv})
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// 检查请求是否可用, 不可用时会写入错误
+func (s *FakeServer) checkRequest(w http.ResponseWriter, r *http.Request) bool {
+	s.mx.Lock()
+	unavailable, needAuth := s.unavailable, s.user != ""
+	s.mx.Unlock()
+	if unavailable {
+		http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+		return false
+	}
+	if needAuth && r.Header.Get("Authorization") != fakeToken {
+		http.Error(w, `{"error":"invalid auth token"}`, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *FakeServer) handleAuth(w http.ResponseWriter, r *http.Request) {
+	var req authReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mx.Lock()
+	ok := req.Name == s.user && req.Password == s.password
+	s.mx.Unlock()
+	if !ok {
+		http.Error(w, `{"error":"authentication failed"}`, http.StatusBadRequest)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(&authRsp{Token: fakeToken})
+}
+
+func (s *FakeServer) handleRange(w http.ResponseWriter, r *http.Request) {
+	if !s.checkRequest(w, r) {
+		return
+	}
+	var req rangeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, _ := base64.StdEncoding.DecodeString(req.Key)
+
+	s.mx.Lock()
+	rsp := &rangeRsp{Header: rspHeader{Revision: jsonInt64(s.revision)}}
+	if kv, ok := s.kvs[string(key)]; ok {
+		rsp.Kvs = append(rsp.Kvs, kv)
+	}
+	s.mx.Unlock()
+	_ = json.NewEncoder(w).Encode(rsp)
+}
+
+func (s *FakeServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if !s.checkRequest(w, r) {
+		return
+	}
+	var req watchReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CreateRequest == nil {
+		http.Error(w, "invalid watch request", http.StatusBadRequest)
+		return
+	}
+	key := req.CreateRequest.Key
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	write := func(v interface{}) {
+		_ = encoder.Encode(v)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	s.mx.Lock()
+	next := int64(req.CreateRequest.StartRevision)
+	if next <= 0 {
+		next = s.revision + 1
+	}
+	if next < s.compactRev {
+		rsp := map[string]interface{}{"result": map[string]interface{}{
+			"header":           rspHeader{Revision: jsonInt64(s.revision)},
+			"canceled":         true,
+			"compact_revision": jsonInt64(s.compactRev),
+		}}
+		s.mx.Unlock()
+		write(rsp)
+		return
+	}
+	s.mx.Unlock()
+
+	write(map[string]interface{}{"result": map[string]interface{}{"created": true}})
+	for {
+		s.mx.Lock()
+		var events []*watchEvent
+		for _, e := range s.history {
+			if e.kv.Key == key && int64(e.kv.ModRevision) >= next {
+				events = append(events, &watchEvent{Type: e.typ, Kv: e.kv})
+			}
+		}
+		revision := s.revision
+		notify, drop := s.notify, s.drop
+		s.mx.Unlock()
+
+		if len(events) > 0 {
+			write(map[string]interface{}{"result": map[string]interface{}{
+				"header": rspHeader{Revision: jsonInt64(revision)},
+				"events": events,
+			}})
+		}
+		next = revision + 1
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-drop:
+			return
+		case <-notify:
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package etcd_sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/zly-app/zapp/log"
+	"github.com/zly-app/zapp/pkg/utils"
+)
+
+// etcd v3 json网关api
+// https://etcd.io/docs/v3.5/dev-guide/api_grpc_gateway/
+const (
+	EtcdRangeApiUrl        = "/v3/kv/range"
+	EtcdWatchApiUrl        = "/v3/watch"
+	EtcdAuthenticateApiUrl = "/v3/auth/authenticate"
+)
+
+var (
+	// http请求超时
+	HttpReqTimeout = time.Second * 3
+
+	HttpClient = &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}}
+)
+
+// watch的起始版本已被压缩
+var ErrCompacted = errors.New("watch的起始版本已被压缩")
+
+// watch的起始版本已被压缩的错误, 携带服务端已压缩到的版本
+type CompactedError struct {
+	CompactRevision int64
+}
+
+func (e *CompactedError) Error() string {
+	return fmt.Sprintf("%s, compactRevision: %d", ErrCompacted, e.CompactRevision)
+}
+func (e *CompactedError) Is(target error) bool { return target == ErrCompacted }
+
+// watch被服务端取消
+var ErrWatchCanceled = errors.New("watch被服务端取消")
+
+type EtcdClient struct {
+	Address              string // etcd网关地址, 多个地址用英文逗号连接, 如 http://127.0.0.1:2379
+	User                 string // 用户名
+	Password             string // 密码
+	Prefix               string // key前缀
+	AlwaysLoadFromRemote bool   // 总是从远程获取, 在远程加载失败时不会从备份文件加载
+	BackupFile           string // 备份文件名
+
+	addresses []string
+	addrIndex int
+	token     string
+	cache     map[string]*KeyValue
+	mx        sync.Mutex
+}
+
+type (
+	// key数据
+	KeyValue struct {
+		Key      string `yaml:"key"`
+		Value    string `yaml:"value"`
+		Revision int64  `yaml:"revision"` // 最后修改的版本
+	}
+	// watch事件
+	WatchEvent struct {
+		Type     string // PUT, DELETE
+		Key      string
+		Value    []byte
+		Revision int64
+	}
+)
+
+// 事件类型
+const (
+	EventTypePut    = "PUT"
+	EventTypeDelete = "DELETE"
+)
+
+type (
+	// 网关返回的int64是字符串格式
+	jsonInt64 int64
+
+	rangeReq struct {
+		Key string `json:"key"`
+	}
+	rspHeader struct {
+		Revision jsonInt64 `json:"revision"`
+	}
+	rspKV struct {
+		Key         string    `json:"key"`
+		Value       string    `json:"value"`
+		ModRevision jsonInt64 `json:"mod_revision"`
+	}
+	rangeRsp struct {
+		Header rspHeader `json:"header"`
+		Kvs    []*rspKV  `json:"kvs"`
+	}
+	watchCreateReq struct {
+		Key           string    `json:"key"`
+		StartRevision jsonInt64 `json:"start_revision,omitempty"`
+	}
+	watchReq struct {
+		CreateRequest *watchCreateReq `json:"create_request"`
+	}
+	watchEvent struct {
+		Type string `json:"type"`
+		Kv   *rspKV `json:"kv"`
+	}
+	watchRsp struct {
+		Result *struct {
+			Header          rspHeader     `json:"header"`
+			Created         bool          `json:"created"`
+			Canceled        bool          `json:"canceled"`
+			CompactRevision jsonInt64     `json:"compact_revision"`
+			CancelReason    string        `json:"cancel_reason"`
+			Events          []*watchEvent `json:"events"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	authReq struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	authRsp struct {
+		Token string `json:"token"`
+	}
+)
+
+func (i jsonInt64) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+func (i *jsonInt64) UnmarshalJSON(bs []byte) error {
+	s := strings.Trim(string(bs), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = jsonInt64(v)
+	return nil
+}
+
+func (c *EtcdClient) Init() error {
+	c.cache = make(map[string]*KeyValue)
+	for _, addr := range strings.Split(c.Address, ",") {
+		addr = strings.TrimRight(strings.TrimSpace(addr), "/")
+		if addr != "" {
+			c.addresses = append(c.addresses, addr)
+		}
+	}
+	if len(c.addresses) == 0 {
+		return errors.New("etcd的address是空的")
+	}
+
+	// 允许从本地备份获取
+	if c.isAllowLoadFromBackupFile() {
+		backupData, err := c.loadDataFromBackupFile()
+		if err != nil && !os.IsNotExist(err) {
+			log.Log.Error("从本地加载etcd配置失败", zap.Error(err))
+		}
+		for k, v := range backupData {
+			c.cache[k] = v
+		}
+	}
+	return nil
+}
+
+// 获取完整的key
+func (c *EtcdClient) FullKey(key string) string {
+	return c.Prefix + key
+}
+
+/*
+获取key数据
+
+	远程获取失败时如果允许从备份获取则返回缓存数据
+	key不存在返回 os.ErrNotExist
+*/
+func (c *EtcdClient) Get(ctx context.Context, key string) (*KeyValue, error) {
+	data, err := c.loadFromRemote(ctx, key)
+	if err == nil {
+		c.mx.Lock()
+		c.cache[key] = data
+		c.mx.Unlock()
+		c.saveDataToBackupFile()
+		return data, nil
+	}
+	if err == os.ErrNotExist {
+		c.DeleteCache(key)
+		return nil, err
+	}
+	if !c.isAllowLoadFromBackupFile() {
+		return nil, err
+	}
+
+	c.mx.Lock()
+	cacheData, ok := c.cache[key]
+	c.mx.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("从远程获取key<%s>失败且本地备份不存在: %v", key, err)
+	}
+	log.Log.Error("从远程获取etcd配置失败, 使用本地备份", zap.String("key", key), zap.Error(err))
+	return cacheData, nil
+}
+
+// 更新缓存的key数据, 一般在watch到变更后调用
+func (c *EtcdClient) SetCache(data *KeyValue) {
+	c.mx.Lock()
+	c.cache[data.Key] = data
+	c.mx.Unlock()
+	c.saveDataToBackupFile()
+}
+
+// 删除缓存的key数据, 一般在watch到删除后调用
+func (c *EtcdClient) DeleteCache(key string) {
+	c.mx.Lock()
+	_, ok := c.cache[key]
+	delete(c.cache, key)
+	c.mx.Unlock()
+	if ok {
+		c.saveDataToBackupFile()
+	}
+}
+
+func (c *EtcdClient) loadFromRemote(ctx context.Context, key string) (*KeyValue, error) {
+	ctx, cancel := context.WithTimeout(ctx, HttpReqTimeout)
+	defer cancel()
+
+	body := &rangeReq{Key: base64.StdEncoding.EncodeToString([]byte(c.FullKey(key)))}
+	resp, err := c.doRequest(ctx, EtcdRangeApiUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result rangeRsp
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解码失败: %v", err)
+	}
+	if len(result.Kvs) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	value, err := base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("解码value失败: %v", err)
+	}
+	return &KeyValue{
+		Key:      key,
+		Value:    string(value),
+		Revision: int64(result.Kvs[0].ModRevision),
+	}, nil
+}
+
+/*
+观察key, 会一直阻塞直到出现错误或ctx被取消
+
+	startRevision 表示从哪个版本开始观察, <=0 表示从当前版本开始
+	如果 startRevision 已被压缩会返回 *CompactedError, 调用者应该重新获取数据后从 CompactRevision 之后开始观察
+	ctx被取消时返回nil
+*/
+func (c *EtcdClient) Watch(ctx context.Context, key string, startRevision int64, fn func(ev *WatchEvent)) error {
+	body := &watchReq{CreateRequest: &watchCreateReq{
+		Key:           base64.StdEncoding.EncodeToString([]byte(c.FullKey(key))),
+		StartRevision: jsonInt64(startRevision),
+	}}
+	resp, err := c.doRequest(ctx, EtcdWatchApiUrl, body)
+	if err != nil {
+		if ctx.Err() != nil { // 被主动取消
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var rsp watchRsp
+		if err = decoder.Decode(&rsp); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("解码watch数据失败: %v", err)
+		}
+		if rsp.Error != nil {
+			return fmt.Errorf("watch失败: %s", rsp.Error.Message)
+		}
+		if rsp.Result == nil {
+			continue
+		}
+		if rsp.Result.CompactRevision > 0 {
+			return &CompactedError{CompactRevision: int64(rsp.Result.CompactRevision)}
+		}
+		if rsp.Result.Canceled {
+			return fmt.Errorf("%w: %s", ErrWatchCanceled, rsp.Result.CancelReason)
+		}
+		for _, e := range rsp.Result.Events {
+			if e.Kv == nil {
+				continue
+			}
+			ev := &WatchEvent{
+				Type:     utils.Ternary.Or(e.Type, EventTypePut).(string),
+				Key:      key,
+				Revision: int64(e.Kv.ModRevision),
+			}
+			if ev.Revision == 0 {
+				ev.Revision = int64(rsp.Result.Header.Revision)
+			}
+			if ev.Type == EventTypePut {
+				ev.Value, err = base64.StdEncoding.DecodeString(e.Kv.Value)
+				if err != nil {
+					return fmt.Errorf("解码value失败: %v", err)
+				}
+			}
+			fn(ev)
+		}
+	}
+}
+
+// 发送请求, 失败时会切换到下一个地址
+func (c *EtcdClient) doRequest(ctx context.Context, uri string, body interface{}) (*http.Response, error) {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for i := 0; i < len(c.addresses); i++ {
+		resp, err := c.doRequestOnce(ctx, c.currentAddress(), uri, bs, true)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+		c.nextAddress()
+	}
+	return nil, lastErr
+}
+
+func (c *EtcdClient) doRequestOnce(ctx context.Context, address, uri string, body []byte, retryAuth bool) (*http.Response, error) {
+	token, err := c.getToken(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", address+uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		if e, ok := err.(*url.Error); ok && e.Err == context.Canceled {
+			return nil, context.Canceled
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	// token失效时重新认证
+	if resp.StatusCode == http.StatusUnauthorized && token != "" && retryAuth {
+		c.mx.Lock()
+		c.token = ""
+		c.mx.Unlock()
+		return c.doRequestOnce(ctx, address, uri, body, false)
+	}
+	return nil, fmt.Errorf("收到错误码: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// 获取认证token, 未设置用户名时返回空
+func (c *EtcdClient) getToken(ctx context.Context, address string) (string, error) {
+	if c.User == "" {
+		return "", nil
+	}
+	c.mx.Lock()
+	token := c.token
+	c.mx.Unlock()
+	if token != "" {
+		return token, nil
+	}
+
+	bs, _ := json.Marshal(&authReq{Name: c.User, Password: c.Password})
+	req, err := http.NewRequestWithContext(ctx, "POST", address+EtcdAuthenticateApiUrl, bytes.NewReader(bs))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd认证失败, 收到错误码: %d", resp.StatusCode)
+	}
+
+	var result authRsp
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("解码认证结果失败: %v", err)
+	}
+	c.mx.Lock()
+	c.token = result.Token
+	c.mx.Unlock()
+	return result.Token, nil
+}
+
+func (c *EtcdClient) currentAddress() string {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.addresses[c.addrIndex%len(c.addresses)]
+}
+
+func (c *EtcdClient) nextAddress() {
+	c.mx.Lock()
+	c.addrIndex++
+	c.token = "" // 不同节点的token不通用
+	c.mx.Unlock()
+}
+
+// 保存数据到备份文件
+func (c *EtcdClient) saveDataToBackupFile() {
+	if c.BackupFile == "" {
+		return
+	}
+
+	c.mx.Lock()
+	bs, err := yaml.Marshal(c.cache)
+	c.mx.Unlock()
+	if err == nil {
+		err = os.WriteFile(c.BackupFile, bs, 0644)
+	}
+	if err != nil {
+		log.Log.Error("备份etcd配置文件失败", zap.Error(err))
+	}
+}
+
+// 从备份文件加载数据
+func (c *EtcdClient) loadDataFromBackupFile() (map[string]*KeyValue, error) {
+	bs, err := os.ReadFile(c.BackupFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]*KeyValue
+	err = yaml.Unmarshal(bs, &result)
+	if err != nil {
+		return nil, err
+	}
+	for k, d := range result {
+		if d == nil || d.Key != k {
+			return nil, fmt.Errorf("配置<%s>不正确", k)
+		}
+	}
+	return result, nil
+}
+
+// 是否允许从本地备份获取
+func (c *EtcdClient) isAllowLoadFromBackupFile() bool {
+	return !c.AlwaysLoadFromRemote && c.BackupFile != "" // 不总是从远程获取 并且 存在备份文件
+}
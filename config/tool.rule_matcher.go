@@ -0,0 +1,508 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 规则属性
+type RuleAttrs map[string]string
+
+type IRuleMatcher interface {
+	// 数据构建
+	make()
+	// 匹配规则, 返回命中的规则和变体
+	Match(attrs RuleAttrs) (*RuleMatchResult, bool)
+	// 从ctx中获取属性并匹配规则, attrs 的优先级高于ctx中的属性
+	MatchCtx(ctx context.Context, attrs RuleAttrs) (*RuleMatchResult, bool)
+}
+
+var _ IRuleMatcher = (*RuleMatcher)(nil)
+
+/*
+规则匹配器, 用于功能开关/灰度/AB实验
+
+	按顺序匹配规则, 返回第一个命中的规则, 命中后按权重和粘性哈希选择变体
+	属性来源优先级: 传入的attrs > ctx中通过 SaveRuleAttrs 保存的属性 > 通过 RegistryRuleCtxAttr 注册的属性 > 框架属性
+	框架属性包括: app, env, instance, label.<标签名>
+*/
+type RuleMatcher struct {
+	Rules     []*Rule // 规则列表, 按顺序匹配
+	StickyKey string  // 默认的粘性哈希属性名, 规则未设置时使用, 默认为 uid
+
+	err error
+}
+
+// 规则
+type Rule struct {
+	Name      string         // 规则名
+	When      *RuleCondition // 条件, 为空表示总是命中
+	Variants  []*RuleVariant // 命中后按权重选择的变体, 为空时变体名为规则名
+	StickyKey string         // 粘性哈希的属性名, 相同的属性值总是得到相同的变体
+}
+
+/*
+规则条件, And/Or/Not/Attr 只能设置其中一种
+
+	支持的操作符:
+	  eq, ne, in, not_in, prefix, suffix, contains, regex, exists
+	  gt, gte, lt, lte 数字比较
+	  semver_eq, semver_gt, semver_gte, semver_lt, semver_lte 语义化版本比较
+	  percent 按粘性哈希的百分比命中, Value为百分比, 如 10.5
+*/
+type RuleCondition struct {
+	And []*RuleCondition
+	Or  []*RuleCondition
+	Not *RuleCondition
+
+	Attr   string   // 属性名
+	Op     string   // 操作符, 默认为 eq
+	Value  string   // 比较值
+	Values []string // 比较值列表, 用于 in, not_in
+
+	regex   *regexp.Regexp
+	valueF  float64
+	version semver
+	values  map[string]struct{}
+}
+
+// 变体
+type RuleVariant struct {
+	Name   string      // 变体名
+	Weight int         // 权重
+	Value  interface{} // 变体携带的数据
+}
+
+// 匹配结果
+type RuleMatchResult struct {
+	Rule    string      // 命中的规则名
+	Variant string      // 变体名
+	Value   interface{} // 变体携带的数据
+}
+
+const defRuleStickyKey = "uid"
+
+// 粘性哈希的桶数
+const ruleHashBuckets = 10000
+
+func (r *RuleMatcher) make() {
+	if r == nil {
+		return
+	}
+	r.err = nil
+	for i, rule := range r.Rules {
+		if rule == nil {
+			r.err = fmt.Errorf("规则[%d]是空的", i)
+			return
+		}
+		if err := rule.When.make(); err != nil {
+			r.err = fmt.Errorf("规则<%s>的条件错误: %v", rule.Name, err)
+			return
+		}
+		for _, v := range rule.Variants {
+			if v == nil || v.Weight < 0 {
+				r.err = fmt.Errorf("规则<%s>的变体权重不能小于0", rule.Name)
+				return
+			}
+		}
+	}
+}
+
+// 构建并校验规则, 规则错误时的更新会被拒绝, 作为观察对象的字段时也会校验
+func (r *RuleMatcher) Validate() error {
+	if r == nil {
+		return nil
+	}
+	r.make()
+	return r.err
+}
+
+func (r *RuleMatcher) Match(attrs RuleAttrs) (*RuleMatchResult, bool) {
+	return r.match(func(name string) (string, bool) {
+		v, ok := attrs[name]
+		return v, ok
+	})
+}
+
+func (r *RuleMatcher) MatchCtx(ctx context.Context, attrs RuleAttrs) (*RuleMatchResult, bool) {
+	ctxAttrs := GetRuleAttrs(ctx)
+	return r.match(func(name string) (string, bool) {
+		if v, ok := attrs[name]; ok {
+			return v, true
+		}
+		if v, ok := ctxAttrs[name]; ok {
+			return v, true
+		}
+		if fn, ok := getRuleCtxAttr(name); ok {
+			if v, ok := fn(ctx); ok {
+				return v, true
+			}
+		}
+		return getFrameRuleAttr(name)
+	})
+}
+
+// 是否命中任意规则
+func (r *RuleMatcher) IsHit(attrs RuleAttrs) bool {
+	_, ok := r.Match(attrs)
+	return ok
+}
+
+// 获取命中的变体名, 未命中返回 def
+func (r *RuleMatcher) Variant(ctx context.Context, attrs RuleAttrs, def string) string {
+	result, ok := r.MatchCtx(ctx, attrs)
+	if !ok {
+		return def
+	}
+	return result.Variant
+}
+
+func (r *RuleMatcher) match(get func(name string) (string, bool)) (*RuleMatchResult, bool) {
+	if r == nil || r.err != nil {
+		return nil, false
+	}
+	for _, rule := range r.Rules {
+		stickyKey := rule.StickyKey
+		if stickyKey == "" {
+			stickyKey = r.StickyKey
+		}
+		if stickyKey == "" {
+			stickyKey = defRuleStickyKey
+		}
+		sticky, hasSticky := get(stickyKey)
+		e := &ruleEvaluator{get: get, ruleName: rule.Name, sticky: sticky, hasSticky: hasSticky}
+		if !e.eval(rule.When) {
+			continue
+		}
+		return rule.pickVariant(e), true
+	}
+	return nil, false
+}
+
+// 按权重选择变体
+func (rule *Rule) pickVariant(e *ruleEvaluator) *RuleMatchResult {
+	result := &RuleMatchResult{Rule: rule.Name, Variant: rule.Name}
+	total := 0
+	for _, v := range rule.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return result
+	}
+
+	bucket := e.bucket("variant") % total
+	for _, v := range rule.Variants {
+		if bucket < v.Weight {
+			result.Variant = v.Name
+			result.Value = v.Value
+			return result
+		}
+		bucket -= v.Weight
+	}
+	return result
+}
+
+type ruleEvaluator struct {
+	get       func(name string) (string, bool)
+	ruleName  string
+	sticky    string
+	hasSticky bool
+}
+
+// 获取粘性哈希桶, 不存在粘性属性时随机
+func (e *ruleEvaluator) bucket(salt string) int {
+	if !e.hasSticky || e.sticky == "" {
+		return rand.Intn(ruleHashBuckets)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.ruleName + ":" + salt + ":" + e.sticky))
+	return int(h.Sum32() % ruleHashBuckets)
+}
+
+func (e *ruleEvaluator) eval(c *RuleCondition) bool {
+	if c == nil {
+		return true
+	}
+	switch {
+	case len(c.And) > 0:
+		for _, sub := range c.And {
+			if !e.eval(sub) {
+				return false
+			}
+		}
+		return true
+	case len(c.Or) > 0:
+		for _, sub := range c.Or {
+			if e.eval(sub) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !e.eval(c.Not)
+	}
+
+	if c.Op == "percent" {
+		return float64(e.bucket("percent")) < c.valueF*ruleHashBuckets/100
+	}
+
+	v, ok := e.get(c.Attr)
+	switch c.Op {
+	case "exists":
+		return ok
+	case "ne":
+		return !ok || v != c.Value
+	case "not_in":
+		_, in := c.values[v]
+		return !ok || !in
+	}
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case "", "eq":
+		return v == c.Value
+	case "in":
+		_, in := c.values[v]
+		return in
+	case "prefix":
+		return strings.HasPrefix(v, c.Value)
+	case "suffix":
+		return strings.HasSuffix(v, c.Value)
+	case "contains":
+		return strings.Contains(v, c.Value)
+	case "regex":
+		return c.regex.MatchString(v)
+	case "gt", "gte", "lt", "lte":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		return compareResult(c.Op, compareFloat(f, c.valueF))
+	case "semver_eq", "semver_gt", "semver_gte", "semver_lt", "semver_lte":
+		ver, err := parseSemver(v)
+		if err != nil {
+			return false
+		}
+		return compareResult(strings.TrimPrefix(c.Op, "semver_"), ver.compare(c.version))
+	}
+	return false
+}
+
+func (c *RuleCondition) make() error {
+	if c == nil {
+		return nil
+	}
+	n := 0
+	for _, b := range []bool{len(c.And) > 0, len(c.Or) > 0, c.Not != nil, c.Attr != "" || c.Op != ""} {
+		if b {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("And/Or/Not/Attr 必须且只能设置其中一种")
+	}
+
+	for _, sub := range c.And {
+		if err := sub.make(); err != nil {
+			return err
+		}
+	}
+	for _, sub := range c.Or {
+		if err := sub.make(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.make()
+	}
+	if len(c.And) > 0 || len(c.Or) > 0 {
+		return nil
+	}
+
+	if c.Attr == "" && c.Op != "percent" {
+		return fmt.Errorf("操作符<%s>必须设置属性名", c.Op)
+	}
+	var err error
+	switch c.Op {
+	case "", "eq", "ne", "prefix", "suffix", "contains", "exists":
+	case "in", "not_in":
+		c.values = make(map[string]struct{}, len(c.Values))
+		for _, v := range c.Values {
+			c.values[v] = struct{}{}
+		}
+	case "regex":
+		c.regex, err = regexp.Compile(c.Value)
+	case "gt", "gte", "lt", "lte", "percent":
+		c.valueF, err = strconv.ParseFloat(c.Value, 64)
+	case "semver_eq", "semver_gt", "semver_gte", "semver_lt", "semver_lte":
+		c.version, err = parseSemver(c.Value)
+	default:
+		err = fmt.Errorf("不支持的操作符<%s>", c.Op)
+	}
+	if err != nil {
+		return fmt.Errorf("属性<%s>的条件错误: %v", c.Attr, err)
+	}
+	return nil
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareResult(op string, r int) bool {
+	switch op {
+	case "eq":
+		return r == 0
+	case "gt":
+		return r > 0
+	case "gte":
+		return r >= 0
+	case "lt":
+		return r < 0
+	case "lte":
+		return r <= 0
+	}
+	return false
+}
+
+// 语义化版本
+type semver struct {
+	nums       [3]int
+	prerelease string
+}
+
+// 解析语义化版本, 支持 v 前缀, 缺少的部分视为0, 如 1.2 等同于 1.2.0
+func parseSemver(s string) (semver, error) {
+	var v semver
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 { // 忽略构建元数据
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.prerelease = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 || parts[0] == "" {
+		return v, fmt.Errorf("无效的版本号: %s", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("无效的版本号: %s", s)
+		}
+		v.nums[i] = n
+	}
+	return v, nil
+}
+
+func (v semver) compare(o semver) int {
+	for i := range v.nums {
+		if v.nums[i] != o.nums[i] {
+			if v.nums[i] < o.nums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// 预发布版本小于正式版本
+	switch {
+	case v.prerelease == o.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case o.prerelease == "":
+		return -1
+	case v.prerelease < o.prerelease:
+		return -1
+	}
+	return 1
+}
+
+type ruleAttrsKey struct{}
+
+// 将规则属性存入ctx, 会和ctx中已存在的属性合并
+func SaveRuleAttrs(ctx context.Context, attrs RuleAttrs) context.Context {
+	old := GetRuleAttrs(ctx)
+	merged := make(RuleAttrs, len(old)+len(attrs))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, ruleAttrsKey{}, merged)
+}
+
+// 获取ctx中的规则属性
+func GetRuleAttrs(ctx context.Context) RuleAttrs {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ruleAttrsKey{}).(RuleAttrs)
+	return attrs
+}
+
+// 从ctx中获取属性的函数
+type RuleCtxAttrGetter func(ctx context.Context) (string, bool)
+
+var ruleCtxAttrs = struct {
+	getters map[string]RuleCtxAttrGetter
+	mx      sync.RWMutex
+}{getters: make(map[string]RuleCtxAttrGetter)}
+
+// 注册从ctx中获取属性的函数, 如 filter 包注册了 caller_service 等属性
+func RegistryRuleCtxAttr(name string, getter RuleCtxAttrGetter) {
+	ruleCtxAttrs.mx.Lock()
+	defer ruleCtxAttrs.mx.Unlock()
+	ruleCtxAttrs.getters[name] = getter
+}
+
+func getRuleCtxAttr(name string) (RuleCtxAttrGetter, bool) {
+	ruleCtxAttrs.mx.RLock()
+	defer ruleCtxAttrs.mx.RUnlock()
+	fn, ok := ruleCtxAttrs.getters[name]
+	return fn, ok
+}
+
+// 获取框架属性
+func getFrameRuleAttr(name string) (string, bool) {
+	if Conf == nil {
+		return "", false
+	}
+	switch name {
+	case "app":
+		return Conf.Config().Frame.Name, true
+	case "env":
+		return Conf.Config().Frame.Env, true
+	case "instance":
+		return Conf.Config().Frame.Instance, true
+	}
+	if strings.HasPrefix(name, "label.") {
+		labels := Conf.GetLabels()
+		v, ok := labels[strings.ToLower(strings.TrimPrefix(name, "label."))]
+		return v, ok
+	}
+	return "", false
+}
+
+func init() {
+	AddResetInjectObjCallback[IRuleMatcher](func(obj IRuleMatcher, isField bool) {
+		obj.make()
+	})
+}
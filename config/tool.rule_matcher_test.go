@@ -0,0 +1,153 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var ruleMatcherTestProvider = newManualWatchProvider()
+
+func init() {
+	RegistryConfigWatchProvider("rule_matcher_test", ruleMatcherTestProvider)
+}
+
+type testCallerServiceKey struct{}
+
+func TestParseSemver(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"2.0.0+build1", "2.0.0", 0},
+	}
+	for _, c := range cases {
+		a, err := parseSemver(c.a)
+		require.NoError(t, err)
+		b, err := parseSemver(c.b)
+		require.NoError(t, err)
+		require.Equal(t, c.expect, a.compare(b), "%s vs %s", c.a, c.b)
+	}
+	_, err := parseSemver("1.x")
+	require.Error(t, err)
+}
+
+func TestRuleMatcher(t *testing.T) {
+	ruleMatcherTestProvider.Set("g", "rule", []byte(`{
+	"Rules": [
+		{
+			"Name": "whitelist",
+			"When": {"Attr": "uid", "Op": "in", "Values": ["1", "2"]}
+		},
+		{
+			"Name": "new_version",
+			"When": {"And": [
+				{"Attr": "region", "Value": "cn"},
+				{"Attr": "app_version", "Op": "semver_gte", "Value": "2.1.0"},
+				{"Not": {"Attr": "caller_service", "Op": "prefix", "Value": "test_"}}
+			]},
+			"Variants": [
+				{"Name": "A", "Weight": 50, "Value": {"color": "red"}},
+				{"Name": "B", "Weight": 50, "Value": {"color": "blue"}}
+			]
+		},
+		{
+			"Name": "gray",
+			"When": {"Or": [
+				{"Attr": "region", "Op": "regex", "Value": "^us-"},
+				{"Op": "percent", "Value": "100"}
+			]},
+			"StickyKey": "device"
+		}
+	]
+}`))
+	w := WatchJson[*RuleMatcher]("g", "rule", WithWatchProvider("rule_matcher_test"))
+	m := w.Get()
+
+	r, ok := m.Match(RuleAttrs{"uid": "2"})
+	require.True(t, ok)
+	require.Equal(t, "whitelist", r.Rule)
+	require.Equal(t, "whitelist", r.Variant)
+
+	// 粘性哈希, 相同的uid总是得到相同的变体
+	attrs := RuleAttrs{"uid": "100", "region": "cn", "app_version": "v2.3.0"}
+	r, ok = m.Match(attrs)
+	require.True(t, ok)
+	require.Equal(t, "new_version", r.Rule)
+	for i := 0; i < 10; i++ {
+		r2, _ := m.Match(attrs)
+		require.Equal(t, r.Variant, r2.Variant)
+	}
+	// 权重分布
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		r, _ := m.Match(RuleAttrs{"uid": fmt.Sprint(i), "region": "cn", "app_version": "2.1.0"})
+		counts[r.Variant]++
+	}
+	require.InDelta(t, 1000, counts["A"], 150)
+	require.InDelta(t, 1000, counts["B"], 150)
+
+	// 版本不满足时回退到下一个规则
+	r, ok = m.Match(RuleAttrs{"uid": "100", "region": "cn", "app_version": "2.0.9"})
+	require.True(t, ok)
+	require.Equal(t, "gray", r.Rule)
+
+	// 从ctx获取属性
+	RegistryRuleCtxAttr("caller_service", func(ctx context.Context) (string, bool) {
+		v, ok := ctx.Value(testCallerServiceKey{}).(string)
+		return v, ok
+	})
+	ctx := context.WithValue(context.Background(), testCallerServiceKey{}, "test_svc")
+	ctx = SaveRuleAttrs(ctx, RuleAttrs{"region": "cn", "app_version": "3.0.0"})
+	r, ok = m.MatchCtx(ctx, RuleAttrs{"uid": "100"})
+	require.True(t, ok)
+	require.Equal(t, "gray", r.Rule)
+
+	// 错误的规则会被拒绝
+	bad := &RuleMatcher{Rules: []*Rule{{Name: "bad", When: &RuleCondition{Attr: "a", Op: "regex", Value: "("}}}}
+	bad.make()
+	require.Error(t, bad.Validate())
+	_, ok = bad.Match(RuleAttrs{"a": "1"})
+	require.False(t, ok)
+
+	bad = &RuleMatcher{Rules: []*Rule{{Name: "bad", When: &RuleCondition{Attr: "a", Not: &RuleCondition{Attr: "b"}}}}}
+	bad.make()
+	require.Error(t, bad.Validate())
+}
+
+type ruleFlagConfig struct {
+	Enable bool
+	Gray   *RuleMatcher
+}
+
+func TestRuleMatcherWatchField(t *testing.T) {
+	p := registryTestWatchProvider(t, "rule_matcher_field_test")
+	p.Set("g", "flag", []byte(`{"Enable":true,"Gray":{"Rules":[{"Name":"gray","When":{"Attr":"uid","Op":"in","Values":["1"]}}]}}`))
+
+	errCh := make(chan error, 10)
+	w := WatchJson[*ruleFlagConfig]("g", "flag",
+		WithWatchProvider("rule_matcher_field_test"),
+		WithWatchErrorCallback(func(groupName, keyName string, data []byte, err error) {
+			errCh <- err
+		}),
+	)
+	require.True(t, w.Get().Gray.IsHit(RuleAttrs{"uid": "1"}))
+
+	// 作为字段的规则匹配器错误时更新也会被拒绝
+	p.Set("g", "flag", []byte(`{"Enable":true,"Gray":{"Rules":[{"Name":"gray","When":{"Attr":"uid","Op":"regex","Value":"("}}]}}`))
+	select {
+	case err := <-errCh:
+		require.Contains(t, err.Error(), "Gray")
+	case <-time.After(time.Second):
+		t.Fatal("等待错误回调超时")
+	}
+	require.True(t, w.Get().Gray.IsHit(RuleAttrs{"uid": "1"}))
+}
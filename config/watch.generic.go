@@ -1,13 +1,16 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sync"
 	"sync/atomic"
 
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 
+	"github.com/zly-app/zapp/component/metrics"
 	"github.com/zly-app/zapp/core"
 	"github.com/zly-app/zapp/log"
 )
@@ -57,20 +60,49 @@ func (w *watchKeyGeneric[T]) Get() T {
 	return data
 }
 
-// 重新解析数据
-func (w *watchKeyGeneric[T]) reset(first bool, newData []byte) error {
+// 解析数据
+func (w *watchKeyGeneric[T]) parse(data []byte) (interface{}, error) {
 	replica := reflect.New(w.dataType).Interface()
 	var err error
 	switch t := w.keyObject.Opts().StructType; t {
 	case Json:
-		err = w.keyObject.ParseJSON(replica)
+		err = json.Unmarshal(data, replica)
 	case Yaml:
-		err = w.keyObject.ParseYaml(replica)
+		err = yaml.Unmarshal(data, replica)
+	case Properties:
+		err = parsePropertiesData(data, replica)
+	case Txt:
+		err = parseTxtData(data, replica)
+	case MapStructure:
+		err = parseMapStructureData(data, replica)
 	default:
 		err = fmt.Errorf("未定义的解析类型: %v", t)
 	}
 	if err != nil {
-		return fmt.Errorf("解析配置失败: %v", err)
+		return nil, &watchRejectError{reason: watchRejectReasonParse, err: fmt.Errorf("解析配置失败: %v", err)}
+	}
+	return replica, nil
+}
+
+// 检查远程变更的数据, 观察key对象在发布数据和记录历史之前调用, 失败时观察key对象保留旧数据
+func (w *watchKeyGeneric[T]) check(oldData, newData []byte) error {
+	replica, err := w.parse(newData)
+	if err == nil {
+		if err = w.validate(replica); err != nil {
+			err = &watchRejectError{reason: watchRejectReasonValidate, err: fmt.Errorf("校验配置失败: %v", err)}
+		}
+	}
+	if err != nil {
+		w.reject(oldData, newData, err)
+	}
+	return err
+}
+
+// 重新解析数据
+func (w *watchKeyGeneric[T]) reset(first bool, newData []byte) error {
+	replica, err := w.parse(newData)
+	if err != nil {
+		return err
 	}
 
 	var oldData T
@@ -90,6 +122,11 @@ func (w *watchKeyGeneric[T]) reset(first bool, newData []byte) error {
 		}
 	}
 
+	// 校验
+	if err = w.validate(replica); err != nil {
+		return &watchRejectError{reason: watchRejectReasonValidate, err: fmt.Errorf("校验配置失败: %v", err)}
+	}
+
 	w.data.Store(replica)
 	w.rawData.Store(resultData)
 
@@ -114,16 +151,46 @@ func (w *watchKeyGeneric[T]) watchCallback(first bool, oldData, newData []byte)
 			zap.Error(err),
 		)
 	}
-	log.Log.Error("重置数据失败",
+	w.reject(oldData, newData, err)
+}
+
+// 记录被拒绝的更新
+func (w *watchKeyGeneric[T]) reject(oldData, newData []byte, err error) {
+	log.Log.Error("重置数据失败, 保留旧值",
 		zap.String("groupName", w.GroupName()),
 		zap.String("keyName", w.KeyName()),
 		zap.String("oldData", string(oldData)),
 		zap.String("newData", string(newData)),
 		zap.Error(err),
 	)
+
+	reason := watchRejectReasonParse
+	if e, ok := err.(*watchRejectError); ok {
+		reason = e.reason
+	}
+	watchRejectedCounter.Inc(metrics.Labels{
+		"group":  w.GroupName(),
+		"key":    w.KeyName(),
+		"reason": reason,
+	}, nil)
+	if fn := w.keyObject.Opts().ErrorCallback; fn != nil {
+		go fn(w.GroupName(), w.KeyName(), newData, err)
+	}
+}
+
+// 校验数据, 先调用对象及其字段的 Validate() error 方法, 再调用选项中的校验函数
+func (w *watchKeyGeneric[T]) validate(obj interface{}) error {
+	if err := validateObject(obj); err != nil {
+		return err
+	}
+	if fn := w.keyObject.Opts().Validate; fn != nil {
+		return fn(obj)
+	}
+	return nil
 }
 
 func (w *watchKeyGeneric[T]) init() {
+	w.keyObject.addChecker(w.check)
 	w.initWG.Add(1)
 	go func() {
 		w.keyObject.AddCallback(w.watchCallback) // 等待app初始化完毕后, 这里底层的w会立即触发回调
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/log"
+)
+
+// 默认每个观察key保留的历史记录数
+var DefaultWatchHistorySize = 10
+
+// 添加历史记录, 调用者需要持有 historyMx
+func (w *watchKeyObject) addHistory(data []byte) {
+	w.version++
+	h := &core.ConfigWatchKeyHistory{
+		Version: w.version,
+		Data:    data,
+		Time:    time.Now(),
+	}
+	if p, ok := w.p.(core.IConfigWatchProviderRevision); ok {
+		h.Revision = p.GetRevision(w.groupName, w.keyName)
+	}
+	w.history = append(w.history, h)
+
+	size := DefaultWatchHistorySize
+	if w.opts != nil && w.opts.HistorySize > 0 {
+		size = w.opts.HistorySize
+	}
+	if n := len(w.history) - size; n > 0 {
+		// 被固定的版本不会被淘汰
+		history := make([]*core.ConfigWatchKeyHistory, 0, size+1)
+		for i, v := range w.history {
+			if i < n && v.Version != w.pinned {
+				continue
+			}
+			history = append(history, v)
+		}
+		w.history = history
+	}
+}
+
+// 获取某个版本的历史记录, 调用者需要持有 historyMx
+func (w *watchKeyObject) getHistory(version int) (*core.ConfigWatchKeyHistory, error) {
+	for _, h := range w.history {
+		if h.Version == version {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("版本<%d>不存在或已被淘汰", version)
+}
+
+func (w *watchKeyObject) History() []*core.ConfigWatchKeyHistory {
+	w.waitInit()
+	w.historyMx.Lock()
+	defer w.historyMx.Unlock()
+	out := make([]*core.ConfigWatchKeyHistory, len(w.history))
+	copy(out, w.history)
+	return out
+}
+
+func (w *watchKeyObject) Diff(oldVersion, newVersion int) (string, error) {
+	w.waitInit()
+	w.historyMx.Lock()
+	defer w.historyMx.Unlock()
+	oldH, err := w.getHistory(oldVersion)
+	if err != nil {
+		return "", err
+	}
+	newH, err := w.getHistory(newVersion)
+	if err != nil {
+		return "", err
+	}
+	return diffLines(string(oldH.Data), string(newH.Data)), nil
+}
+
+func (w *watchKeyObject) Pin(version int) error {
+	w.waitInit()
+	w.historyMx.Lock()
+	defer w.historyMx.Unlock()
+	h, err := w.getHistory(version)
+	if err != nil {
+		return err
+	}
+	w.pinned = version
+	log.Log.Warn("固定配置版本",
+		zap.String("groupName", w.groupName),
+		zap.String("keyName", w.keyName),
+		zap.Int("version", version),
+	)
+	w.applyData(h.Data)
+	return nil
+}
+
+func (w *watchKeyObject) Unpin() {
+	w.waitInit()
+	w.historyMx.Lock()
+	defer w.historyMx.Unlock()
+	if w.pinned == 0 {
+		return
+	}
+	w.pinned = 0
+	log.Log.Warn("取消固定配置版本",
+		zap.String("groupName", w.groupName),
+		zap.String("keyName", w.keyName),
+	)
+	w.applyData(w.remoteData)
+}
+
+func (w *watchKeyObject) PinnedVersion() int {
+	w.waitInit()
+	w.historyMx.Lock()
+	defer w.historyMx.Unlock()
+	return w.pinned
+}
+
+var _ core.IConfigWatchKeyHistory = (*watchKeyObject)(nil)
+
+// 获取已创建的观察key对象, 不存在时返回nil
+func GetWatchKeyObject(groupName, keyName string) core.IConfigWatchKeyObject {
+	for _, w := range getWatchKeyObjects() {
+		if w.groupName == groupName && w.keyName == keyName {
+			return w
+		}
+	}
+	return nil
+}
+
+// 逐行对比文本, 删除的行以 "- " 开头, 新增的行以 "+ " 开头, 未变的行以 "  " 开头
+func diffLines(a, b string) string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// 最长公共子序列
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			sb.WriteString("  " + x[i] + "\n")
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			sb.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		sb.WriteString("- " + x[i] + "\n")
+	}
+	for ; j < len(y); j++ {
+		sb.WriteString("+ " + y[j] + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/core"
+)
+
+func TestWatchHistory(t *testing.T) {
+	isolateWatchKeyObjects(t)
+	p := registryTestWatchProvider(t, "history_test")
+	p.Set("g", "k", []byte("a\nb"))
+
+	w := WatchKey("g", "k", WithWatchProvider("history_test"), WithWatchHistorySize(3))
+	require.Equal(t, "a\nb", w.GetString())
+	h, ok := w.(core.IConfigWatchKeyHistory)
+	require.True(t, ok)
+
+	p.Set("g", "k", []byte("a\nc"))
+	p.Set("g", "k", []byte("a\nc\nd"))
+	history := h.History()
+	require.Len(t, history, 3)
+	require.Equal(t, 1, history[0].Version)
+	require.Equal(t, 3, history[2].Version)
+	require.Equal(t, "a\nc\nd", w.GetString())
+
+	diff, err := h.Diff(1, 2)
+	require.NoError(t, err)
+	require.Equal(t, "  a\n- b\n+ c\n", diff)
+
+	// 固定到旧版本, 远程变更不生效
+	var changed []string
+	var mx sync.Mutex
+	w.AddCallback(func(isInit bool, oldData, newData []byte) {
+		if !isInit {
+			mx.Lock()
+			changed = append(changed, string(newData))
+			mx.Unlock()
+		}
+	})
+	require.NoError(t, h.Pin(1))
+	require.Equal(t, 1, h.PinnedVersion())
+	require.Equal(t, "a\nb", w.GetString())
+
+	p.Set("g", "k", []byte("e"))
+	p.Set("g", "k", []byte("f"))
+	require.Equal(t, "a\nb", w.GetString())
+
+	// 被固定的版本不会被淘汰
+	history = h.History()
+	require.Len(t, history, 4)
+	require.Equal(t, 1, history[0].Version)
+	require.Equal(t, 5, history[3].Version)
+	_, err = h.Diff(2, 5)
+	require.Error(t, err)
+
+	// 取消固定后恢复为远程最新的数据
+	h.Unpin()
+	require.Equal(t, 0, h.PinnedVersion())
+	require.Equal(t, "f", w.GetString())
+	require.Error(t, h.Pin(2))
+
+	time.Sleep(time.Millisecond * 50)
+	mx.Lock()
+	require.ElementsMatch(t, []string{"a\nb", "f"}, changed)
+	mx.Unlock()
+	require.Equal(t, w, GetWatchKeyObject("g", "k"))
+}
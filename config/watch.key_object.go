@@ -25,10 +25,18 @@ type watchKeyObject struct {
 	initOpts  []core.ConfigWatchOption
 
 	callbacks []core.ConfigWatchKeyCallback
-	watchMx   sync.Mutex // 用于锁 callback
+	checkers  []func(oldData, newData []byte) error // 结构化观察注册的检查函数, 任意一个失败时拒绝远程变更
+	watchMx   sync.Mutex                            // 用于锁 callback, checkers
 
-	data   atomic.Value
-	initWG sync.WaitGroup
+	data     atomic.Value
+	initData atomic.Value // 初始化时获取的数据
+	initWG   sync.WaitGroup
+
+	history    []*core.ConfigWatchKeyHistory // 历史记录
+	version    int                           // 最后的版本号
+	pinned     int                           // 固定的版本号, 0表示未固定
+	remoteData []byte                        // 远程最新的数据
+	historyMx  sync.Mutex                    // 用于锁 history, version, pinned, remoteData
 }
 
 func (w *watchKeyObject) init() {
@@ -47,6 +55,9 @@ func (w *watchKeyObject) init() {
 				zap.Error(err))
 		}
 		w.resetData(data)
+		w.initData.Store(w.getRawData())
+		w.remoteData = w.getRawData()
+		w.addHistory(w.remoteData)
 
 		// 开始观察
 		err = w.p.Watch(w.groupName, w.keyName, w.watchCallback)
@@ -319,6 +330,54 @@ func (w *watchKeyObject) getRawData() []byte {
 
 // 回调
 func (w *watchKeyObject) watchCallback(_, _ string, _, newData []byte) {
+	w.historyMx.Lock()
+	defer w.historyMx.Unlock()
+
+	if bytes.Equal(newData, w.remoteData) {
+		return
+	}
+	// 被拒绝的数据不会生效也不会记录到历史, 保留最后一次有效的数据
+	if w.checkData(newData) != nil {
+		return
+	}
+	w.remoteData = newData
+	w.addHistory(newData)
+	if w.pinned > 0 {
+		log.Log.Warn("配置已被固定, 远程变更暂不生效",
+			zap.String("groupName", w.groupName),
+			zap.String("keyName", w.keyName),
+			zap.Int("pinnedVersion", w.pinned),
+			zap.Int("remoteVersion", w.version),
+		)
+		return
+	}
+	w.applyData(newData)
+}
+
+// 添加检查函数, 远程变更的数据需要所有检查函数都通过才会生效
+func (w *watchKeyObject) addChecker(fn func(oldData, newData []byte) error) {
+	w.watchMx.Lock()
+	defer w.watchMx.Unlock()
+	w.checkers = append(w.checkers, fn)
+}
+
+// 检查远程变更的数据
+func (w *watchKeyObject) checkData(newData []byte) error {
+	w.watchMx.Lock()
+	checkers := w.checkers
+	w.watchMx.Unlock()
+
+	oldData := w.getRawData()
+	for _, fn := range checkers {
+		if err := fn(oldData, newData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 应用数据并触发回调
+func (w *watchKeyObject) applyData(newData []byte) {
 	oldData := w.getRawData()
 	if bytes.Equal(newData, oldData) {
 		return
@@ -354,6 +413,7 @@ func newWatchKeyObject(groupName, keyName string, opts ...core.ConfigWatchOption
 		initOpts:  opts,
 	}
 	w.init()
+	registryWatchKeyObject(w)
 	return w
 }
 
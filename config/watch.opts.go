@@ -12,13 +12,25 @@ type StructType string
 const (
 	Json StructType = "json"
 	Yaml StructType = "yaml"
+	// 数据为 map[string]string 的json, key中的 . 会被解析为层级
+	Properties StructType = "properties"
+	// 文本, 只能解析为 *string 或 *[]byte
+	Txt StructType = "txt"
+	// json数据, 按 viper 解析配置的规则解析, 字段名不区分大小写, 支持 mapstructure 标签
+	MapStructure StructType = "mapstructure"
 )
 
 type watchOptions struct {
-	Provider   core.IConfigWatchProvider
-	StructType StructType
+	Provider      core.IConfigWatchProvider
+	StructType    StructType
+	Validate      func(obj interface{}) error // 校验结构化数据
+	ErrorCallback ConfigWatchErrorCallback    // 更新数据被拒绝时的回调
+	HistorySize   int                         // 保留的历史记录数
 }
 
+// 更新数据被拒绝时的回调, data为被拒绝的数据
+type ConfigWatchErrorCallback func(groupName, keyName string, data []byte, err error)
+
 func newWatchOptions(opts []core.ConfigWatchOption) *watchOptions {
 	o := &watchOptions{}
 	for _, fn := range opts {
@@ -86,3 +98,41 @@ func WithWatchStructYaml() core.ConfigWatchOption {
 		opts.StructType = Yaml
 	}
 }
+
+// 按顺序组合多个已注册的提供者作为分层提供者, 越靠前优先级越高, mergeType为空表示不合并
+func WithWatchLayers(mergeType StructType, layers ...string) core.ConfigWatchOption {
+	return func(a interface{}) {
+		opts := getWatchOptions(a)
+		opts.Provider = NewLayeredConfigWatchProvider(mergeType, layers...)
+	}
+}
+
+/*
+设置结构化数据的校验函数, 校验失败的更新会被拒绝并保留旧值
+
+	如果结构体实现了 Validate() error 方法, 会先调用该方法再调用校验函数
+*/
+func WithWatchValidate[T any](fn func(obj T) error) core.ConfigWatchOption {
+	return func(a interface{}) {
+		opts := getWatchOptions(a)
+		opts.Validate = func(obj interface{}) error {
+			return fn(obj.(T))
+		}
+	}
+}
+
+// 设置更新数据被拒绝时的回调, 首次获取数据失败时会直接fatal, 不会触发回调
+func WithWatchErrorCallback(fn ConfigWatchErrorCallback) core.ConfigWatchOption {
+	return func(a interface{}) {
+		opts := getWatchOptions(a)
+		opts.ErrorCallback = fn
+	}
+}
+
+// 设置保留的历史记录数, 默认为 DefaultWatchHistorySize
+func WithWatchHistorySize(size int) core.ConfigWatchOption {
+	return func(a interface{}) {
+		opts := getWatchOptions(a)
+		opts.HistorySize = size
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+/*
+解析properties数据
+
+	data 为 map[string]string 的json, 如 apollo 的 properties 类型命名空间
+	key中的 . 会被解析为层级, 值会按字段类型进行弱类型转换, 字段名不区分大小写, 可以使用 mapstructure 标签
+*/
+func parsePropertiesData(data []byte, outPtr interface{}) error {
+	var props map[string]string
+	if err := json.Unmarshal(data, &props); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // 保证冲突时的结果是确定的
+
+	tree := make(map[string]interface{}, len(props))
+	for _, k := range keys {
+		setPropertiesValue(tree, strings.Split(k, "."), props[k])
+	}
+
+	return decodeMapStructure(tree, outPtr)
+}
+
+/*
+解析json数据, 和 viper 解析配置的规则一致
+
+	字段名不区分大小写, 可以使用 mapstructure 标签, 值会按字段类型进行弱类型转换
+*/
+func parseMapStructureData(data []byte, outPtr interface{}) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return decodeMapStructure(v, outPtr)
+}
+
+// 使用和 viper 相同的规则解码
+func decodeMapStructure(input, outPtr interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           outPtr,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// 按层级设置值, 层级和已有的值冲突时保留已有的值
+func setPropertiesValue(tree map[string]interface{}, path []string, value string) {
+	for i, p := range path {
+		if i == len(path)-1 {
+			if _, ok := tree[p]; !ok {
+				tree[p] = value
+			}
+			return
+		}
+		sub, ok := tree[p].(map[string]interface{})
+		if !ok {
+			if _, exists := tree[p]; exists {
+				return
+			}
+			sub = make(map[string]interface{})
+			tree[p] = sub
+		}
+		tree = sub
+	}
+}
+
+// 解析文本数据, outPtr 必须是 *string 或 *[]byte
+func parseTxtData(data []byte, outPtr interface{}) error {
+	switch p := outPtr.(type) {
+	case *string:
+		*p = string(data)
+	case *[]byte:
+		*p = append((*p)[:0], data...)
+	default:
+		return fmt.Errorf("txt类型只能解析为 *string 或 *[]byte, 但收到的是 %v", reflect.TypeOf(outPtr))
+	}
+	return nil
+}
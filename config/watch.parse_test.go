@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePropertiesData(t *testing.T) {
+	type Sub struct {
+		Name    string
+		Timeout time.Duration
+	}
+	type Feature struct {
+		Enable bool
+		Limit  int
+		Ratio  float64
+		Tags   []string
+		Sub    Sub
+		Other  string `mapstructure:"other_name"`
+	}
+
+	data := []byte(`{"enable":"true","limit":"10","ratio":"0.5","tags":"a,b","sub.name":"x","sub.timeout":"3s","other_name":"y"}`)
+	var f Feature
+	require.NoError(t, parsePropertiesData(data, &f))
+	require.Equal(t, Feature{
+		Enable: true,
+		Limit:  10,
+		Ratio:  0.5,
+		Tags:   []string{"a", "b"},
+		Sub:    Sub{Name: "x", Timeout: time.Second * 3},
+		Other:  "y",
+	}, f)
+
+	err := parsePropertiesData([]byte(`{"limit":"abc"}`), &f)
+	require.Error(t, err)
+}
+
+func TestParseTxtData(t *testing.T) {
+	var s string
+	require.NoError(t, parseTxtData([]byte("hello"), &s))
+	require.Equal(t, "hello", s)
+
+	var bs []byte
+	require.NoError(t, parseTxtData([]byte("hello"), &bs))
+	require.Equal(t, []byte("hello"), bs)
+
+	var i int
+	require.Error(t, parseTxtData([]byte("hello"), &i))
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/log"
+)
+
+// 分层观察时重试观察失败的层的初始等待时间和最大等待时间
+var (
+	LayeredWatchRetryInterval    = time.Second * 5
+	LayeredWatchRetryMaxInterval = time.Minute
+)
+
+/*
+分层配置观察提供者
+
+	按顺序组合多个已注册的提供者, 越靠前优先级越高
+	获取时从第一个存在该key的提供者读取, 不存在时依次回退, 值为空视为不存在
+	如果设置了合并类型, 会将所有存在该key的层的json/yaml对象深度合并, 高优先级的层覆盖低优先级的层
+	观察时会观察所有存在该key的层, 任意一层变更时重新计算生效的值, 观察失败的层会在后台重试
+*/
+type layeredConfigWatchProvider struct {
+	layers    []string   // 提供者名
+	mergeType StructType // 合并类型, 为空表示不合并
+
+	keys map[string]*layeredKey
+	mx   sync.Mutex // 用于锁 keys
+}
+
+// 分层观察的key
+type layeredKey struct {
+	layerData [][]byte // 每一层的数据
+	value     []byte   // 生效的数据
+	callbacks []core.ConfigWatchProviderCallback
+}
+
+// 创建分层配置观察提供者, layers为已注册的提供者名, 越靠前优先级越高, mergeType为空表示不合并
+func NewLayeredConfigWatchProvider(mergeType StructType, layers ...string) core.IConfigWatchProvider {
+	if len(layers) == 0 {
+		log.Log.Fatal("分层配置观察提供者至少需要一层")
+	}
+	switch mergeType {
+	case "", Json, Yaml:
+	default:
+		log.Log.Fatal("不支持的分层合并类型", zap.String("mergeType", string(mergeType)))
+	}
+	return &layeredConfigWatchProvider{
+		layers:    layers,
+		mergeType: mergeType,
+		keys:      make(map[string]*layeredKey),
+	}
+}
+
+// 注册分层配置观察提供者
+func RegistryLayeredConfigWatchProvider(name string, mergeType StructType, layers ...string) {
+	RegistryConfigWatchProvider(name, NewLayeredConfigWatchProvider(mergeType, layers...))
+}
+
+// 获取层的提供者, 提供者在使用时才解析, 因为插件可能在之后才注册提供者
+func (l *layeredConfigWatchProvider) getLayer(i int) (core.IConfigWatchProvider, error) {
+	p := GetConfigWatchProvider(l.layers[i])
+	if p == nil {
+		return nil, fmt.Errorf("配置观察提供者<%s>不存在", l.layers[i])
+	}
+	return p, nil
+}
+
+func (l *layeredConfigWatchProvider) Get(groupName, keyName string) ([]byte, error) {
+	layerData, err := l.getLayersData(groupName, keyName)
+	if err != nil {
+		return nil, err
+	}
+	return l.compute(layerData)
+}
+
+// 获取所有层的数据
+func (l *layeredConfigWatchProvider) getLayersData(groupName, keyName string) ([][]byte, error) {
+	layerData := make([][]byte, len(l.layers))
+	var errs []string
+	for i := range l.layers {
+		p, err := l.getLayer(i)
+		if err != nil {
+			return nil, err
+		}
+		data, err := p.Get(groupName, keyName)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", l.layers[i], err))
+			continue
+		}
+		layerData[i] = data
+		if l.mergeType == "" && len(data) > 0 { // 不合并时找到第一个就够了
+			break
+		}
+	}
+	for _, data := range layerData {
+		if len(data) > 0 {
+			return layerData, nil
+		}
+	}
+	return nil, fmt.Errorf("所有层都不存在配置 groupName: %s, keyName: %s, errs: [%s]", groupName, keyName, strings.Join(errs, "; "))
+}
+
+// 计算生效的值
+func (l *layeredConfigWatchProvider) compute(layerData [][]byte) ([]byte, error) {
+	if l.mergeType == "" {
+		for _, data := range layerData {
+			if len(data) > 0 {
+				return data, nil
+			}
+		}
+		return nil, errors.New("所有层都不存在配置")
+	}
+
+	var result interface{}
+	for i := len(layerData) - 1; i >= 0; i-- { // 从低优先级开始合并
+		if len(layerData[i]) == 0 {
+			continue
+		}
+		var v interface{}
+		var err error
+		if l.mergeType == Yaml {
+			err = yaml.Unmarshal(layerData[i], &v)
+		} else {
+			err = json.Unmarshal(layerData[i], &v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析第%d层<%s>的数据失败: %v", i, l.layers[i], err)
+		}
+		result = mergeLayerValue(result, v)
+	}
+	if l.mergeType == Yaml {
+		return yaml.Marshal(result)
+	}
+	return json.Marshal(result)
+}
+
+// 深度合并, 只有两者都是对象时才合并, 否则high直接覆盖low
+func mergeLayerValue(low, high interface{}) interface{} {
+	lowMap, lowOk := toStringMap(low)
+	highMap, highOk := toStringMap(high)
+	if !lowOk || !highOk {
+		return high
+	}
+	out := make(map[string]interface{}, len(lowMap)+len(highMap))
+	for k, v := range lowMap {
+		out[k] = v
+	}
+	for k, v := range highMap {
+		out[k] = mergeLayerValue(out[k], v)
+	}
+	return out
+}
+
+func (l *layeredConfigWatchProvider) Watch(groupName, keyName string, callback core.ConfigWatchProviderCallback) error {
+	key := groupName + "/" + keyName
+
+	l.mx.Lock()
+	if k, ok := l.keys[key]; ok {
+		k.callbacks = append(k.callbacks, callback)
+		l.mx.Unlock()
+		return nil
+	}
+	l.mx.Unlock()
+
+	// 观察需要所有层的数据
+	layerData := make([][]byte, len(l.layers))
+	for i := range l.layers {
+		p, err := l.getLayer(i)
+		if err != nil {
+			return err
+		}
+		layerData[i], _ = p.Get(groupName, keyName)
+	}
+	value, err := l.compute(layerData)
+	if err != nil {
+		return fmt.Errorf("计算配置失败 groupName: %s, keyName: %s, err: %v", groupName, keyName, err)
+	}
+
+	l.mx.Lock()
+	if k, ok := l.keys[key]; ok { // 并发添加
+		k.callbacks = append(k.callbacks, callback)
+		l.mx.Unlock()
+		return nil
+	}
+	k := &layeredKey{
+		layerData: layerData,
+		value:     value,
+		callbacks: []core.ConfigWatchProviderCallback{callback},
+	}
+	l.keys[key] = k
+	l.mx.Unlock()
+
+	// 观察所有层
+	layers := make([]int, len(l.layers))
+	for i := range layers {
+		layers[i] = i
+	}
+	failed := l.watchLayers(k, groupName, keyName, layers, false)
+	if len(failed) == len(l.layers) {
+		l.mx.Lock()
+		if l.keys[key] == k { // 移除, 使之后的观察可以重试
+			delete(l.keys, key)
+		}
+		l.mx.Unlock()
+		return fmt.Errorf("所有层都无法观察 groupName: %s, keyName: %s", groupName, keyName)
+	}
+	if len(failed) > 0 {
+		go l.retryWatch(k, groupName, keyName, failed)
+	}
+	return nil
+}
+
+// 观察指定的层, 返回观察失败的层
+func (l *layeredConfigWatchProvider) watchLayers(k *layeredKey, groupName, keyName string, layers []int, isRetry bool) []int {
+	var failed []int
+	for _, i := range layers {
+		p, err := l.getLayer(i)
+		if err == nil {
+			layer := i
+			err = p.Watch(groupName, keyName, func(groupName, keyName string, _, newData []byte) {
+				l.onLayerChanged(k, layer, groupName, keyName, newData)
+			})
+		}
+		if err != nil {
+			if !isRetry {
+				log.Log.Warn("分层配置观察提供者无法观察该层, 稍后重试",
+					zap.String("layer", l.layers[i]),
+					zap.String("groupName", groupName),
+					zap.String("keyName", keyName),
+					zap.Error(err))
+			}
+			failed = append(failed, i)
+			continue
+		}
+		if isRetry {
+			log.Log.Info("分层配置观察提供者重试观察该层成功",
+				zap.String("layer", l.layers[i]),
+				zap.String("groupName", groupName),
+				zap.String("keyName", keyName))
+			// 观察失败期间该层可能添加了数据
+			if data, err := p.Get(groupName, keyName); err == nil {
+				l.onLayerChanged(k, i, groupName, keyName, data)
+			}
+		}
+	}
+	return failed
+}
+
+// 重试观察失败的层, 如该层在之后才添加该key, 失败后等待时间翻倍, 所有层都观察成功后退出
+func (l *layeredConfigWatchProvider) retryWatch(k *layeredKey, groupName, keyName string, failed []int) {
+	interval := LayeredWatchRetryInterval
+	for len(failed) > 0 {
+		time.Sleep(interval)
+		failed = l.watchLayers(k, groupName, keyName, failed, true)
+		interval *= 2
+		if interval > LayeredWatchRetryMaxInterval {
+			interval = LayeredWatchRetryMaxInterval
+		}
+	}
+}
+
+// 某一层数据变更
+func (l *layeredConfigWatchProvider) onLayerChanged(k *layeredKey, layer int, groupName, keyName string, newData []byte) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	layerData := make([][]byte, len(k.layerData))
+	copy(layerData, k.layerData)
+	layerData[layer] = newData
+	value, err := l.compute(layerData)
+	if err != nil {
+		log.Log.Error("分层配置重新计算失败, 保持旧值",
+			zap.String("layer", l.layers[layer]),
+			zap.String("groupName", groupName),
+			zap.String("keyName", keyName),
+			zap.Error(err))
+		return
+	}
+	k.layerData = layerData
+
+	oldValue := k.value
+	if bytes.Equal(oldValue, value) {
+		return
+	}
+	k.value = value
+	for _, fn := range k.callbacks {
+		go fn(groupName, keyName, oldValue, value)
+	}
+}
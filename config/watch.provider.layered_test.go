@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/core"
+)
+
+// 可以手动触发变更的测试提供者
+type manualWatchProvider struct {
+	data      map[string][]byte
+	callbacks map[string][]core.ConfigWatchProviderCallback
+	mx        sync.Mutex
+}
+
+func newManualWatchProvider() *manualWatchProvider {
+	return &manualWatchProvider{
+		data:      make(map[string][]byte),
+		callbacks: make(map[string][]core.ConfigWatchProviderCallback),
+	}
+}
+
+func (m *manualWatchProvider) Get(groupName, keyName string) ([]byte, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	data, ok := m.data[groupName+"/"+keyName]
+	if !ok {
+		return nil, fmt.Errorf("not found key: %s.%s", groupName, keyName)
+	}
+	return data, nil
+}
+
+func (m *manualWatchProvider) Watch(groupName, keyName string, callback core.ConfigWatchProviderCallback) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	key := groupName + "/" + keyName
+	m.callbacks[key] = append(m.callbacks[key], callback)
+	return nil
+}
+
+func (m *manualWatchProvider) Set(groupName, keyName string, data []byte) {
+	m.mx.Lock()
+	key := groupName + "/" + keyName
+	oldData := m.data[key]
+	m.data[key] = data
+	callbacks := m.callbacks[key]
+	m.mx.Unlock()
+	for _, fn := range callbacks {
+		fn(groupName, keyName, oldData, data)
+	}
+}
+
+// 可以让观察失败的测试提供者
+type failWatchProvider struct {
+	*manualWatchProvider
+	fail atomic.Bool
+}
+
+func newFailWatchProvider() *failWatchProvider {
+	f := &failWatchProvider{manualWatchProvider: newManualWatchProvider()}
+	f.fail.Store(true)
+	return f
+}
+
+func (f *failWatchProvider) Watch(groupName, keyName string, callback core.ConfigWatchProviderCallback) error {
+	if f.fail.Load() {
+		return fmt.Errorf("watch failed: %s.%s", groupName, keyName)
+	}
+	return f.manualWatchProvider.Watch(groupName, keyName, callback)
+}
+
+var layerHighTestProvider = newManualWatchProvider()
+var layerLowTestProvider = newManualWatchProvider()
+
+func init() {
+	RegistryConfigWatchProvider("layer_high", layerHighTestProvider)
+	RegistryConfigWatchProvider("layer_low", layerLowTestProvider)
+	RegistryLayeredConfigWatchProvider("layered_json", Json, "layer_high", "layer_low")
+}
+
+func TestLayeredWatchProvider(t *testing.T) {
+	high, low := layerHighTestProvider, layerLowTestProvider
+
+	low.Set("g", "only_low", []byte("low"))
+	low.Set("g", "both", []byte("low"))
+	high.Set("g", "both", []byte("high"))
+
+	// 回退
+	p := NewLayeredConfigWatchProvider("", "layer_high", "layer_low")
+	data, err := p.Get("g", "only_low")
+	require.NoError(t, err)
+	require.Equal(t, "low", string(data))
+	data, err = p.Get("g", "both")
+	require.NoError(t, err)
+	require.Equal(t, "high", string(data))
+	_, err = p.Get("g", "not_found")
+	require.Error(t, err)
+
+	// 合并
+	low.Set("g", "obj", []byte(`{"a":1,"b":{"c":2,"d":3}}`))
+	high.Set("g", "obj", []byte(`{"b":{"d":4},"e":5}`))
+	p = GetConfigWatchProvider("layered_json")
+	data, err = p.Get("g", "obj")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"a":1,"b":{"c":2,"d":4},"e":5}`, string(data))
+
+	// 观察所有层
+	ch := make(chan string, 10)
+	err = p.Watch("g", "obj", func(_, _ string, _, newData []byte) {
+		ch <- string(newData)
+	})
+	require.NoError(t, err)
+
+	wait := func() map[string]interface{} {
+		select {
+		case s := <-ch:
+			var v map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(s), &v))
+			return v
+		case <-time.After(time.Second):
+			t.Fatal("等待配置变更超时")
+		}
+		return nil
+	}
+
+	low.Set("g", "obj", []byte(`{"a":10,"b":{"c":2,"d":3}}`))
+	require.Equal(t, float64(10), wait()["a"])
+	high.Set("g", "obj", []byte(`{"b":{"d":40}}`))
+	v := wait()
+	require.Equal(t, float64(40), v["b"].(map[string]interface{})["d"])
+	require.Nil(t, v["e"])
+
+	// 解析失败时保持旧值, 低优先级的层被覆盖的字段变化不会触发回调
+	low.Set("g", "obj", []byte(`{`))
+	low.Set("g", "obj", []byte(`{"a":10,"b":{"c":2,"d":30}}`))
+	select {
+	case s := <-ch:
+		t.Fatalf("不应该收到变更: %s", s)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	// 通过选项使用分层提供者
+	keyObj := newWatchKeyObject("g", "both", WithWatchLayers("", "layer_high", "layer_low"))
+	require.Equal(t, "high", keyObj.GetString())
+	high.Set("g", "both", []byte(""))
+	time.Sleep(time.Millisecond * 50)
+	require.Equal(t, "low", keyObj.GetString())
+}
+
+func TestLayeredWatchProviderWatchFailed(t *testing.T) {
+	f := newFailWatchProvider()
+	RegistryConfigWatchProvider("layer_fail", f)
+	t.Cleanup(func() { delete(configWatchProviders, "layer_fail") })
+	f.Set("g", "key", []byte("v1"))
+
+	p := NewLayeredConfigWatchProvider("", "layer_fail")
+	ch := make(chan string, 10)
+	callback := func(_, _ string, _, newData []byte) { ch <- string(newData) }
+	require.Error(t, p.Watch("g", "key", callback))
+
+	// 所有层都观察失败后可以重试
+	f.fail.Store(false)
+	require.NoError(t, p.Watch("g", "key", callback))
+	f.Set("g", "key", []byte("v2"))
+	select {
+	case s := <-ch:
+		require.Equal(t, "v2", s)
+	case <-time.After(time.Second):
+		t.Fatal("等待配置变更超时")
+	}
+}
+
+func TestLayeredWatchProviderRetry(t *testing.T) {
+	oldInterval := LayeredWatchRetryInterval
+	LayeredWatchRetryInterval = time.Millisecond * 10
+	t.Cleanup(func() { LayeredWatchRetryInterval = oldInterval })
+
+	high := newFailWatchProvider()
+	RegistryConfigWatchProvider("layer_retry_high", high)
+	t.Cleanup(func() { delete(configWatchProviders, "layer_retry_high") })
+	low := registryTestWatchProvider(t, "layer_retry_low")
+	low.Set("g", "key", []byte("low"))
+
+	p := NewLayeredConfigWatchProvider("", "layer_retry_high", "layer_retry_low")
+	ch := make(chan string, 10)
+	require.NoError(t, p.Watch("g", "key", func(_, _ string, _, newData []byte) { ch <- string(newData) }))
+
+	// 高优先级的层之后才添加该key, 重试观察成功后生效
+	high.Set("g", "key", []byte("high"))
+	high.fail.Store(false)
+	select {
+	case s := <-ch:
+		require.Equal(t, "high", s)
+	case <-time.After(time.Second):
+		t.Fatal("等待配置变更超时")
+	}
+
+	high.Set("g", "key", []byte("high2"))
+	select {
+	case s := <-ch:
+		require.Equal(t, "high2", s)
+	case <-time.After(time.Second):
+		t.Fatal("等待配置变更超时")
+	}
+}
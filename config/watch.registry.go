@@ -0,0 +1,26 @@
+package config
+
+import (
+	"sync"
+)
+
+// 已创建的观察key对象
+var watchKeyObjects = struct {
+	objs []*watchKeyObject
+	mx   sync.RWMutex
+}{}
+
+func registryWatchKeyObject(w *watchKeyObject) {
+	watchKeyObjects.mx.Lock()
+	watchKeyObjects.objs = append(watchKeyObjects.objs, w)
+	watchKeyObjects.mx.Unlock()
+}
+
+// 获取所有已创建的观察key对象
+func getWatchKeyObjects() []*watchKeyObject {
+	watchKeyObjects.mx.RLock()
+	defer watchKeyObjects.mx.RUnlock()
+	objs := make([]*watchKeyObject, len(watchKeyObjects.objs))
+	copy(objs, watchKeyObjects.objs)
+	return objs
+}
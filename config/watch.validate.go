@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+// 结构化数据校验器, 观察的结构体或其字段实现了该接口时, 校验失败的更新会被拒绝并保留旧值
+type WatchValidator interface {
+	Validate() error
+}
+
+// 校验对象, 会递归校验导出字段以及切片和map中的元素
+func validateObject(obj interface{}) error {
+	return validateValue(reflect.ValueOf(obj), "", false, make(map[uintptr]struct{}))
+}
+
+// 校验值, checked 表示已经通过指针或接口校验过自身
+func validateValue(v reflect.Value, path string, checked bool, visited map[uintptr]struct{}) error {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.Kind() == reflect.Ptr {
+		if _, ok := visited[v.Pointer()]; ok {
+			return nil
+		}
+		visited[v.Pointer()] = struct{}{}
+	}
+
+	if !checked && v.CanInterface() {
+		validator, ok := v.Interface().(WatchValidator)
+		if !ok && v.CanAddr() {
+			validator, ok = v.Addr().Interface().(WatchValidator)
+		}
+		if ok {
+			if err := validator.Validate(); err != nil {
+				if path == "" {
+					return err
+				}
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return validateValue(v.Elem(), path, true, visited)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath != "" { // 未导出
+				continue
+			}
+			if err := validateValue(v.Field(i), joinValidatePath(path, t.Field(i).Name), false, visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), false, visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), false, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinValidatePath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+const metricsConfigWatchRejectedTotal = "config_watch_rejected_total" // 配置更新被拒绝计数器
+
+// 拒绝原因
+const (
+	watchRejectReasonParse    = "parse"
+	watchRejectReasonValidate = "validate"
+)
+
+// 更新数据被拒绝的错误
+type watchRejectError struct {
+	reason string
+	err    error
+}
+
+func (e *watchRejectError) Error() string { return e.err.Error() }
+func (e *watchRejectError) Unwrap() error { return e.err }
+
+// 配置更新被拒绝计数器, 观察配置时指标插件可能还未设置默认client, 所以使用跟随默认client的计数器
+var watchRejectedCounter = metrics.NewLazyCounter(metricsConfigWatchRejectedTotal, "配置更新被拒绝计数器", nil, "group", "key", "reason")
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type validateConfig struct {
+	Port int
+	Name string
+}
+
+func (v *validateConfig) Validate() error {
+	if v.Port <= 0 {
+		return errors.New("port必须大于0")
+	}
+	return nil
+}
+
+var validateTestProvider = newManualWatchProvider()
+
+func init() {
+	RegistryConfigWatchProvider("validate_test", validateTestProvider)
+}
+
+func TestWatchValidate(t *testing.T) {
+	p := validateTestProvider
+	p.Set("g", "k", []byte(`{"Port":80,"Name":"a"}`))
+
+	errCh := make(chan error, 10)
+	w := WatchJson[*validateConfig]("g", "k",
+		WithWatchProvider("validate_test"),
+		WithWatchValidate(func(obj *validateConfig) error {
+			if obj.Name == "" {
+				return errors.New("name不能为空")
+			}
+			return nil
+		}),
+		WithWatchErrorCallback(func(groupName, keyName string, data []byte, err error) {
+			errCh <- err
+		}),
+	)
+	require.Equal(t, 80, w.Get().Port)
+
+	waitErr := func() error {
+		select {
+		case err := <-errCh:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("等待错误回调超时")
+		}
+		return nil
+	}
+
+	// 解析失败
+	p.Set("g", "k", []byte(`{"Port":`))
+	require.Error(t, waitErr())
+	require.Equal(t, 80, w.Get().Port)
+
+	// Validate 方法校验失败
+	p.Set("g", "k", []byte(`{"Port":0,"Name":"a"}`))
+	require.Contains(t, waitErr().Error(), "port")
+	require.Equal(t, 80, w.Get().Port)
+	require.Equal(t, `{"Port":80,"Name":"a"}`, string(w.GetData()))
+
+	// 被拒绝的数据不会发布到观察key对象, 也不会记录到历史
+	keyObj := w.(*watchKeyGeneric[*validateConfig]).keyObject
+	require.Equal(t, `{"Port":80,"Name":"a"}`, keyObj.GetString())
+	require.Len(t, keyObj.History(), 1)
+
+	// 校验函数校验失败
+	p.Set("g", "k", []byte(`{"Port":81}`))
+	require.Contains(t, waitErr().Error(), "name")
+	require.Equal(t, 80, w.Get().Port)
+
+	// 正常更新
+	p.Set("g", "k", []byte(`{"Port":82,"Name":"b"}`))
+	time.Sleep(time.Millisecond * 50)
+	require.Equal(t, 82, w.Get().Port)
+	require.Equal(t, "b", w.Get().Name)
+	require.Equal(t, `{"Port":82,"Name":"b"}`, keyObj.GetString())
+	require.Len(t, keyObj.History(), 2)
+}
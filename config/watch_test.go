@@ -422,3 +422,24 @@ func TestGenericWatchYaml(t *testing.T) {
 	require.Equal(t, expectNewData, keyObj.Get().A)
 	require.Equal(t, rawData, keyObj.GetData())
 }
+
+// 测试期间使用空的观察key对象列表, 结束后恢复, 避免受其它测试创建的观察key影响
+func isolateWatchKeyObjects(t *testing.T) {
+	watchKeyObjects.mx.Lock()
+	old := watchKeyObjects.objs
+	watchKeyObjects.objs = nil
+	watchKeyObjects.mx.Unlock()
+	t.Cleanup(func() {
+		watchKeyObjects.mx.Lock()
+		watchKeyObjects.objs = old
+		watchKeyObjects.mx.Unlock()
+	})
+}
+
+// 注册测试期间使用的提供者, 结束后注销, 使测试可以重复运行
+func registryTestWatchProvider(t *testing.T, name string) *manualWatchProvider {
+	p := newManualWatchProvider()
+	RegistryConfigWatchProvider(name, p)
+	t.Cleanup(func() { delete(configWatchProviders, name) })
+	return p
+}
@@ -16,6 +16,8 @@ const (
 	DefaultWaitServiceRunTime int = 1000
 	// 默认服务不稳定观察时间, 等待时间(毫秒)
 	DefaultServiceUnstableObserveTime int = 10000
+	// 默认检查配置文件是否变更的间隔时间(毫秒)
+	DefaultConfigReloadInterval int = 5000
 )
 
 // 配置
@@ -28,6 +30,10 @@ const (
 	ApolloConfigClusterFromEnvKey = "ApolloCluster"
 	// 包含配置文件key
 	IncludeConfigFileKey = "include"
+	// 打印配置时默认脱敏的key, 多个key用英文逗号隔开
+	DefaultConfigMaskKeys = "*password*,*passwd*,*secret*,*token*,*accesskey*,*credential*,*authorization*"
+	// 脱敏后显示的值
+	ConfigMaskValue = "******"
 )
 
 // 默认组件名
@@ -101,8 +101,26 @@ type FrameConfig struct {
 	Labels map[string]string
 	// log配置
 	Log LogConfig
+	// 内存管理配置
+	Memory MemoryConfig
 	// app初始时是否打印配置
 	PrintConfig bool
+	// 打印配置时需要脱敏的key, 支持通配符*和?, 忽略大小写, 会和默认的脱敏key合并
+	PrintConfigMaskKeys []string
+	// 绑定配置段后检查配置文件是否变更的间隔时间(毫秒), <= 0 时使用默认值
+	ConfigReloadInterval int
+}
+
+// 内存管理配置
+type MemoryConfig struct {
+	Enable                bool    // 启用内存管理, 启用后不再按 FreeMemoryInterval 定期释放内存
+	MemoryLimitRatio      float64 // 将 GOMEMLIMIT 设为 cgroup 内存限制的比例, 默认 0.9, 已通过环境变量设置 GOMEMLIMIT 或没有 cgroup 内存限制时不设置
+	DisableDynamicGOGC    bool    // 禁用根据堆内存占内存限制的比例动态调整 GOGC, 已通过环境变量设置 GOGC 时不会动态调整
+	MinGOGC               int     // 动态调整 GOGC 的最小值, 默认 25
+	MaxGOGC               int     // 动态调整 GOGC 的最大值, 默认 200
+	FreeMemoryWatermark   float64 // 常驻内存占内存限制的比例达到该值时释放内存, 默认 0.8, 小于0表示不释放
+	FreeMemoryMinInterval int     // 两次释放内存的最小间隔时间(毫秒), 默认 60000
+	CheckInterval         int     // 检查间隔时间(毫秒), 默认 5000
 }
 
 type LogConfig struct {
@@ -118,6 +136,10 @@ type LogConfig struct {
 	FileMaxBackupsNum          int    // 日志文件最多保存多少个备份, 0表示永久
 	FileMaxDurableTime         int    // 文件最多保存多长时间,单位天, 0表示永久
 	Compress                   bool   // 是否压缩历史日志
+	CompressType               string // 历史日志的压缩方式, gzip, zstd, 默认 gzip
+	FileRotateTime             string // 按时间轮转日志文件, hourly: 每小时整点, daily: 每天零点, 为空表示只按大小轮转
+	FileNamePattern            string // 日志文件名模板, 如 app-%Y%m%d%H.log, 支持 %Y %m %d %H %M %S, 设置后忽略 Name 和 AppendPid 且不会重命名日志文件
+	FileMaxTotalSize           int    // 所有历史日志的总大小上限,单位M, 超过时删除最旧的日志, 0表示不限制
 	TimeFormat                 string // 时间显示格式
 	Color                      bool   // 是否打印彩色日志等级, 只有关闭json编码器才生效
 	CapitalLevel               bool   // 是否大写日志等级
@@ -125,6 +147,59 @@ type LogConfig struct {
 	ShowFileAndLinenumMinLevel string // 最小显示文件路径和行号的等级, 空表示不显示. 推荐所有等级都打印代码行, 相对于能快速定位问题来说, 这点性能损耗无关紧要
 	ShowStacktraceLevel        string // 显示调用链的等级, 空表示不显示, 推荐error以上才打印调用链. debug, info, warn, error, dpanic, panic, fatal
 	MillisDuration             bool   // 对zap.Duration转为毫秒
+
+	Async               bool   // 异步写入, 日志先写入环形缓冲区, 由后台协程批量写入屏幕和文件, error以上等级的日志会立即写入
+	AsyncBufferSize     int    // 异步写入的缓冲区大小(日志条数), 默认 10000
+	AsyncBatchSize      int    // 异步写入每批的最大条数, 默认 100
+	AsyncFlushInterval  int    // 异步写入的间隔时间(毫秒), 默认 200
+	AsyncOverflowPolicy string // 缓冲区满时的策略, block: 阻塞等待(默认), drop_oldest: 丢弃最旧的日志, drop_low_level: 优先丢弃debug和info日志
+
+	SampleInitial        int // 采样, 每个周期内相同等级和消息的日志前 N 条全部输出, 0 表示不采样
+	SampleThereafter     int // 采样, 超过 SampleInitial 后每 M 条输出一条, 0 表示全部丢弃
+	SampleTick           int // 采样周期(毫秒), 默认 1000
+	RepeatCollapseWindow int // 重复日志折叠窗口(毫秒), 窗口内相同等级和消息的日志只输出第一条, 窗口结束后输出一条 "消息 (repeated N times)" 的日志, 0 表示不折叠
+
+	ModuleLevels    map[string]string // 模块日志等级, 通过 NewSessionLogger(zlog.WithModule("模块名")) 创建的logger使用模块的日志等级, 未设置的模块使用 Level
+	WatchLevelGroup string            // 观察日志等级的组名, 和 WatchLevelKey 都不为空时生效
+	WatchLevelKey   string            // 观察日志等级的key名, 数据为 yaml 或 json, 如 {"level":"info","traceLevel":"warn","modules":{"redis":"debug"}}
+
+	RedactKeys   []string // 需要脱敏的字段名或路径, 不区分大小写, 支持通配符, 如 password, *.idCard, card_no
+	RedactValues []string // 需要脱敏的值的正则, 匹配的部分会被替换, 如手机号 1[3-9]\d{9}
+	RedactMask   string   // 脱敏后的值, 默认 ***
+
+	Sinks []LogSinkConfig // 额外的日志输出目标, 每个目标异步批量发送, 不会阻塞程序
+
+	Routes []LogRouteConfig // 日志文件路由, 按等级或模块将日志写入单独的文件, 不受 WriteToFile 影响
+}
+
+// 日志文件路由配置, 文件配置为0或空时使用 Log 的配置
+type LogRouteConfig struct {
+	Name               string   // 日志文件名, 末尾会自动附加 .log 后缀, 如 error, access
+	Level              string   // 最低日志等级, 默认为 debug
+	Modules            []string // 匹配的模块, 即 zlog.WithModule 设置的 module 字段, 支持通配符*和?, 为空表示匹配所有日志
+	Exclusive          bool     // 独占, 匹配的日志不再写入默认日志文件, 仍会输出到屏幕
+	FileMaxSize        int      // 每个日志最大尺寸,单位M
+	FileMaxBackupsNum  int      // 日志文件最多保存多少个备份
+	FileMaxDurableTime int      // 文件最多保存多长时间,单位天
+	FileRotateTime     string   // 按时间轮转日志文件, hourly, daily
+	FileNamePattern    string   // 日志文件名模板, 如 error-%Y%m%d%H.log
+	FileMaxTotalSize   int      // 所有历史日志的总大小上限,单位M
+	CompressType       string   // 历史日志的压缩方式, gzip, zstd, 是否压缩由 Log.Compress 决定
+}
+
+// 日志输出目标配置
+type LogSinkConfig struct {
+	Type          string            // 类型, 内置 syslog, http, 也可以是通过 zlog.RegistrySink 注册的类型
+	Level         string            // 最低日志等级, 默认为 info, 低于 Log.Level 时无效
+	Encoder       string            // 编码器, json, console, 默认 json
+	QueueSize     int               // 缓冲队列大小, 默认 10000, 队列满时会丢弃日志
+	BatchSize     int               // 批量发送的最大条数, 默认 100
+	FlushInterval int               // 批量发送的间隔时间(毫秒), 默认 1000
+	Address       string            // 地址, syslog 为 unix socket 路径(默认 /dev/log), http 为接收日志的url
+	Tag           string            // syslog 的 tag, 默认为 app 名
+	Timeout       int               // 发送超时时间(毫秒), 默认 3000
+	Headers       map[string]string // http 请求头
+	Extend        map[string]string // 自定义类型的扩展配置
 }
 
 // 服务配置
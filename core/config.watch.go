@@ -1,5 +1,9 @@
 package core
 
+import (
+	"time"
+)
+
 // 配置观察选项
 type ConfigWatchOption func(opts interface{})
 
@@ -41,6 +45,28 @@ type IConfigWatchKeyObject interface {
 	ParseYaml(outPtr interface{}) error
 }
 
+// 配置观察key对象可选实现, 用于查看历史记录和手动回滚
+type IConfigWatchKeyHistory interface {
+	// 获取历史记录, 按版本从旧到新排列
+	History() []*ConfigWatchKeyHistory
+	// 对比两个版本的数据, 返回逐行的差异
+	Diff(oldVersion, newVersion int) (string, error)
+	// 将数据固定在某个历史版本, 固定期间远程的变更只会记录到历史中而不会生效, 直到调用 Unpin
+	Pin(version int) error
+	// 取消固定, 恢复为远程最新的数据
+	Unpin()
+	// 获取当前固定的版本, 0表示未固定
+	PinnedVersion() int
+}
+
+// 配置观察key的历史记录
+type ConfigWatchKeyHistory struct {
+	Version  int       // 本地版本号, 从1开始递增
+	Data     []byte    // 数据
+	Time     time.Time // 收到数据的时间
+	Revision string    // 提供者的版本号, 提供者未实现 IConfigWatchProviderRevision 时为空
+}
+
 // 配置观察key对象回调, 如果是第一次触发, isInit 为 true
 type ConfigWatchKeyCallback func(isInit bool, oldData, newData []byte)
 
@@ -71,3 +97,9 @@ type IConfigWatchProvider interface {
 
 // 配置观察提供者回调
 type ConfigWatchProviderCallback func(groupName, keyName string, oldData, newData []byte)
+
+// 配置观察提供者可选实现, 用于获取key当前的版本号
+type IConfigWatchProviderRevision interface {
+	// 获取key当前的版本号
+	GetRevision(groupName, keyName string) string
+}
@@ -2,7 +2,11 @@ package filter
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bytedance/sonic"
 	"go.uber.org/zap"
@@ -16,13 +20,18 @@ import (
 
 const defLogLevel = "debug"
 
+// 日志的模块名, 配置了 Log.Routes 时会附加到请求日志中, 可以通过路由将请求日志写入单独的文件
+const logFilterModule = "base.log"
+
 func init() {
 	RegisterFilterCreator("base.log", newLogFilter, newLogFilter)
 }
 
 var defLogFilter core.Filter = &logFilter{
-	Client:  make(map[string]map[string]string),
-	Service: make(map[string]string),
+	Client:         make(map[string]map[string]string),
+	Service:        make(map[string]string),
+	ClientOptions:  make(map[string]map[string]*logOptions),
+	ServiceOptions: make(map[string]*logOptions),
 }
 
 func newLogFilter() core.Filter {
@@ -32,6 +41,105 @@ func newLogFilter() core.Filter {
 type logFilter struct {
 	Client  map[string]map[string]string
 	Service map[string]string
+
+	ClientOptions  map[string]map[string]*logOptions // 客户端日志选项, 客户端类型 -> 客户端名 -> 选项, 查找方式和 Client 一致
+	ServiceOptions map[string]*logOptions            // 服务日志选项, 服务名 -> 选项, 查找方式和 Service 一致
+
+	RedactKeys   []string // 需要脱敏的字段名或路径, 会和 Frame.Log.RedactKeys 合并
+	RedactValues []string // 需要脱敏的值的正则, 会和 Frame.Log.RedactValues 合并
+	RedactMask   string   // 脱敏后的值, 默认使用 Frame.Log.RedactMask
+
+	redactor *zlog.Redactor
+	routed   bool // 是否配置了日志路由, 配置后请求日志会带上模块字段
+}
+
+// 日志选项
+type logOptions struct {
+	MaxBodyLen        int      // req/rsp 序列化后的最大长度, 超出部分会被截断, 0 表示不限制
+	OnlyError         bool     // 只在出错时记录日志
+	SlowThreshold     int      // 慢调用阈值(毫秒), 大于0时成功的调用只有耗时达到阈值才记录日志
+	SuccessSampleRate float64  // 成功调用的采样率, 取值 (0, 1), 0 或 >=1 表示全部记录
+	ExcludeMethods    []string // 不记录日志的方法, 支持通配符
+}
+
+var defLogOptions = &logOptions{}
+
+// 是否需要在调用结束后才决定是否记录日志
+func (o *logOptions) isDeferred() bool {
+	return o.OnlyError || o.SlowThreshold > 0 || (o.SuccessSampleRate > 0 && o.SuccessSampleRate < 1)
+}
+
+// 检查方法是否被排除
+func (o *logOptions) isExcluded(method string) bool {
+	return len(o.ExcludeMethods) > 0 && utils.Text.IsMatchWildcardAny(method, o.ExcludeMethods...)
+}
+
+// 检查成功的调用是否需要记录日志
+func (o *logOptions) shouldLogSuccess(duration time.Duration) bool {
+	if o.OnlyError {
+		return false
+	}
+	if o.SlowThreshold > 0 && duration < time.Duration(o.SlowThreshold)*time.Millisecond {
+		return false
+	}
+	if o.SuccessSampleRate > 0 && o.SuccessSampleRate < 1 && rand.Float64() >= o.SuccessSampleRate {
+		return false
+	}
+	return true
+}
+
+// 截断数据
+func (o *logOptions) truncate(s string) string {
+	if o.MaxBodyLen <= 0 || len(s) <= o.MaxBodyLen {
+		return s
+	}
+	cut := o.MaxBodyLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) { // 避免截断多字节字符
+		cut--
+	}
+	return s[:cut] + "...(truncated, total " + strconv.Itoa(len(s)) + " bytes)"
+}
+
+func (t *logFilter) getClientOptions(clientType, clientName string) *logOptions {
+	ct, ok := t.ClientOptions[clientType]
+	if ok {
+		o, ok := ct[clientName]
+		if ok && o != nil {
+			return o
+		}
+		o, ok = ct[defName] // 默认客户端组件
+		if ok && o != nil {
+			return o
+		}
+	}
+
+	ct, ok = t.ClientOptions[defName]
+	if ok {
+		o, ok := ct[defName]
+		if ok && o != nil {
+			return o
+		}
+	}
+	return defLogOptions
+}
+func (t *logFilter) getServiceOptions(serviceName string) *logOptions {
+	o, ok := t.ServiceOptions[serviceName]
+	if ok && o != nil {
+		return o
+	}
+	o, ok = t.ServiceOptions[defName]
+	if ok && o != nil {
+		return o
+	}
+	return defLogOptions
+}
+func (t *logFilter) getOptions(meta CallMeta) *logOptions {
+	if meta.IsClientMeta() {
+		return t.getClientOptions(meta.ClientType(), meta.ClientName())
+	} else if meta.IsServiceMeta() {
+		return t.getServiceOptions(meta.ServiceName())
+	}
+	return defLogOptions
 }
 
 func (t *logFilter) getMethodName(meta CallMeta) string {
@@ -41,9 +149,9 @@ func (t *logFilter) getMethodName(meta CallMeta) string {
 	return "主 " + meta.CalleeService() + " " + meta.CalleeMethod()
 }
 
-func (t *logFilter) marshal(a any) string {
+func (t *logFilter) marshal(a any, opts *logOptions) string {
 	s, _ := sonic.MarshalString(a)
-	return s
+	return opts.truncate(t.redactor.RedactJSON(s))
 }
 
 func (*logFilter) Name() string { return "base.log" }
@@ -52,6 +160,18 @@ func (t *logFilter) Init(app core.IApp) error {
 	if err != nil {
 		return err
 	}
+
+	logConf := config.Conf.Config().Frame.Log
+	t.routed = len(logConf.Routes) > 0
+	mask := t.RedactMask
+	if mask == "" {
+		mask = logConf.RedactMask
+	}
+	t.redactor, err = zlog.NewRedactor(append(append([]string{}, logConf.RedactKeys...), t.RedactKeys...),
+		append(append([]string{}, logConf.RedactValues...), t.RedactValues...), mask)
+	if err != nil {
+		return fmt.Errorf("base.log 创建脱敏器失败: %v", err)
+	}
 	return nil
 }
 
@@ -99,9 +219,7 @@ func (t *logFilter) getLevel(ctx context.Context) string {
 	return l
 }
 
-func (t *logFilter) start(ctx context.Context, req interface{}) (context.Context, CallMeta) {
-	meta := GetCallMeta(ctx)
-
+func (t *logFilter) start(ctx context.Context, meta CallMeta, opts *logOptions, req interface{}) {
 	eventName := " Send"
 	if meta.IsServiceMeta() {
 		eventName = " Recv"
@@ -117,19 +235,33 @@ func (t *logFilter) start(ctx context.Context, req interface{}) (context.Context
 		zap.String("callerMethod", meta.CallerMethod()),
 		zap.String("calleeService", meta.CalleeService()),
 		zap.String("calleeMethod", meta.CalleeMethod()),
-		ctx, t.getMethodName(meta) + eventName, zap.String("data", t.marshal(req)),
+		ctx, t.getMethodName(meta) + eventName, zap.String("data", t.marshal(req, opts)),
 		log.WithoutAttachLog2Trace(),
 	}
+	if t.routed {
+		logFields = append(logFields, zlog.WithModule(logFilterModule))
+	}
 
 	level := t.getLevel(ctx)
 	log.Log.Log(level, logFields...)
-	return ctx, meta
 }
 
-func (t *logFilter) end(ctx context.Context, meta CallMeta, rsp interface{}, err error) error {
+func (t *logFilter) end(ctx context.Context, meta CallMeta, opts *logOptions, req, rsp interface{}, err error) error {
 	code, codeType, replaceErr := DefaultGetErrCodeFunc(ctx, rsp, err)
 	err = replaceErr
 
+	if opts.isExcluded(meta.CalleeMethod()) {
+		return err
+	}
+
+	duration := meta.EndTime() - meta.StartTime()
+	if opts.isDeferred() {
+		if err == nil && !opts.shouldLogSuccess(time.Duration(duration)) {
+			return err
+		}
+		t.start(ctx, meta, opts, req) // 调用前没有记录请求日志
+	}
+
 	eventName := " Recv"
 	if meta.IsServiceMeta() {
 		eventName = " Send"
@@ -138,7 +270,6 @@ func (t *logFilter) end(ctx context.Context, meta CallMeta, rsp interface{}, err
 	fn, file, line := meta.FuncFileLine()
 	customCaller := zlog.WithCaller(fn, file, line)
 
-	duration := meta.EndTime() - meta.StartTime()
 	logFields := []interface{}{
 		ctx,
 		customCaller, zap.String("instance", config.Conf.Config().Frame.Instance),
@@ -149,13 +280,16 @@ func (t *logFilter) end(ctx context.Context, meta CallMeta, rsp interface{}, err
 		zap.String("calleeService", meta.CalleeService()),
 		zap.String("calleeMethod", meta.CalleeMethod()),
 		t.getMethodName(meta) + eventName,
-		zap.String("data", t.marshal(rsp)),
+		zap.String("data", t.marshal(rsp, opts)),
 		zap.Int64("duration", duration),
 		zap.String("durationText", time.Duration(duration).String()),
 		zap.Int("code", code),
 		zap.String("codeType", codeType),
 		log.WithoutAttachLog2Trace(),
 	}
+	if t.routed {
+		logFields = append(logFields, zlog.WithModule(logFilterModule))
+	}
 	if err != nil {
 		if meta.HasPanic() {
 			detail := utils.Recover.GetRecoverErrors(err)
@@ -176,18 +310,26 @@ func (t *logFilter) end(ctx context.Context, meta CallMeta, rsp interface{}, err
 }
 
 func (t *logFilter) HandleInject(ctx context.Context, req, rsp interface{}, next core.FilterInjectFunc) error {
-	ctx, meta := t.start(ctx, req)
+	meta := GetCallMeta(ctx)
+	opts := t.getOptions(meta)
+	if !opts.isDeferred() && !opts.isExcluded(meta.CalleeMethod()) {
+		t.start(ctx, meta, opts, req)
+	}
 
 	err := next(ctx, req, rsp)
-	err = t.end(ctx, meta, rsp, err)
+	err = t.end(ctx, meta, opts, req, rsp, err)
 	return err
 }
 
 func (t *logFilter) Handle(ctx context.Context, req interface{}, next core.FilterFunc) (interface{}, error) {
-	ctx, meta := t.start(ctx, req)
+	meta := GetCallMeta(ctx)
+	opts := t.getOptions(meta)
+	if !opts.isDeferred() && !opts.isExcluded(meta.CalleeMethod()) {
+		t.start(ctx, meta, opts, req)
+	}
 
 	rsp, err := next(ctx, req)
-	err = t.end(ctx, meta, rsp, err)
+	err = t.end(ctx, meta, opts, req, rsp, err)
 	return rsp, err
 }
 
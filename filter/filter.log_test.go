@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogOptionsTruncate(t *testing.T) {
+	o := &logOptions{MaxBodyLen: 5}
+	require.Equal(t, "abc", o.truncate("abc"))
+	require.Equal(t, "abcde...(truncated, total 7 bytes)", o.truncate("abcdefg"))
+	require.Equal(t, "ab中...(truncated, total 8 bytes)", o.truncate("ab中文"))
+	o.MaxBodyLen = 4
+	require.Equal(t, "ab...(truncated, total 8 bytes)", o.truncate("ab中文")) // 不会截断多字节字符
+
+	o = &logOptions{}
+	require.Equal(t, "abcdefg", o.truncate("abcdefg"))
+}
+
+func TestLogOptionsShouldLog(t *testing.T) {
+	require.False(t, (&logOptions{}).isDeferred())
+	require.True(t, (&logOptions{}).shouldLogSuccess(0))
+
+	o := &logOptions{OnlyError: true}
+	require.True(t, o.isDeferred())
+	require.False(t, o.shouldLogSuccess(time.Hour))
+
+	o = &logOptions{SlowThreshold: 100}
+	require.False(t, o.shouldLogSuccess(99*time.Millisecond))
+	require.True(t, o.shouldLogSuccess(100*time.Millisecond))
+
+	o = &logOptions{SuccessSampleRate: 0.5}
+	var n int
+	for i := 0; i < 1000; i++ {
+		if o.shouldLogSuccess(0) {
+			n++
+		}
+	}
+	require.InDelta(t, 500, n, 150)
+
+	o = &logOptions{ExcludeMethods: []string{"Health*", "ping"}}
+	require.True(t, o.isExcluded("HealthCheck"))
+	require.True(t, o.isExcluded("ping"))
+	require.False(t, o.isExcluded("Get"))
+}
+
+func TestLogFilterGetOptions(t *testing.T) {
+	def := &logOptions{MaxBodyLen: 1}
+	redisDef := &logOptions{MaxBodyLen: 2}
+	redisA := &logOptions{MaxBodyLen: 3}
+	svcDef := &logOptions{MaxBodyLen: 4}
+	svcA := &logOptions{MaxBodyLen: 5}
+	f := &logFilter{
+		ClientOptions: map[string]map[string]*logOptions{
+			defName: {defName: def},
+			"redis": {defName: redisDef, "a": redisA},
+		},
+		ServiceOptions: map[string]*logOptions{defName: svcDef, "a": svcA},
+	}
+	require.Equal(t, redisA, f.getClientOptions("redis", "a"))
+	require.Equal(t, redisDef, f.getClientOptions("redis", "b"))
+	require.Equal(t, def, f.getClientOptions("mysql", "a"))
+	require.Equal(t, svcA, f.getServiceOptions("a"))
+	require.Equal(t, svcDef, f.getServiceOptions("b"))
+
+	f = &logFilter{}
+	require.Equal(t, defLogOptions, f.getClientOptions("redis", "a"))
+	require.Equal(t, defLogOptions, f.getServiceOptions("a"))
+}
@@ -2,7 +2,9 @@ package filter
 
 import (
 	"context"
+	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/shirou/gopsutil/v3/mem"
 
 	"github.com/zly-app/zapp/component/metrics"
+	"github.com/zly-app/zapp/config"
 	"github.com/zly-app/zapp/core"
 	"github.com/zly-app/zapp/pkg/utils"
 )
@@ -28,8 +31,22 @@ const (
 
 	metricsProcessCpuCores    = "process_cpu_cores"    // cpu数量
 	metricsProcessMemoryQuota = "process_memory_quota" // 内存总量
+
+	metricsRpcLabelOverflowTotal = "rpc_label_overflow_total" // 标签值超过数量限制被折叠的次数
 )
 
+const (
+	defMetricsMaxLabelValues  = 1000    // 每个标签默认最多记录的不同值数量
+	metricsOverflowLabelValue = "other" // 超过数量限制的标签值会被替换为该值
+	LabelLabel                = "label"
+)
+
+// 默认耗时桶(毫秒)
+var defMetricsBuckets = []float64{10, 20, 30, 50, 100, 200, 300, 500, 1000, 2000, 3000, 5000}
+
+// 默认限制不同值数量的标签
+var defMetricsLimitLabels = []string{LabelCallerService, LabelCallerMethod, LabelCalleeService, LabelCalleeMethod}
+
 const (
 	LabelKind          = "kind"
 	LabelCallerService = "caller_service"
@@ -45,6 +62,7 @@ func init() {
 }
 
 var metricsOnce sync.Once
+var metricsInitErr error // 初始化失败后每次 Init 都返回该错误
 var defaultMetrics = &metricsFilter{}
 
 func newMetricsFilter() core.Filter {
@@ -64,35 +82,271 @@ type metricsFilter struct {
 
 	ProcessCpuCores    metrics.IGauge
 	ProcessMemoryQuota metrics.IGauge
+
+	clientHistograms  map[string]map[string]metrics.IHistogram // 单独配置了桶的客户端耗时直方图
+	serviceHistograms map[string]metrics.IHistogram            // 单独配置了桶的服务耗时直方图
+
+	limiter *labelLimiter
+}
+
+/*
+标签值数量限制器, 每个指标类型的每个标签最多记录 max 个不同的值
+
+	超过的值会被替换为 other, 并增加 rpc_label_overflow_total 计数, 避免方法名中带有uuid等情况导致指标数量暴涨
+*/
+type labelLimiter struct {
+	max      int
+	labels   []string
+	overflow metrics.ICounter
+
+	mx     sync.RWMutex
+	values map[string]map[string]struct{} // kind/label -> 已记录的值
+}
+
+func newLabelLimiter(max int, labels []string, overflow metrics.ICounter) *labelLimiter {
+	return &labelLimiter{
+		max:      max,
+		labels:   labels,
+		overflow: overflow,
+		values:   make(map[string]map[string]struct{}),
+	}
+}
+
+// 检查值是否允许使用, 未记录的值在数量未达到限制时会被记录
+func (l *labelLimiter) allow(key, value string) bool {
+	l.mx.RLock()
+	_, ok := l.values[key][value]
+	l.mx.RUnlock()
+	if ok {
+		return true
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	values, ok := l.values[key]
+	if !ok {
+		values = make(map[string]struct{})
+		l.values[key] = values
+	}
+	if _, ok = values[value]; ok {
+		return true
+	}
+	if len(values) >= l.max {
+		return false
+	}
+	values[value] = struct{}{}
+	return true
+}
+
+// 将超过数量限制的标签值替换为 other
+func (l *labelLimiter) fold(label metrics.Labels) {
+	if l == nil || l.max < 0 {
+		return
+	}
+	kind := label[LabelKind]
+	for _, name := range l.labels {
+		value, ok := label[name]
+		if !ok || value == metricsOverflowLabelValue {
+			continue
+		}
+		if !l.allow(kind+"/"+name, value) {
+			label[name] = metricsOverflowLabelValue
+			l.overflow.Inc(metrics.Labels{LabelKind: kind, LabelLabel: name}, nil)
+		}
+	}
 }
 
 func (*metricsFilter) Name() string { return "base.metrics" }
 
+/*
+耗时直方图选项
+
+	内置注册表只输出文本格式, 无法表示原生直方图, 需要更细的精度时可以使用指数桶
+*/
+type metricsHistogramOptions struct {
+	Buckets            []float64                  // 桶的上界(毫秒)
+	ExponentialBuckets *metricsExponentialBuckets // 指数桶, 设置后忽略 Buckets
+}
+
+// 指数桶, 第一个桶的上界为 Start, 之后每个桶是前一个的 Factor 倍, 共 Count 个
+type metricsExponentialBuckets struct {
+	Start  float64
+	Factor float64
+	Count  int
+}
+
+// 获取桶
+func (o *metricsHistogramOptions) buckets() ([]float64, error) {
+	if o == nil {
+		return defMetricsBuckets, nil
+	}
+	if e := o.ExponentialBuckets; e != nil {
+		if e.Start <= 0 || e.Factor <= 1 || e.Count < 1 {
+			return nil, fmt.Errorf("base.metrics 指数桶配置无效, Start=%v, Factor=%v, Count=%d", e.Start, e.Factor, e.Count)
+		}
+		return metrics.ExponentialBuckets(e.Start, e.Factor, e.Count), nil
+	}
+	if len(o.Buckets) > 0 {
+		return o.Buckets, nil
+	}
+	return defMetricsBuckets, nil
+}
+
+type metricsConfig struct {
+	ServiceHistogram  *metricsHistogramOptions                       // 服务耗时直方图
+	ClientHistogram   *metricsHistogramOptions                       // 客户端耗时直方图
+	ServiceHistograms map[string]*metricsHistogramOptions            // 服务耗时直方图, 服务名 -> 选项, 查找方式和 Service 一致
+	ClientHistograms  map[string]map[string]*metricsHistogramOptions // 客户端耗时直方图, 客户端类型 -> 客户端名 -> 选项, 查找方式和 Client 一致
+	MaxLabelValues    int                                            // 每个标签最多记录的不同值数量, 超过的值会被替换为 other, 默认 1000, 小于0表示不限制
+	LimitLabels       []string                                       // 限制不同值数量的标签, 默认 caller_service, caller_method, callee_service, callee_method
+}
+
+func newMetricsConfig() *metricsConfig {
+	return &metricsConfig{
+		ServiceHistograms: make(map[string]*metricsHistogramOptions),
+		ClientHistograms:  make(map[string]map[string]*metricsHistogramOptions),
+	}
+}
+
+func (c *metricsConfig) check() {
+	if c.MaxLabelValues == 0 {
+		c.MaxLabelValues = defMetricsMaxLabelValues
+	}
+	if len(c.LimitLabels) == 0 {
+		c.LimitLabels = defMetricsLimitLabels
+	}
+	// 默认服务和默认客户端的选项用于默认的直方图
+	if o, ok := c.ServiceHistograms[defName]; ok {
+		c.ServiceHistogram = o
+		delete(c.ServiceHistograms, defName)
+	}
+	if o, ok := c.ClientHistograms[defName][defName]; ok {
+		c.ClientHistogram = o
+		delete(c.ClientHistograms[defName], defName)
+	}
+}
+
+/*
+生成单独配置了桶的直方图的指标名, 为 base 加上不为 default 的名字, 无效字符替换为 _
+
+	同名指标只能有一组桶, 所以每组配置注册为不同的指标, 如 rpc_client_handled_msec_redis_cache
+*/
+func metricsHistogramName(base string, names ...string) string {
+	var sb strings.Builder
+	sb.WriteString(base)
+	for _, name := range names {
+		if name == defName {
+			continue
+		}
+		sb.WriteByte('_')
+		for _, r := range name {
+			if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteByte('_')
+			}
+		}
+	}
+	return sb.String()
+}
+
 func (m *metricsFilter) Init(app core.IApp) error {
 	metricsOnce.Do(func() {
-		startLabels := []string{LabelKind, LabelCallerService, LabelCallerMethod, LabelCalleeService, LabelCalleeMethod}
-		labels := append(startLabels, LabelCodeType, LabelCode)
-		buckets := []float64{10, 20, 30, 50, 100, 200, 300, 500, 1000, 2000, 3000, 5000}
+		metricsInitErr = m.init(app)
+	})
+	return metricsInitErr
+}
+
+func (m *metricsFilter) init(app core.IApp) error {
+	conf := newMetricsConfig()
+	if err := config.Conf.ParseFilterConfig("base.metrics", conf, true); err != nil {
+		return err
+	}
+	conf.check()
+	if err := m.registry(conf); err != nil {
+		return err
+	}
 
-		m.RpcServerStartedTotal = metrics.RegistryCounter(metricsRpcServerStartedTotal, "服务rpc开始计数器", nil, startLabels...)
-		m.RpcServerHandledTotal = metrics.RegistryCounter(metricsRpcServerHandledTotal, "服务rpc调用计数器", nil, labels...)
-		m.RpcServerPanicTotal = metrics.RegistryCounter(metricsRpcServerPanicTotal, "服务rpc调用panic计数器", nil, labels...)
-		m.RpcServerHandledMsec = metrics.RegistryHistogram(metricsRpcServerHandledMsec, "耗时桶", buckets, nil, labels...)
+	// 启动系统信息报告协程
+	go m.startSystemInfoReporting(app)
+	return nil
+}
 
-		m.RpcClientStartedTotal = metrics.RegistryCounter(metricsRpcClientStartedTotal, "客户端rpc开始计数器", nil, startLabels...)
-		m.RpcClientHandledTotal = metrics.RegistryCounter(metricsRpcClientHandledTotal, "客户端rpc调用计数器", nil, labels...)
-		m.RpcClientPanicTotal = metrics.RegistryCounter(metricsRpcClientPanicTotal, "客户端rpc调用panic计数器", nil, labels...)
-		m.RpcClientHandledMsec = metrics.RegistryHistogram(metricsRpcClientHandledMsec, "客户端耗时桶", buckets, nil, labels...)
+// 注册指标
+func (m *metricsFilter) registry(conf *metricsConfig) error {
+	serverBuckets, err := conf.ServiceHistogram.buckets()
+	if err != nil {
+		return err
+	}
+	clientBuckets, err := conf.ClientHistogram.buckets()
+	if err != nil {
+		return err
+	}
 
-		m.ProcessCpuCores = metrics.RegistryGauge(metricsProcessCpuCores, "cpu数量", nil)
-		m.ProcessMemoryQuota = metrics.RegistryGauge(metricsProcessMemoryQuota, "内存总量", nil)
+	startLabels := []string{LabelKind, LabelCallerService, LabelCallerMethod, LabelCalleeService, LabelCalleeMethod}
+	labels := append(startLabels, LabelCodeType, LabelCode)
 
-		// 启动系统信息报告协程
-		go m.startSystemInfoReporting(app)
-	})
+	m.RpcServerStartedTotal = metrics.RegistryCounter(metricsRpcServerStartedTotal, "服务rpc开始计数器", nil, startLabels...)
+	m.RpcServerHandledTotal = metrics.RegistryCounter(metricsRpcServerHandledTotal, "服务rpc调用计数器", nil, labels...)
+	m.RpcServerPanicTotal = metrics.RegistryCounter(metricsRpcServerPanicTotal, "服务rpc调用panic计数器", nil, labels...)
+	m.RpcServerHandledMsec = metrics.RegistryHistogram(metricsRpcServerHandledMsec, "耗时桶", serverBuckets, nil, labels...)
+
+	m.RpcClientStartedTotal = metrics.RegistryCounter(metricsRpcClientStartedTotal, "客户端rpc开始计数器", nil, startLabels...)
+	m.RpcClientHandledTotal = metrics.RegistryCounter(metricsRpcClientHandledTotal, "客户端rpc调用计数器", nil, labels...)
+	m.RpcClientPanicTotal = metrics.RegistryCounter(metricsRpcClientPanicTotal, "客户端rpc调用panic计数器", nil, labels...)
+	m.RpcClientHandledMsec = metrics.RegistryHistogram(metricsRpcClientHandledMsec, "客户端耗时桶", clientBuckets, nil, labels...)
+
+	m.serviceHistograms = make(map[string]metrics.IHistogram, len(conf.ServiceHistograms))
+	for name, o := range conf.ServiceHistograms {
+		buckets, err := o.buckets()
+		if err != nil {
+			return err
+		}
+		m.serviceHistograms[name] = metrics.RegistryHistogram(metricsHistogramName(metricsRpcServerHandledMsec, name), "耗时桶", buckets, nil, labels...)
+	}
+	m.clientHistograms = make(map[string]map[string]metrics.IHistogram, len(conf.ClientHistograms))
+	for clientType, clientConf := range conf.ClientHistograms {
+		chain := make(map[string]metrics.IHistogram, len(clientConf))
+		m.clientHistograms[clientType] = chain
+		for clientName, o := range clientConf {
+			buckets, err := o.buckets()
+			if err != nil {
+				return err
+			}
+			chain[clientName] = metrics.RegistryHistogram(metricsHistogramName(metricsRpcClientHandledMsec, clientType, clientName), "客户端耗时桶", buckets, nil, labels...)
+		}
+	}
+
+	m.ProcessCpuCores = metrics.RegistryGauge(metricsProcessCpuCores, "cpu数量", nil)
+	m.ProcessMemoryQuota = metrics.RegistryGauge(metricsProcessMemoryQuota, "内存总量", nil)
+
+	overflow := metrics.RegistryCounter(metricsRpcLabelOverflowTotal, "标签值超过数量限制被替换为other的次数", nil, LabelKind, LabelLabel)
+	m.limiter = newLabelLimiter(conf.MaxLabelValues, conf.LimitLabels, overflow)
 	return nil
 }
 
+func (m *metricsFilter) getClientHistogram(clientType, clientName string) metrics.IHistogram {
+	ct, ok := m.clientHistograms[clientType]
+	if ok {
+		h, ok := ct[clientName]
+		if ok {
+			return h
+		}
+		h, ok = ct[defName] // 默认客户端组件
+		if ok {
+			return h
+		}
+	}
+	return m.RpcClientHandledMsec
+}
+func (m *metricsFilter) getServiceHistogram(serviceName string) metrics.IHistogram {
+	h, ok := m.serviceHistograms[serviceName]
+	if ok {
+		return h
+	}
+	return m.RpcServerHandledMsec
+}
+
 // 启动系统信息报告协程
 func (m *metricsFilter) startSystemInfoReporting(app core.IApp) {
 	m.reportSysInfo() // 立即报告
@@ -135,6 +389,7 @@ func (m *metricsFilter) start(ctx context.Context) CallMeta {
 			LabelCalleeService: meta.CalleeService(),
 			LabelCalleeMethod:  meta.CalleeMethod(),
 		}
+		m.limiter.fold(label)
 		m.RpcServerStartedTotal.Inc(label, nil)
 	case MetaKindClient:
 		label = metrics.Labels{
@@ -144,6 +399,7 @@ func (m *metricsFilter) start(ctx context.Context) CallMeta {
 			LabelCalleeService: meta.CalleeService(),
 			LabelCalleeMethod:  meta.CalleeMethod(),
 		}
+		m.limiter.fold(label)
 		m.RpcClientStartedTotal.Inc(label, nil)
 	}
 
@@ -158,8 +414,8 @@ func (m *metricsFilter) end(ctx context.Context, meta CallMeta, rsp interface{},
 
 	// 不成功的则上报标本
 	if codeType != CodeTypeSuccess {
-		traceID, _ := utils.Trace.GetOTELTraceID(ctx)
-		exemplar = metrics.Labels{"traceID": traceID}
+		traceID, spanID := utils.Trace.GetOTELTraceID(ctx)
+		exemplar = metrics.Labels{"traceID": traceID, "spanID": spanID}
 		utils.Trace.SaveToMap(ctx, exemplar)
 	}
 
@@ -175,11 +431,12 @@ func (m *metricsFilter) end(ctx context.Context, meta CallMeta, rsp interface{},
 			LabelCodeType:      cast.ToString(codeType),
 			LabelCode:          cast.ToString(code),
 		}
+		m.limiter.fold(label)
 		m.RpcServerHandledTotal.Inc(label, exemplar)
 		if meta.HasPanic() {
 			m.RpcServerPanicTotal.Inc(label, exemplar)
 		}
-		m.RpcServerHandledMsec.Observe(float64(duration.Milliseconds()), label, exemplar)
+		m.getServiceHistogram(meta.ServiceName()).Observe(float64(duration.Milliseconds()), label, exemplar)
 	case MetaKindClient:
 		label = metrics.Labels{
 			LabelKind:          "client",
@@ -190,11 +447,12 @@ func (m *metricsFilter) end(ctx context.Context, meta CallMeta, rsp interface{},
 			LabelCodeType:      cast.ToString(codeType),
 			LabelCode:          cast.ToString(code),
 		}
+		m.limiter.fold(label)
 		m.RpcClientHandledTotal.Inc(label, exemplar)
 		if meta.HasPanic() {
 			m.RpcClientPanicTotal.Inc(label, exemplar)
 		}
-		m.RpcClientHandledMsec.Observe(float64(duration.Milliseconds()), label, exemplar)
+		m.getClientHistogram(meta.ClientType(), meta.ClientName()).Observe(float64(duration.Milliseconds()), label, exemplar)
 	}
 }
 
@@ -0,0 +1,98 @@
+package filter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+func TestMetricsHistogramBuckets(t *testing.T) {
+	var o *metricsHistogramOptions
+	buckets, err := o.buckets()
+	require.NoError(t, err)
+	require.Equal(t, defMetricsBuckets, buckets)
+
+	o = &metricsHistogramOptions{Buckets: []float64{1, 2}}
+	buckets, err = o.buckets()
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 2}, buckets)
+
+	o.ExponentialBuckets = &metricsExponentialBuckets{Start: 1, Factor: 2, Count: 4}
+	buckets, err = o.buckets()
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 2, 4, 8}, buckets)
+
+	o.ExponentialBuckets.Factor = 1
+	_, err = o.buckets()
+	require.Error(t, err)
+}
+
+func TestMetricsLabelLimiter(t *testing.T) {
+	defer metrics.SetClient(metrics.GetClient())
+	r := metrics.NewRegistry()
+	metrics.SetClient(r)
+
+	conf := newMetricsConfig()
+	conf.MaxLabelValues = 2
+	conf.ClientHistogram = &metricsHistogramOptions{Buckets: []float64{100}}
+	conf.check()
+	m := &metricsFilter{}
+	require.NoError(t, m.registry(conf))
+
+	for _, method := range []string{"a", "b", "c", "d", "a"} {
+		label := metrics.Labels{LabelKind: "client", LabelCalleeMethod: method}
+		m.limiter.fold(label)
+		m.RpcClientHandledMsec.Observe(1, label, nil)
+	}
+	// 服务端的标签值单独计数
+	label := metrics.Labels{LabelKind: "server", LabelCalleeMethod: "c"}
+	m.limiter.fold(label)
+	require.Equal(t, "c", label[LabelCalleeMethod])
+
+	var buf bytes.Buffer
+	require.NoError(t, metrics.WriteText(&buf, r.Gather()))
+	out := buf.String()
+	require.Contains(t, out, `rpc_client_handled_msec_bucket{callee_method="a",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="client",le="100"} 2`)
+	require.Contains(t, out, `rpc_client_handled_msec_bucket{callee_method="other",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="client",le="100"} 2`)
+	require.Contains(t, out, `rpc_label_overflow_total{kind="client",label="callee_method"} 2`)
+}
+
+func TestMetricsHistogramLookup(t *testing.T) {
+	defer metrics.SetClient(metrics.GetClient())
+	r := metrics.NewRegistry()
+	metrics.SetClient(r)
+
+	conf := newMetricsConfig()
+	conf.ServiceHistograms = map[string]*metricsHistogramOptions{
+		"api":   {Buckets: []float64{3}},
+		defName: {Buckets: []float64{4}},
+	}
+	conf.ClientHistograms = map[string]map[string]*metricsHistogramOptions{
+		"redis": {
+			defName:      {Buckets: []float64{5}},
+			"user-cache": {Buckets: []float64{6}},
+		},
+		defName: {defName: {Buckets: []float64{100}}},
+	}
+	conf.check()
+	m := &metricsFilter{}
+	require.NoError(t, m.registry(conf))
+
+	m.getServiceHistogram("api").Observe(1, nil, nil)
+	m.getServiceHistogram("other").Observe(1, nil, nil)
+	m.getClientHistogram("redis", "user-cache").Observe(1, nil, nil)
+	m.getClientHistogram("redis", "other").Observe(1, nil, nil)
+	m.getClientHistogram("sqlx", "other").Observe(1, nil, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, metrics.WriteText(&buf, r.Gather()))
+	out := buf.String()
+	require.Contains(t, out, `rpc_server_handled_msec_api_bucket{callee_method="",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="",le="3"} 1`)
+	require.Contains(t, out, `rpc_server_handled_msec_bucket{callee_method="",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="",le="4"} 1`)
+	require.Contains(t, out, `rpc_client_handled_msec_redis_user_cache_bucket{callee_method="",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="",le="6"} 1`)
+	require.Contains(t, out, `rpc_client_handled_msec_redis_bucket{callee_method="",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="",le="5"} 1`)
+	require.Contains(t, out, `rpc_client_handled_msec_bucket{callee_method="",callee_service="",caller_method="",caller_service="",code="",code_type="",kind="",le="100"} 1`)
+}
@@ -2,7 +2,13 @@ package filter
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -19,31 +25,234 @@ func init() {
 	RegisterFilterCreator("base.trace", newTraceFilter, newTraceFilter)
 }
 
-var defTraceFilter core.Filter = traceFilter{}
+const (
+	// 全量模式, 所有span都记录 req/rsp
+	TraceModeFull = "full"
+	// 尾部采样模式, 在调用结束后决定是否保留span, 只有保留的span才记录 req/rsp
+	TraceModeTail = "tail"
+)
+
+/*
+尾部采样模式下保留span的属性
+
+	调用结束后 base.trace 会在span上设置该属性, 值为是否保留
+	trace 插件开启 TailSampling 后会缓存同一个 trace 的 span, 只要有一个span需要保留, 整个 trace 都会导出
+*/
+const TraceTailKeepKey = utils.OtelSpanKey("tail.keep")
+
+var traceTailProcessorInstalled atomic.Bool
+
+/*
+声明已安装处理 TraceTailKeepKey 的尾部采样处理器, 处理器需要在导出前去掉该属性
+
+	trace 插件开启 TailSampling 时会调用, 使用自定义的 TracerProvider 实现尾部采样时需要自行调用
+	base.trace 为 tail 模式且未安装处理器时初始化失败
+*/
+func RegisterTraceTailProcessor() {
+	traceTailProcessorInstalled.Store(true)
+}
+
+const (
+	defTraceTailSampleRatio = 0.01
+	defTraceP99MinSamples   = 100
+	traceP99WindowSize      = 256  // 计算p99的耗时窗口大小
+	traceP99UpdateInterval  = 32   // 每记录多少次耗时重新计算p99
+	traceP99MaxKeys         = 1000 // 最多统计多少个方法的p99
+)
+
+var defTraceFilter core.Filter = &traceFilter{conf: newTraceConfig()}
 
 func newTraceFilter() core.Filter {
 	return defTraceFilter
 }
 
+type traceConfig struct {
+	Mode            string  // 模式, 支持 full, tail, 默认 full
+	TailSampleRatio float64 // tail 模式下正常调用的采样率, 按 traceID 决定, 取值 [0, 1], 默认 0.01
+	SlowThreshold   int     // tail 模式下的慢调用阈值(毫秒), 耗时达到阈值的调用总是保留, 0 表示不使用
+	DisableP99      bool    // tail 模式下不保留耗时超过同一方法p99的调用
+	P99MinSamples   int     // 方法的调用次数达到该值后才使用p99判断, 默认 100
+}
+
+func newTraceConfig() *traceConfig {
+	return &traceConfig{}
+}
+
+func (c *traceConfig) check() error {
+	if c.Mode == "" {
+		c.Mode = TraceModeFull
+	}
+	if c.Mode != TraceModeFull && c.Mode != TraceModeTail {
+		return fmt.Errorf("base.trace 不支持的模式 %q", c.Mode)
+	}
+	if c.TailSampleRatio == 0 {
+		c.TailSampleRatio = defTraceTailSampleRatio
+	}
+	if c.TailSampleRatio < 0 {
+		c.TailSampleRatio = 0
+	}
+	if c.TailSampleRatio > 1 {
+		c.TailSampleRatio = 1
+	}
+	if c.P99MinSamples <= 0 {
+		c.P99MinSamples = defTraceP99MinSamples
+	}
+	return nil
+}
+
+// 按 traceID 决定是否采样, 同一个 trace 的结果一致
+func (c *traceConfig) sampleByTraceID(traceID trace.TraceID) bool {
+	if c.TailSampleRatio >= 1 {
+		return true
+	}
+	x := binary.BigEndian.Uint64(traceID[8:16]) >> 1
+	return x < uint64(c.TailSampleRatio*(1<<63))
+}
+
 type traceFilter struct {
+	conf    *traceConfig
+	latency *latencyTracker
+	once    sync.Once
+	initErr error // 初始化失败后每次 Init 都返回该错误
+}
+
+/*
+每个方法最近的耗时, 用于估算p99
+
+	每个方法单独加锁, p99 在锁外排序计算后原子写入, 避免不同方法的调用互相等待
+*/
+type latencyTracker struct {
+	minSamples int
+
+	keys sync.Map     // key -> *latencyWindow
+	size atomic.Int32 // 记录的方法数
+}
+
+type latencyWindow struct {
+	mx     sync.Mutex
+	values []int64
+	next   int
+	count  int
+
+	p99 atomic.Int64
+}
+
+func newLatencyTracker(minSamples int) *latencyTracker {
+	return &latencyTracker{minSamples: minSamples}
 }
 
-func (t traceFilter) getSpanName(meta CallMeta) string {
+// 获取方法的耗时窗口, 方法数达到上限时返回 nil
+func (l *latencyTracker) window(key string) *latencyWindow {
+	if w, ok := l.keys.Load(key); ok {
+		return w.(*latencyWindow)
+	}
+	if l.size.Load() >= traceP99MaxKeys {
+		return nil
+	}
+	w, loaded := l.keys.LoadOrStore(key, &latencyWindow{values: make([]int64, traceP99WindowSize)})
+	if !loaded {
+		l.size.Add(1)
+	}
+	return w.(*latencyWindow)
+}
+
+// 记录耗时, 返回记录前是否超过了该方法的p99
+func (l *latencyTracker) observe(key string, duration int64) bool {
+	w := l.window(key)
+	if w == nil {
+		return false
+	}
+
+	var sorted []int64
+	w.mx.Lock()
+	slow := w.count >= l.minSamples && duration > w.p99.Load()
+	w.values[w.next] = duration
+	w.next = (w.next + 1) % len(w.values)
+	w.count++
+	if w.count%traceP99UpdateInterval == 0 || w.count == l.minSamples {
+		n := w.count
+		if n > len(w.values) {
+			n = len(w.values)
+		}
+		sorted = append([]int64(nil), w.values[:n]...)
+	}
+	w.mx.Unlock()
+
+	if sorted != nil {
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		w.p99.Store(sorted[(len(sorted)*99-1)/100])
+	}
+	return slow
+}
+
+func (t *traceFilter) getSpanName(meta CallMeta) string {
 	if meta.IsServiceMeta() {
 		return "被 " + meta.CalleeService() + " " + meta.CalleeMethod()
 	}
 	return "主 " + meta.CalleeService() + " " + meta.CalleeMethod()
 }
-func (t traceFilter) marshal(a any) string {
+func (t *traceFilter) marshal(a any) string {
 	s, _ := sonic.MarshalString(a)
 	return s
 }
 
-func (traceFilter) Name() string { return "base.trace" }
+func (*traceFilter) Name() string { return "base.trace" }
 
-func (t traceFilter) Init(app core.IApp) error { return nil }
+func (t *traceFilter) Init(app core.IApp) error {
+	t.once.Do(func() {
+		t.initErr = t.init()
+	})
+	return t.initErr
+}
 
-func (t traceFilter) start(ctx context.Context, req interface{}) (context.Context, trace.Span, CallMeta) {
+func (t *traceFilter) init() error {
+	conf := newTraceConfig()
+	if err := config.Conf.ParseFilterConfig("base.trace", conf, true); err != nil {
+		return err
+	}
+	if err := conf.check(); err != nil {
+		return err
+	}
+	// 没有尾部采样处理器时所有span都会导出, tail 模式没有意义
+	if conf.Mode == TraceModeTail && !traceTailProcessorInstalled.Load() {
+		return errors.New("base.trace 的 tail 模式需要开启 trace 插件的 TailSampling")
+	}
+	t.conf = conf
+	t.latency = newLatencyTracker(conf.P99MinSamples)
+	return nil
+}
+
+func (t *traceFilter) isTailMode() bool {
+	return t.conf.Mode == TraceModeTail
+}
+
+// 尾部采样模式下判断是否保留span
+func (t *traceFilter) shouldKeep(span trace.Span, meta CallMeta, duration int64, err error) bool {
+	slow := false
+	if !t.conf.DisableP99 && t.latency != nil {
+		key := strconv.Itoa(int(meta.Kind())) + "/" + meta.CalleeService() + "/" + meta.CalleeMethod()
+		slow = t.latency.observe(key, duration)
+	}
+	switch {
+	case err != nil || meta.HasPanic():
+		return true
+	case t.conf.SlowThreshold > 0 && duration >= int64(t.conf.SlowThreshold)*int64(time.Millisecond):
+		return true
+	case slow:
+		return true
+	}
+	return t.conf.sampleByTraceID(span.SpanContext().TraceID())
+}
+
+// 请求数据的事件名
+func (t *traceFilter) reqEventName(meta CallMeta) string {
+	if meta.IsServiceMeta() {
+		return "Recv"
+	}
+	return "Send"
+}
+
+func (t *traceFilter) start(ctx context.Context, req interface{}) (context.Context, trace.Span, CallMeta) {
 	meta := GetCallMeta(ctx)
 	fn, file, line := meta.FuncFileLine()
 
@@ -67,15 +276,14 @@ func (t traceFilter) start(ctx context.Context, req interface{}) (context.Contex
 		trace.WithSpanKind(kind),
 	)
 
-	eventName := "Send"
-	if meta.IsServiceMeta() {
-		eventName = "Recv"
+	// 尾部采样模式在调用结束后才记录请求数据
+	if span.IsRecording() && !t.isTailMode() {
+		utils.Trace.CtxEvent(ctx, t.reqEventName(meta), utils.OtelSpanKey("data").String(t.marshal(req)))
 	}
-	utils.Trace.CtxEvent(ctx, eventName, utils.OtelSpanKey("data").String(t.marshal(req)))
 	return ctx, span, meta
 }
 
-func (t traceFilter) end(ctx context.Context, span trace.Span, meta CallMeta, rsp interface{}, err error) error {
+func (t *traceFilter) end(ctx context.Context, span trace.Span, meta CallMeta, req, rsp interface{}, err error) error {
 	code, codeType, replaceErr := DefaultGetErrCodeFunc(ctx, rsp, err)
 	err = replaceErr
 
@@ -88,6 +296,18 @@ func (t traceFilter) end(ctx context.Context, span trace.Span, meta CallMeta, rs
 		utils.OtelSpanKey("codeType").String(codeType),
 	)
 
+	if !span.IsRecording() {
+		return err
+	}
+	if t.isTailMode() {
+		keep := t.shouldKeep(span, meta, duration, err)
+		span.SetAttributes(TraceTailKeepKey.Bool(keep))
+		if !keep {
+			return err
+		}
+		utils.Trace.CtxEvent(ctx, t.reqEventName(meta), utils.OtelSpanKey("data").String(t.marshal(req)))
+	}
+
 	eventName := "Recv"
 	if meta.IsServiceMeta() {
 		eventName = "Send"
@@ -101,22 +321,22 @@ func (t traceFilter) end(ctx context.Context, span trace.Span, meta CallMeta, rs
 	return err
 }
 
-func (t traceFilter) HandleInject(ctx context.Context, req, rsp interface{}, next core.FilterInjectFunc) error {
+func (t *traceFilter) HandleInject(ctx context.Context, req, rsp interface{}, next core.FilterInjectFunc) error {
 	ctx, span, meta := t.start(ctx, req)
 
 	err := next(ctx, req, rsp)
-	err = t.end(ctx, span, meta, rsp, err)
+	err = t.end(ctx, span, meta, req, rsp, err)
 	span.End()
 	return err
 }
 
-func (t traceFilter) Handle(ctx context.Context, req interface{}, next core.FilterFunc) (interface{}, error) {
+func (t *traceFilter) Handle(ctx context.Context, req interface{}, next core.FilterFunc) (interface{}, error) {
 	ctx, span, meta := t.start(ctx, req)
 
 	rsp, err := next(ctx, req)
-	err = t.end(ctx, span, meta, rsp, err)
+	err = t.end(ctx, span, meta, req, rsp, err)
 	span.End()
 	return rsp, err
 }
 
-func (t traceFilter) Close() error { return nil }
+func (t *traceFilter) Close() error { return nil }
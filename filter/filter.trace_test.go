@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zly-app/zapp/config"
+)
+
+func TestTraceConfigCheck(t *testing.T) {
+	conf := newTraceConfig()
+	require.NoError(t, conf.check())
+	require.Equal(t, TraceModeFull, conf.Mode)
+	require.Equal(t, defTraceTailSampleRatio, conf.TailSampleRatio)
+	require.Equal(t, defTraceP99MinSamples, conf.P99MinSamples)
+
+	require.Error(t, (&traceConfig{Mode: "head"}).check())
+
+	conf = &traceConfig{Mode: TraceModeTail, TailSampleRatio: -1}
+	require.NoError(t, conf.check())
+	require.Equal(t, 0.0, conf.TailSampleRatio)
+}
+
+func TestTraceSampleByTraceID(t *testing.T) {
+	conf := &traceConfig{TailSampleRatio: 0.5}
+	low := trace.TraceID{8: 0x10}
+	high := trace.TraceID{8: 0xf0}
+	require.True(t, conf.sampleByTraceID(low))
+	require.False(t, conf.sampleByTraceID(high))
+
+	conf.TailSampleRatio = 0
+	require.False(t, conf.sampleByTraceID(low))
+	conf.TailSampleRatio = 1
+	require.True(t, conf.sampleByTraceID(high))
+}
+
+func TestTraceLatencyTracker(t *testing.T) {
+	l := newLatencyTracker(100)
+	for i := 1; i <= 100; i++ {
+		require.False(t, l.observe("a", int64(i)), "样本数不足时不判断p99")
+	}
+	require.False(t, l.observe("a", 99))
+	require.True(t, l.observe("a", 1000))
+	require.False(t, l.observe("b", 1000), "方法单独统计")
+}
+
+func TestTraceLatencyTrackerConcurrent(t *testing.T) {
+	l := newLatencyTracker(100)
+	var wg sync.WaitGroup
+	for i := 0; i < traceP99MaxKeys+100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i % (traceP99MaxKeys + 10))
+			for j := 1; j <= 200; j++ {
+				l.observe(key, int64(j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.GreaterOrEqual(t, int(l.size.Load()), traceP99MaxKeys)
+	require.Nil(t, l.window("new"), "方法数达到上限后不再统计")
+	l.keys.Range(func(key, value any) bool {
+		w := value.(*latencyWindow)
+		require.Zero(t, w.count%200, "每次记录都不会丢失")
+		return true
+	})
+}
+
+func TestTraceShouldKeep(t *testing.T) {
+	f := &traceFilter{conf: &traceConfig{Mode: TraceModeTail, SlowThreshold: 100}}
+	require.NoError(t, f.conf.check())
+	f.conf.TailSampleRatio = 0
+	f.latency = newLatencyTracker(f.conf.P99MinSamples)
+
+	span := trace.SpanFromContext(trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+	})))
+	meta := newServiceMeta("api", "Get")
+	require.False(t, f.shouldKeep(span, meta, int64(time.Millisecond), nil))
+	require.True(t, f.shouldKeep(span, meta, int64(time.Millisecond), errors.New("err")))
+	require.True(t, f.shouldKeep(span, meta, int64(100*time.Millisecond), nil))
+
+	meta.SetPanic()
+	require.True(t, f.shouldKeep(span, meta, int64(time.Millisecond), nil))
+}
+
+func TestTraceFilterInit(t *testing.T) {
+	oldConf := config.Conf
+	t.Cleanup(func() {
+		config.Conf = oldConf
+		traceTailProcessorInstalled.Store(false)
+	})
+	vi := viper.New()
+	vi.Set("filters.config.base.trace", map[string]interface{}{"Mode": TraceModeTail})
+	config.NewConfig("test", config.WithViper(vi), config.WithoutFlag())
+
+	// 没有尾部采样处理器时 tail 模式初始化失败, 之后每次 Init 都返回错误
+	f := &traceFilter{conf: newTraceConfig()}
+	require.Error(t, f.Init(nil))
+	require.Error(t, f.Init(nil))
+
+	RegisterTraceTailProcessor()
+	f = &traceFilter{conf: newTraceConfig()}
+	require.NoError(t, f.Init(nil))
+	require.True(t, f.isTailMode())
+}
@@ -0,0 +1,26 @@
+package filter
+
+import (
+	"context"
+
+	"github.com/zly-app/zapp/config"
+)
+
+// 注册规则匹配器可以从ctx中获取的主调被调属性
+func init() {
+	getters := map[string]func(m CallMeta) string{
+		"caller_instance": CallMeta.CallerInstance,
+		"caller_env":      CallMeta.CallerEnv,
+		"caller_service":  CallMeta.CallerService,
+		"caller_method":   CallMeta.CallerMethod,
+		"callee_service":  CallMeta.CalleeService,
+		"callee_method":   CallMeta.CalleeMethod,
+	}
+	for name, fn := range getters {
+		fn := fn
+		config.RegistryRuleCtxAttr(name, func(ctx context.Context) (string, bool) {
+			v := fn(GetCallMeta(ctx))
+			return v, v != ""
+		})
+	}
+}
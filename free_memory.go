@@ -11,10 +11,16 @@ package zapp
 import (
 	"runtime/debug"
 	"time"
+
+	"github.com/zly-app/zapp/pkg/memory"
 )
 
-// 开始释放内存
+// 开始释放内存, 启用内存管理时由内存管理器按需释放
 func (app *appCli) startFreeMemory() {
+	if conf := app.config.Config().Frame.Memory; conf.Enable {
+		memory.NewManager(conf).Start(app.baseCtx)
+		return
+	}
 	go app.freeMemory()
 }
 
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/pkg/zlog"
+)
+
+// 日志等级配置
+type LevelConfig = zlog.LevelConfig
+
+// 模块字段, 通过 NewSessionLogger(log.WithModule("模块名")) 创建的logger使用模块的日志等级
+func WithModule(module string) zap.Field {
+	return zlog.WithModule(module)
+}
+
+// 设置全局日志等级
+func SetLevel(level string) error {
+	return zlog.SetLevel(Log, level)
+}
+
+// 设置将日志附加到trace的等级
+func SetTraceLevel(level string) error {
+	return zlog.SetTraceLevel(Log, level)
+}
+
+// 设置模块日志等级, level 为空表示使用全局日志等级
+func SetModuleLevel(module, level string) error {
+	return zlog.SetModuleLevel(Log, module, level)
+}
+
+// 应用日志等级配置, 只会修改不为空的配置
+func ApplyLevels(conf *LevelConfig) error {
+	return zlog.ApplyLevels(Log, conf)
+}
+
+// 获取当前的日志等级配置
+func GetLevels() (*LevelConfig, error) {
+	return zlog.GetLevels(Log)
+}
+
+// 日志等级的http处理器, GET 获取日志等级, PUT/POST 修改日志等级
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zlog.LevelHandler(Log).ServeHTTP(w, r) // Log 在app初始化时会被替换
+	})
+}
@@ -0,0 +1,41 @@
+package zapp
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/config"
+	"github.com/zly-app/zapp/pkg/zlog"
+)
+
+// 观察日志等级配置, 配置变更后会修改日志等级
+func (app *appCli) watchLogLevel() {
+	conf := app.config.Config().Frame.Log
+	if conf.WatchLevelGroup == "" || conf.WatchLevelKey == "" {
+		return
+	}
+
+	go func() {
+		w := config.WatchYaml[*zlog.LevelConfig](conf.WatchLevelGroup, conf.WatchLevelKey)
+		w.AddCallback(func(isInit bool, oldData, newData *zlog.LevelConfig) {
+			levels := &zlog.LevelConfig{
+				Level:      newData.Level,
+				TraceLevel: newData.TraceLevel,
+				Modules:    make(map[string]string, len(newData.Modules)),
+			}
+			if !isInit {
+				for module := range oldData.Modules { // 被移除的模块恢复为使用全局日志等级
+					levels.Modules[module] = ""
+				}
+			}
+			for module, level := range newData.Modules {
+				levels.Modules[module] = level
+			}
+
+			if err := zlog.ApplyLevels(app.ILogger, levels); err != nil {
+				app.Error("修改日志等级失败", zap.String("groupName", conf.WatchLevelGroup), zap.String("keyName", conf.WatchLevelKey), zap.Error(err))
+				return
+			}
+			app.Info("日志等级已修改", zap.Any("levels", levels))
+		})
+	}()
+}
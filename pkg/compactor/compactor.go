@@ -1,11 +1,8 @@
 package compactor
 
 import (
+	"fmt"
 	"io"
-
-	"go.uber.org/zap"
-
-	"github.com/zly-app/zapp/log"
 )
 
 type ICompactor interface {
@@ -29,7 +26,7 @@ var compactorList = map[string]ICompactor{
 func RegistryCompactor(name string, c ICompactor, replace ...bool) {
 	if len(replace) == 0 || !replace[0] {
 		if _, ok := compactorList[name]; ok {
-			log.Log.Panic("Compactor重复注册", zap.String("name", name))
+			panic(fmt.Sprintf("Compactor<%s>重复注册", name))
 		}
 	}
 	compactorList[name] = c
@@ -39,7 +36,7 @@ func RegistryCompactor(name string, c ICompactor, replace ...bool) {
 func GetCompactor(name string) ICompactor {
 	c, ok := compactorList[name]
 	if !ok {
-		log.Log.Panic("未定义的CompactorName", zap.String("name", name))
+		panic(fmt.Sprintf("未定义的CompactorName<%s>", name))
 	}
 	return c
 }
@@ -22,7 +22,6 @@
 package lumberjack
 
 import (
-	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
@@ -33,11 +32,14 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/zly-app/zapp/pkg/compactor"
 )
 
 const (
 	backupTimeFormat = "2006-01-02T15-04-05.000"
 	compressSuffix   = ".gz"
+	zstdSuffix       = ".zst"
 	defaultMaxSize   = 100
 )
 
@@ -76,6 +78,15 @@ var _ io.WriteCloser = (*Logger)(nil)
 // time, which may differ from the last time that file was written to.
 //
 // If MaxBackups and MaxAge are both 0, no old log files will be deleted.
+//
+// Time Based Rotation
+//
+// If RotateTime is set, the log file is also rotated at the first write after
+// every hour or day boundary. If FilenamePattern is set, log files are never
+// renamed. Instead each file is named by formatting the pattern with the start
+// time of the rotation period, and a file rotated because of MaxSize within
+// the same period gets an index inserted before the extension, e.g.
+// `app-2016110418.log`, `app-2016110418.1.log`.
 type Logger struct {
 	// Filename is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
@@ -107,10 +118,35 @@ type Logger struct {
 	// using gzip. The default is not to perform compression.
 	Compress bool `json:"compress" yaml:"compress"`
 
+	// CompressType is the compression used for rotated log files, either gzip
+	// or zstd. The default is gzip.
+	CompressType string `json:"compresstype" yaml:"compresstype"`
+
+	// RotateTime determines if the log file is rotated at a wall-clock
+	// boundary, either hourly or daily. The default is to rotate only by size,
+	// unless FilenamePattern is set, in which case it defaults to hourly if
+	// the pattern contains %H, %M or %S and daily otherwise.
+	RotateTime string `json:"rotatetime" yaml:"rotatetime"`
+
+	// FilenamePattern is the name of log files in the directory of Filename,
+	// such as `app-%Y%m%d%H.log`. Supported directives are %Y, %m, %d, %H, %M,
+	// %S and %%. The default is to write to Filename and rename it on rotation.
+	FilenamePattern string `json:"filenamepattern" yaml:"filenamepattern"`
+
+	// MaxTotalSize is the maximum total size in megabytes of old log files.
+	// The oldest files are removed once it is exceeded. The default is not to
+	// remove old log files based on their total size.
+	MaxTotalSize int `json:"maxtotalsize" yaml:"maxtotalsize"`
+
 	size int64
 	file *os.File
 	mu   sync.Mutex
 
+	inited     bool
+	pattern    *namePattern
+	current    string    // path of the file being written
+	nextRotate time.Time // time of the next time based rotation
+
 	millCh    chan bool
 	startMill sync.Once
 }
@@ -136,6 +172,10 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if err = l.init(); err != nil {
+		return 0, err
+	}
+
 	writeLen := int64(len(p))
 	if writeLen > l.max() {
 		return 0, fmt.Errorf(
@@ -147,6 +187,10 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 		if err = l.openExistingOrNew(len(p)); err != nil {
 			return 0, err
 		}
+	} else if l.shouldRotateByTime() {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
 	}
 
 	if l.size+writeLen > l.max() {
@@ -161,6 +205,115 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// Validate checks RotateTime, FilenamePattern and CompressType, so that
+// configuration errors can be reported before the first Write.
+func (l *Logger) Validate() error {
+	switch l.RotateTime {
+	case "", RotateHourly, RotateDaily:
+	default:
+		return fmt.Errorf("unknown rotate time %q, want %q or %q", l.RotateTime, RotateHourly, RotateDaily)
+	}
+	switch l.CompressType {
+	case "", compactor.GzipCompactorName, compactor.ZStdCompactorName:
+	default:
+		return fmt.Errorf("unknown compress type %q, want %q or %q", l.CompressType, compactor.GzipCompactorName, compactor.ZStdCompactorName)
+	}
+	if l.FilenamePattern != "" {
+		if _, err := parseNamePattern(l.FilenamePattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// init validates the configuration and parses FilenamePattern once.
+func (l *Logger) init() error {
+	if l.inited {
+		return nil
+	}
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	if l.FilenamePattern != "" {
+		l.pattern, _ = parseNamePattern(l.FilenamePattern)
+	}
+	l.inited = true
+	return nil
+}
+
+// rotateTime returns the effective RotateTime.
+func (l *Logger) rotateTime() string {
+	if l.RotateTime != "" || l.pattern == nil {
+		return l.RotateTime
+	}
+	if l.pattern.hasDirective("HMS") {
+		return RotateHourly
+	}
+	return RotateDaily
+}
+
+// location returns the location used for timestamps and time based rotation.
+func (l *Logger) location() *time.Location {
+	if l.LocalTime {
+		return time.Local
+	}
+	return time.UTC
+}
+
+// periodStart returns the start of the rotation period containing t.
+func (l *Logger) periodStart(t time.Time) time.Time {
+	t = t.In(l.location())
+	switch l.rotateTime() {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// nextRotateTime returns the end of the rotation period containing t, or the
+// zero time if time based rotation is disabled.
+func (l *Logger) nextRotateTime(t time.Time) time.Time {
+	start := l.periodStart(t)
+	switch l.rotateTime() {
+	case RotateHourly:
+		return start.Add(time.Hour)
+	case RotateDaily:
+		return start.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// shouldRotateByTime reports whether the current rotation period has ended.
+func (l *Logger) shouldRotateByTime() bool {
+	return !l.nextRotate.IsZero() && !currentTime().Before(l.nextRotate)
+}
+
+// latestPatternFile returns the newest file of the rotation period containing
+// now and its index, or index -1 if there is no such file.
+func (l *Logger) latestPatternFile(now time.Time) (string, int, error) {
+	files, err := ioutil.ReadDir(l.dir())
+	if err != nil && !os.IsNotExist(err) {
+		return "", 0, fmt.Errorf("can't read log file directory: %s", err)
+	}
+	want := l.pattern.format(l.periodStart(now), 0)
+	name, latest := "", -1
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		t, index, err := l.pattern.parse(f.Name(), l.location())
+		if err != nil || l.pattern.format(t, 0) != want {
+			continue
+		}
+		if index > latest {
+			name, latest = filepath.Join(l.dir(), f.Name()), index
+		}
+	}
+	return name, latest, nil
+}
+
 // Close implements io.Closer, and closes the current logfile.
 func (l *Logger) Close() error {
 	l.mu.Lock()
@@ -186,6 +339,9 @@ func (l *Logger) close() error {
 func (l *Logger) Rotate() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if err := l.init(); err != nil {
+		return err
+	}
 	return l.rotate()
 }
 
@@ -211,6 +367,10 @@ func (l *Logger) openNew() error {
 		return fmt.Errorf("can't make directories for new logfile: %s", err)
 	}
 
+	if l.pattern != nil {
+		return l.openNewByPattern()
+	}
+
 	name := l.filename()
 	mode := os.FileMode(0644)
 	info, err := os_Stat(name)
@@ -238,6 +398,33 @@ func (l *Logger) openNew() error {
 	}
 	l.file = f
 	l.size = 0
+	l.current = name
+	l.nextRotate = l.nextRotateTime(currentTime())
+	return nil
+}
+
+// openNewByPattern opens the next file of the current rotation period named by
+// FilenamePattern. Existing files are never renamed or truncated.
+func (l *Logger) openNewByPattern() error {
+	now := currentTime()
+	_, index, err := l.latestPatternFile(now)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(l.dir(), l.pattern.format(l.periodStart(now), index+1))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open new logfile: %s", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error getting log file info: %s", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	l.current = name
+	l.nextRotate = l.nextRotateTime(now)
 	return nil
 }
 
@@ -264,7 +451,18 @@ func backupName(name string, local bool) string {
 func (l *Logger) openExistingOrNew(writeLen int) error {
 	l.mill()
 
+	now := currentTime()
 	filename := l.filename()
+	if l.pattern != nil {
+		name, index, err := l.latestPatternFile(now)
+		if err != nil {
+			return err
+		}
+		if index < 0 {
+			return l.openNew()
+		}
+		filename = name
+	}
 	info, err := os_Stat(filename)
 	if os.IsNotExist(err) {
 		return l.openNew()
@@ -276,6 +474,10 @@ func (l *Logger) openExistingOrNew(writeLen int) error {
 	if info.Size()+int64(writeLen) >= l.max() {
 		return l.rotate()
 	}
+	// the file was written in a previous rotation period
+	if l.pattern == nil && l.rotateTime() != "" && info.ModTime().Before(l.periodStart(now)) {
+		return l.rotate()
+	}
 
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
@@ -285,6 +487,8 @@ func (l *Logger) openExistingOrNew(writeLen int) error {
 	}
 	l.file = file
 	l.size = info.Size()
+	l.current = filename
+	l.nextRotate = l.nextRotateTime(now)
 	return nil
 }
 
@@ -302,11 +506,15 @@ func (l *Logger) filename() string {
 // files are removed, keeping at most l.MaxBackups files, as long as
 // none of them are older than MaxAge.
 func (l *Logger) millRunOnce() error {
-	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress {
+	if l.MaxBackups == 0 && l.MaxAge == 0 && l.MaxTotalSize == 0 && !l.Compress {
 		return nil
 	}
 
-	files, err := l.oldLogFiles()
+	l.mu.Lock()
+	current := filepath.Base(l.current)
+	l.mu.Unlock()
+
+	files, err := l.oldLogFiles(current)
 	if err != nil {
 		return err
 	}
@@ -319,10 +527,7 @@ func (l *Logger) millRunOnce() error {
 		for _, f := range files {
 			// Only count the uncompressed log file or the
 			// compressed log file, not both.
-			fn := f.Name()
-			if strings.HasSuffix(fn, compressSuffix) {
-				fn = fn[:len(fn)-len(compressSuffix)]
-			}
+			fn, _ := trimCompressSuffix(f.Name())
 			preserved[fn] = true
 
 			if len(preserved) > l.MaxBackups {
@@ -348,9 +553,24 @@ func (l *Logger) millRunOnce() error {
 		files = remaining
 	}
 
+	if l.MaxTotalSize > 0 {
+		limit := int64(l.MaxTotalSize) * int64(megabyte)
+		var total int64
+		var remaining []logInfo
+		for _, f := range files {
+			total += f.Size()
+			if total > limit {
+				remove = append(remove, f)
+			} else {
+				remaining = append(remaining, f)
+			}
+		}
+		files = remaining
+	}
+
 	if l.Compress {
 		for _, f := range files {
-			if !strings.HasSuffix(f.Name(), compressSuffix) {
+			if _, compressed := trimCompressSuffix(f.Name()); !compressed {
 				compress = append(compress, f)
 			}
 		}
@@ -364,7 +584,7 @@ func (l *Logger) millRunOnce() error {
 	}
 	for _, f := range compress {
 		fn := filepath.Join(l.dir(), f.Name())
-		errCompress := compressLogFile(fn, fn+compressSuffix)
+		errCompress := compressLogFile(fn, fn+l.compressSuffix(), compactor.GetCompactor(l.compressType()))
 		if err == nil && errCompress != nil {
 			err = errCompress
 		}
@@ -396,8 +616,9 @@ func (l *Logger) mill() {
 }
 
 // oldLogFiles returns the list of backup log files stored in the same
-// directory as the current log file, sorted by ModTime
-func (l *Logger) oldLogFiles() ([]logInfo, error) {
+// directory as the current log file, sorted by ModTime. The file named current
+// is excluded.
+func (l *Logger) oldLogFiles(current string) ([]logInfo, error) {
 	files, err := ioutil.ReadDir(l.dir())
 	if err != nil {
 		return nil, fmt.Errorf("can't read log file directory: %s", err)
@@ -407,15 +628,18 @@ func (l *Logger) oldLogFiles() ([]logInfo, error) {
 	prefix, ext := l.prefixAndExt()
 
 	for _, f := range files {
-		if f.IsDir() {
+		if f.IsDir() || f.Name() == current {
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
+		name, _ := trimCompressSuffix(f.Name())
+		if l.pattern != nil {
+			if t, index, err := l.pattern.parse(name, l.location()); err == nil {
+				logFiles = append(logFiles, logInfo{t, index, f})
+			}
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext+compressSuffix); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
+		if t, err := l.timeFromName(name, prefix, ext); err == nil {
+			logFiles = append(logFiles, logInfo{t, 0, f})
 			continue
 		}
 		// error parsing means that the suffix at the end was not generated
@@ -463,9 +687,36 @@ func (l *Logger) prefixAndExt() (prefix, ext string) {
 	return prefix, ext
 }
 
-// compressLogFile compresses the given log file, removing the
+// compressType returns the effective CompressType.
+func (l *Logger) compressType() string {
+	if l.CompressType == "" {
+		return compactor.GzipCompactorName
+	}
+	return l.CompressType
+}
+
+// compressSuffix returns the suffix of compressed log files.
+func (l *Logger) compressSuffix() string {
+	if l.compressType() == compactor.ZStdCompactorName {
+		return zstdSuffix
+	}
+	return compressSuffix
+}
+
+// trimCompressSuffix removes the suffix of a compressed log file from name,
+// whatever the compression type was.
+func trimCompressSuffix(name string) (string, bool) {
+	for _, suffix := range []string{compressSuffix, zstdSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return name[:len(name)-len(suffix)], true
+		}
+	}
+	return name, false
+}
+
+// compressLogFile compresses the given log file with c, removing the
 // uncompressed log file if successful.
-func compressLogFile(src, dst string) (err error) {
+func compressLogFile(src, dst string, c compactor.ICompactor) (err error) {
 	f, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
@@ -489,8 +740,6 @@ func compressLogFile(src, dst string) (err error) {
 	}
 	defer gzf.Close()
 
-	gz := gzip.NewWriter(gzf)
-
 	defer func() {
 		if err != nil {
 			os.Remove(dst)
@@ -498,10 +747,7 @@ func compressLogFile(src, dst string) (err error) {
 		}
 	}()
 
-	if _, err := io.Copy(gz, f); err != nil {
-		return err
-	}
-	if err := gz.Close(); err != nil {
+	if err := c.Compress(f, gzf); err != nil {
 		return err
 	}
 	if err := gzf.Close(); err != nil {
@@ -522,6 +768,7 @@ func compressLogFile(src, dst string) (err error) {
 // timestamp.
 type logInfo struct {
 	timestamp time.Time
+	index     int // index of files named by FilenamePattern within a period
 	os.FileInfo
 }
 
@@ -529,6 +776,9 @@ type logInfo struct {
 type byFormatTime []logInfo
 
 func (b byFormatTime) Less(i, j int) bool {
+	if b[i].timestamp.Equal(b[j].timestamp) {
+		return b[i].index > b[j].index
+	}
 	return b[i].timestamp.After(b[j].timestamp)
 }
 
@@ -0,0 +1,179 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/pkg/compactor"
+)
+
+// 测试时钟, 后台的 mill 协程也会读取时间, 所以需要加锁
+type fakeClock struct {
+	mx  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mx.Lock()
+	c.now = t
+	c.mx.Unlock()
+}
+
+var clock = &fakeClock{now: time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)}
+
+func init() {
+	currentTime = clock.Now
+	megabyte = 1
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFilenamePattern(t *testing.T) {
+	dir := t.TempDir()
+	clock.Set(time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))
+	l := &Logger{
+		Filename:        filepath.Join(dir, "app.log"),
+		MaxSize:         10,
+		FilenamePattern: "app-%Y%m%d%H.log",
+	}
+	defer l.Close()
+
+	_, err := l.Write([]byte("12345"))
+	require.NoError(t, err)
+	_, err = l.Write([]byte("123456")) // 超过大小, 同一小时内按序号轮转
+	require.NoError(t, err)
+	require.Equal(t, []string{"app-2024010110.1.log", "app-2024010110.log"}, listFiles(t, dir))
+
+	clock.Set(time.Date(2024, 1, 1, 11, 0, 1, 0, time.UTC)) // 到达整点
+	_, err = l.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"app-2024010110.1.log", "app-2024010110.log", "app-2024010111.log"}, listFiles(t, dir))
+
+	// 重启后追加到当前周期最新的文件
+	require.NoError(t, l.Close())
+	l2 := &Logger{
+		Filename:        filepath.Join(dir, "app.log"),
+		MaxSize:         10,
+		FilenamePattern: "app-%Y%m%d%H.log",
+	}
+	defer l2.Close()
+	_, err = l2.Write([]byte("def"))
+	require.NoError(t, err)
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "app-2024010111.log"))
+	require.NoError(t, err)
+	require.Equal(t, "abcdef", string(bs))
+}
+
+func TestNamePattern(t *testing.T) {
+	p, err := parseNamePattern("app1-%Y%m%d.%H.log")
+	require.NoError(t, err)
+	tm := time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+	require.Equal(t, "app1-20240305.07.log", p.format(tm, 0))
+	require.Equal(t, "app1-20240305.07.2.log", p.format(tm, 2))
+
+	got, index, err := p.parse("app1-20240305.07.log", time.UTC)
+	require.NoError(t, err)
+	require.True(t, tm.Equal(got))
+	require.Equal(t, 0, index)
+	got, index, err = p.parse("app1-20240305.07.2.log", time.UTC)
+	require.NoError(t, err)
+	require.True(t, tm.Equal(got))
+	require.Equal(t, 2, index)
+	_, _, err = p.parse("app1-20240305.log", time.UTC)
+	require.Error(t, err)
+
+	_, err = parseNamePattern("app-%Y%q.log")
+	require.Error(t, err)
+	require.Error(t, (&Logger{RotateTime: "weekly"}).Validate())
+	require.Error(t, (&Logger{CompressType: "lz4"}).Validate())
+}
+
+func TestRotateDaily(t *testing.T) {
+	dir := t.TempDir()
+	clock.Set(time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC))
+	l := &Logger{
+		Filename:   filepath.Join(dir, "app.log"),
+		MaxSize:    100,
+		RotateTime: RotateDaily,
+	}
+	defer l.Close()
+
+	_, err := l.Write([]byte("day1"))
+	require.NoError(t, err)
+	clock.Set(time.Date(2024, 1, 2, 0, 0, 1, 0, time.UTC))
+	_, err = l.Write([]byte("day2"))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"app-2024-01-02T00-00-01.000.log", "app.log"}, listFiles(t, dir))
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	require.Equal(t, "day2", string(bs))
+}
+
+func TestMaxTotalSizeAndZstd(t *testing.T) {
+	dir := t.TempDir()
+	clock.Set(time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))
+	l := &Logger{
+		Filename:        filepath.Join(dir, "app.log"),
+		MaxSize:         10,
+		MaxTotalSize:    25,
+		FilenamePattern: "app-%Y%m%d%H.log",
+	}
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := l.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+	// 当前文件之外只保留最新的2个文件
+	require.Eventually(t, func() bool {
+		return len(listFiles(t, dir)) == 3
+	}, 3*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"app-2024010110.2.log", "app-2024010110.3.log", "app-2024010110.4.log"}, listFiles(t, dir))
+
+	dir = t.TempDir()
+	l2 := &Logger{
+		Filename:     filepath.Join(dir, "app.log"),
+		MaxSize:      10,
+		Compress:     true,
+		CompressType: compactor.ZStdCompactorName,
+	}
+	defer l2.Close()
+	_, err := l2.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	_, err = l2.Write([]byte("abc"))
+	require.NoError(t, err)
+
+	backup := filepath.Join(dir, "app-2024-01-01T10-30-00.000.log.zst")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(backup)
+		return err == nil && len(listFiles(t, dir)) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	bs, err := ioutil.ReadFile(backup)
+	require.NoError(t, err)
+	raw, err := compactor.NewZStdCompactor().UnCompressBytes(bs)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(raw))
+}
@@ -0,0 +1,195 @@
+package lumberjack
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RotateHourly rotates the log file at the start of every hour.
+	RotateHourly = "hourly"
+	// RotateDaily rotates the log file at midnight.
+	RotateDaily = "daily"
+)
+
+// patternToken is either a literal string or a time directive such as 'Y'.
+type patternToken struct {
+	literal   string
+	directive byte
+}
+
+// directiveWidth is the number of digits produced by each supported directive.
+var directiveWidth = map[byte]int{
+	'Y': 4,
+	'm': 2,
+	'd': 2,
+	'H': 2,
+	'M': 2,
+	'S': 2,
+}
+
+// namePattern formats and parses file names like `app-%Y%m%d%H.log`.
+//
+// Supported directives are %Y (year), %m (month), %d (day), %H (hour),
+// %M (minute), %S (second) and %% (a literal percent sign).
+type namePattern struct {
+	tokens []patternToken
+	ext    string
+}
+
+// hasDirective reports whether the pattern contains any of the directives.
+func (p *namePattern) hasDirective(directives string) bool {
+	for _, tk := range p.tokens {
+		if tk.directive != 0 && strings.IndexByte(directives, tk.directive) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNamePattern(pattern string) (*namePattern, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty filename pattern")
+	}
+	if strings.ContainsAny(pattern, `/\`) {
+		return nil, fmt.Errorf("filename pattern %q must not contain a directory", pattern)
+	}
+	p := &namePattern{ext: filepath.Ext(pattern)}
+	if strings.Contains(p.ext, "%") {
+		return nil, fmt.Errorf("filename pattern %q must not contain directives in the extension", pattern)
+	}
+
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			p.tokens = append(p.tokens, patternToken{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+	stem := pattern[:len(pattern)-len(p.ext)]
+	for i := 0; i < len(stem); i++ {
+		if stem[i] != '%' {
+			literal.WriteByte(stem[i])
+			continue
+		}
+		if i+1 >= len(stem) {
+			return nil, fmt.Errorf("filename pattern %q ends with a bare %%", pattern)
+		}
+		i++
+		c := stem[i]
+		if c == '%' {
+			literal.WriteByte('%')
+			continue
+		}
+		if _, ok := directiveWidth[c]; !ok {
+			return nil, fmt.Errorf("filename pattern %q has unknown directive %%%c", pattern, c)
+		}
+		flush()
+		p.tokens = append(p.tokens, patternToken{directive: c})
+	}
+	flush()
+	return p, nil
+}
+
+// format returns the file name for t, with ".index" inserted before the
+// extension when index is greater than 0.
+func (p *namePattern) format(t time.Time, index int) string {
+	var b strings.Builder
+	for _, tk := range p.tokens {
+		if tk.directive == 0 {
+			b.WriteString(tk.literal)
+			continue
+		}
+		var v int
+		switch tk.directive {
+		case 'Y':
+			v = t.Year()
+		case 'm':
+			v = int(t.Month())
+		case 'd':
+			v = t.Day()
+		case 'H':
+			v = t.Hour()
+		case 'M':
+			v = t.Minute()
+		case 'S':
+			v = t.Second()
+		}
+		fmt.Fprintf(&b, "%0*d", directiveWidth[tk.directive], v)
+	}
+	if index > 0 {
+		b.WriteString("." + strconv.Itoa(index))
+	}
+	b.WriteString(p.ext)
+	return b.String()
+}
+
+// parse extracts the time and index encoded in a file name produced by format.
+func (p *namePattern) parse(name string, loc *time.Location) (time.Time, int, error) {
+	if !strings.HasSuffix(name, p.ext) {
+		return time.Time{}, 0, fmt.Errorf("mismatched extension")
+	}
+	stem := name[:len(name)-len(p.ext)]
+	if t, err := p.parseStem(stem, loc); err == nil {
+		return t, 0, nil
+	}
+
+	// try again without the ".index" suffix
+	dot := strings.LastIndexByte(stem, '.')
+	if dot < 0 {
+		return time.Time{}, 0, fmt.Errorf("mismatched pattern")
+	}
+	index, err := strconv.Atoi(stem[dot+1:])
+	if err != nil || index <= 0 {
+		return time.Time{}, 0, fmt.Errorf("mismatched pattern")
+	}
+	t, err := p.parseStem(stem[:dot], loc)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return t, index, nil
+}
+
+func (p *namePattern) parseStem(s string, loc *time.Location) (time.Time, error) {
+	year, month, day := 1970, 1, 1
+	var hour, minute, second int
+	for _, tk := range p.tokens {
+		if tk.directive == 0 {
+			if !strings.HasPrefix(s, tk.literal) {
+				return time.Time{}, fmt.Errorf("mismatched pattern")
+			}
+			s = s[len(tk.literal):]
+			continue
+		}
+		width := directiveWidth[tk.directive]
+		if len(s) < width {
+			return time.Time{}, fmt.Errorf("mismatched pattern")
+		}
+		v, err := strconv.Atoi(s[:width])
+		if err != nil || v < 0 {
+			return time.Time{}, fmt.Errorf("mismatched pattern")
+		}
+		s = s[width:]
+		switch tk.directive {
+		case 'Y':
+			year = v
+		case 'm':
+			month = v
+		case 'd':
+			day = v
+		case 'H':
+			hour = v
+		case 'M':
+			minute = v
+		case 'S':
+			second = v
+		}
+	}
+	if s != "" {
+		return time.Time{}, fmt.Errorf("mismatched pattern")
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, loc), nil
+}
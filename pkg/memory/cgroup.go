@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	procCgroupFile = "/proc/self/cgroup"
+	cgroupRoot     = "/sys/fs/cgroup"
+
+	// cgroup v1 没有限制时的值接近 int64 最大值, 超过该值认为没有限制
+	cgroupV1Unlimited = int64(1) << 62
+)
+
+// 获取当前进程所在 cgroup 的内存限制(字节), 支持 cgroup v1 和 v2, 没有限制或获取失败时返回 false
+func CgroupMemoryLimit() (int64, bool) {
+	return readCgroupMemoryLimit(procCgroupFile, cgroupRoot)
+}
+
+func readCgroupMemoryLimit(procCgroup, root string) (int64, bool) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	// 行格式为 hierarchy-ID:controller-list:cgroup-path, v2 的 controller-list 为空
+	var v1Path, v2Path string
+	var hasV1, hasV2 bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			v2Path, hasV2 = parts[2], true
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				v1Path, hasV1 = parts[2], true
+			}
+		}
+	}
+
+	// 同时存在时以 v1 的 memory 控制器为准
+	if hasV1 {
+		v, ok := readLimitFile(filepath.Join(root, "memory"), v1Path, "memory.limit_in_bytes")
+		if !ok || v >= cgroupV1Unlimited {
+			return 0, false
+		}
+		return v, true
+	}
+	if hasV2 {
+		return readLimitFile(root, v2Path, "memory.max")
+	}
+	return 0, false
+}
+
+// 读取限制文件, 在容器中 cgroup 路径可能不可见, 此时读取挂载目录下的文件
+func readLimitFile(mount, cgroupPath, name string) (int64, bool) {
+	bs, err := os.ReadFile(filepath.Join(mount, cgroupPath, name))
+	if err != nil {
+		bs, err = os.ReadFile(filepath.Join(mount, name))
+	}
+	if err != nil {
+		return 0, false
+	}
+	s := strings.TrimSpace(string(bs))
+	if s == "max" {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+func TestReadCgroupMemoryLimit(t *testing.T) {
+	dir := t.TempDir()
+	proc := filepath.Join(dir, "cgroup")
+	root := filepath.Join(dir, "fs")
+
+	// v2
+	writeFile(t, proc, "0::/app\n")
+	writeFile(t, filepath.Join(root, "app", "memory.max"), "1073741824\n")
+	limit, ok := readCgroupMemoryLimit(proc, root)
+	require.True(t, ok)
+	require.Equal(t, int64(1<<30), limit)
+
+	writeFile(t, filepath.Join(root, "app", "memory.max"), "max\n")
+	_, ok = readCgroupMemoryLimit(proc, root)
+	require.False(t, ok)
+
+	// v1 和 v2 混合时使用 v1, 路径不可见时读取挂载目录下的文件
+	writeFile(t, proc, "4:memory:/not/exists\n0::/\n")
+	writeFile(t, filepath.Join(root, "memory", "memory.limit_in_bytes"), "536870912\n")
+	limit, ok = readCgroupMemoryLimit(proc, root)
+	require.True(t, ok)
+	require.Equal(t, int64(1<<29), limit)
+
+	writeFile(t, filepath.Join(root, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	_, ok = readCgroupMemoryLimit(proc, root)
+	require.False(t, ok)
+
+	_, ok = readCgroupMemoryLimit(filepath.Join(dir, "not_exists"), root)
+	require.False(t, ok)
+}
@@ -0,0 +1,225 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime/debug"
+	rtmetrics "runtime/metrics"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/component/metrics"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/log"
+)
+
+const (
+	defMemoryLimitRatio      = 0.9
+	defMinGOGC               = 25
+	defMaxGOGC               = 200
+	defFreeMemoryWatermark   = 0.8
+	defFreeMemoryMinInterval = 60000
+	defCheckInterval         = 5000
+
+	// 堆内存占内存限制的比例不超过该值时 GOGC 使用最大值
+	gogcLowRatio = 0.5
+
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+)
+
+const (
+	metricsMemoryLimitBytes  = "memory_limit_bytes"      // 内存限制
+	metricsMemoryGOGC        = "memory_gogc"             // 当前的 GOGC
+	metricsMemoryHeapBytes   = "memory_heap_bytes"       // 堆内存
+	metricsMemoryRssBytes    = "memory_rss_bytes"        // 常驻内存
+	metricsMemoryFreeOSTotal = "memory_free_os_total"    // 释放内存次数
+	metricsMemoryGOMEMLIMIT  = "memory_gomemlimit_bytes" // 设置的 GOMEMLIMIT
+)
+
+/*
+内存管理器
+
+	启动时将 GOMEMLIMIT 设为 cgroup 内存限制的一定比例
+	定期根据堆内存占内存限制的比例动态调整 GOGC, 比例越高 GOGC 越小
+	常驻内存占内存限制的比例达到水位线时才释放内存
+*/
+type Manager struct {
+	conf  core.MemoryConfig
+	limit int64 // 用于计算比例的内存限制
+
+	// 获取内存数据, 可在测试中替换
+	heapBytes func() uint64
+	rssBytes  func() (uint64, error)
+	freeOS    func()
+	setGOGC   func(int) int
+
+	gogc     int
+	lastFree time.Time
+
+	limitGauge      metrics.IGauge
+	gomemlimitGauge metrics.IGauge
+	gogcGauge       metrics.IGauge
+	heapGauge       metrics.IGauge
+	rssGauge        metrics.IGauge
+	freeOSCounter   metrics.ICounter
+}
+
+// 创建内存管理器
+func NewManager(conf core.MemoryConfig) *Manager {
+	if conf.MemoryLimitRatio <= 0 || conf.MemoryLimitRatio > 1 {
+		conf.MemoryLimitRatio = defMemoryLimitRatio
+	}
+	if conf.MinGOGC <= 0 {
+		conf.MinGOGC = defMinGOGC
+	}
+	if conf.MaxGOGC < conf.MinGOGC {
+		conf.MaxGOGC = defMaxGOGC
+		if conf.MaxGOGC < conf.MinGOGC {
+			conf.MaxGOGC = conf.MinGOGC
+		}
+	}
+	if os.Getenv("GOGC") != "" { // 已通过环境变量设置 GOGC 时不动态调整
+		conf.DisableDynamicGOGC = true
+	}
+	if conf.FreeMemoryWatermark == 0 {
+		conf.FreeMemoryWatermark = defFreeMemoryWatermark
+	}
+	if conf.FreeMemoryMinInterval <= 0 {
+		conf.FreeMemoryMinInterval = defFreeMemoryMinInterval
+	}
+	if conf.CheckInterval <= 0 {
+		conf.CheckInterval = defCheckInterval
+	}
+
+	m := &Manager{
+		conf:      conf,
+		heapBytes: readHeapBytes,
+		freeOS:    debug.FreeOSMemory,
+		setGOGC:   debug.SetGCPercent,
+		gogc:      -1,
+
+		limitGauge:      metrics.RegistryGauge(metricsMemoryLimitBytes, "用于内存管理的内存限制", nil),
+		gomemlimitGauge: metrics.RegistryGauge(metricsMemoryGOMEMLIMIT, "内存管理设置的GOMEMLIMIT", nil),
+		gogcGauge:       metrics.RegistryGauge(metricsMemoryGOGC, "内存管理设置的GOGC", nil),
+		heapGauge:       metrics.RegistryGauge(metricsMemoryHeapBytes, "堆内存", nil),
+		rssGauge:        metrics.RegistryGauge(metricsMemoryRssBytes, "常驻内存", nil),
+		freeOSCounter:   metrics.RegistryCounter(metricsMemoryFreeOSTotal, "内存管理主动释放内存的次数", nil),
+	}
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	m.rssBytes = func() (uint64, error) {
+		if err != nil {
+			return 0, err
+		}
+		info, err := proc.MemoryInfo()
+		if err != nil {
+			return 0, err
+		}
+		return info.RSS, nil
+	}
+	return m
+}
+
+func readHeapBytes() uint64 {
+	sample := []rtmetrics.Sample{{Name: heapObjectsMetric}}
+	rtmetrics.Read(sample)
+	if sample[0].Value.Kind() != rtmetrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// 设置 GOMEMLIMIT 并确定用于计算比例的内存限制
+func (m *Manager) applyMemoryLimit() {
+	cgroupLimit, hasCgroupLimit := CgroupMemoryLimit()
+	if os.Getenv("GOMEMLIMIT") == "" && hasCgroupLimit {
+		limit := int64(float64(cgroupLimit) * m.conf.MemoryLimitRatio)
+		debug.SetMemoryLimit(limit)
+		m.gomemlimitGauge.Set(float64(limit), nil)
+		log.Log.Info("内存管理设置GOMEMLIMIT", zap.Int64("cgroupLimit", cgroupLimit), zap.Int64("GOMEMLIMIT", limit))
+	}
+
+	// 优先使用 cgroup 限制, 其次是 GOMEMLIMIT, 最后是系统内存
+	switch {
+	case hasCgroupLimit:
+		m.limit = cgroupLimit
+	case debug.SetMemoryLimit(-1) != math.MaxInt64:
+		m.limit = debug.SetMemoryLimit(-1)
+	default:
+		if vm, err := mem.VirtualMemory(); err == nil {
+			m.limit = int64(vm.Total)
+		}
+	}
+	m.limitGauge.Set(float64(m.limit), nil)
+}
+
+// 根据堆内存占内存限制的比例计算 GOGC
+func (m *Manager) calcGOGC(heap uint64) int {
+	ratio := float64(heap) / float64(m.limit)
+	high := m.conf.FreeMemoryWatermark
+	if high <= gogcLowRatio {
+		high = 1
+	}
+	switch {
+	case ratio <= gogcLowRatio:
+		return m.conf.MaxGOGC
+	case ratio >= high:
+		return m.conf.MinGOGC
+	}
+	p := (ratio - gogcLowRatio) / (high - gogcLowRatio)
+	return m.conf.MaxGOGC - int(math.Round(p*float64(m.conf.MaxGOGC-m.conf.MinGOGC)))
+}
+
+// 检查一次
+func (m *Manager) check() {
+	if m.limit <= 0 {
+		return
+	}
+
+	heap := m.heapBytes()
+	m.heapGauge.Set(float64(heap), nil)
+	if !m.conf.DisableDynamicGOGC {
+		if gogc := m.calcGOGC(heap); gogc != m.gogc {
+			m.setGOGC(gogc)
+			m.gogc = gogc
+			m.gogcGauge.Set(float64(gogc), nil)
+		}
+	}
+
+	rss, err := m.rssBytes()
+	if err != nil {
+		return
+	}
+	m.rssGauge.Set(float64(rss), nil)
+	if m.conf.FreeMemoryWatermark < 0 || float64(rss) < float64(m.limit)*m.conf.FreeMemoryWatermark {
+		return
+	}
+	if time.Since(m.lastFree) < time.Duration(m.conf.FreeMemoryMinInterval)*time.Millisecond {
+		return
+	}
+	m.lastFree = time.Now()
+	m.freeOS()
+	m.freeOSCounter.Inc(nil, nil)
+	log.Log.Info("常驻内存达到水位线, 已释放内存", zap.Uint64("rss", rss), zap.Int64("limit", m.limit))
+}
+
+// 开始内存管理, ctx结束后停止
+func (m *Manager) Start(ctx context.Context) {
+	m.applyMemoryLimit()
+	go func() {
+		t := time.NewTicker(time.Duration(m.conf.CheckInterval) * time.Millisecond)
+		defer t.Stop()
+		m.check()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				m.check()
+			}
+		}
+	}()
+}
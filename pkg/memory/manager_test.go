@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/core"
+)
+
+func TestCalcGOGC(t *testing.T) {
+	m := NewManager(core.MemoryConfig{DisableDynamicGOGC: true})
+	m.limit = 1000
+	require.Equal(t, 200, m.calcGOGC(100))
+	require.Equal(t, 200, m.calcGOGC(500))
+	require.Equal(t, 112, m.calcGOGC(650))
+	require.Equal(t, 25, m.calcGOGC(800))
+	require.Equal(t, 25, m.calcGOGC(2000))
+}
+
+func TestManagerCheck(t *testing.T) {
+	t.Setenv("GOGC", "")
+	m := NewManager(core.MemoryConfig{})
+	m.limit = 1000
+
+	var gogc []int
+	var freed int
+	heap, rss := uint64(100), uint64(100)
+	m.heapBytes = func() uint64 { return heap }
+	m.rssBytes = func() (uint64, error) { return rss, nil }
+	m.setGOGC = func(v int) int { gogc = append(gogc, v); return 100 }
+	m.freeOS = func() { freed++ }
+
+	m.check()
+	m.check() // GOGC 没有变化时不会重复设置
+	require.Equal(t, []int{200}, gogc)
+	require.Equal(t, 0, freed)
+
+	heap, rss = 900, 850
+	m.check()
+	require.Equal(t, []int{200, 25}, gogc)
+	require.Equal(t, 1, freed)
+
+	m.check() // 最小间隔内不会重复释放
+	require.Equal(t, 1, freed)
+}
@@ -0,0 +1,297 @@
+package zlog
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+// 缓冲区满时的策略
+const (
+	// 阻塞等待
+	OverflowBlock = "block"
+	// 丢弃最旧的日志
+	OverflowDropOldest = "drop_oldest"
+	// 优先丢弃debug和info日志, 没有时丢弃最旧的日志
+	OverflowDropLowLevel = "drop_low_level"
+)
+
+const (
+	defaultAsyncBufferSize    = 10000
+	defaultAsyncBatchSize     = 100
+	defaultAsyncFlushInterval = 200 // 毫秒
+)
+
+type asyncEntry struct {
+	level zapcore.Level
+	data  []byte
+}
+
+/*
+异步日志写入器
+
+	日志写入环形缓冲区, 由后台协程按批写入 ws, 写入 ws 的顺序和日志顺序一致
+*/
+type asyncWriter struct {
+	ws            zapcore.WriteSyncer
+	policy        string
+	batchSize     int
+	flushInterval time.Duration
+
+	mx      sync.Mutex
+	notFull *sync.Cond
+	buf     []asyncEntry // 环形缓冲区
+	head    int
+	size    int
+	closed  bool
+
+	writeMx sync.Mutex // 保证批次按顺序写入
+	wakeup  chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	dropped uint64
+}
+
+func newAsyncWriter(conf *core.LogConfig, ws zapcore.WriteSyncer) *asyncWriter {
+	bufSize := conf.AsyncBufferSize
+	if bufSize <= 0 {
+		bufSize = defaultAsyncBufferSize
+	}
+	batchSize := conf.AsyncBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultAsyncBatchSize
+	}
+	interval := conf.AsyncFlushInterval
+	if interval <= 0 {
+		interval = defaultAsyncFlushInterval
+	}
+	policy := strings.ToLower(conf.AsyncOverflowPolicy)
+	switch policy {
+	case OverflowDropOldest, OverflowDropLowLevel:
+	default:
+		policy = OverflowBlock
+	}
+
+	w := &asyncWriter{
+		ws:            ws,
+		policy:        policy,
+		batchSize:     batchSize,
+		flushInterval: time.Duration(interval) * time.Millisecond,
+		buf:           make([]asyncEntry, bufSize),
+		wakeup:        make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mx)
+	go w.loop()
+	return w
+}
+
+// 写入一条日志
+func (w *asyncWriter) Write(level zapcore.Level, data []byte) {
+	w.mx.Lock()
+	if w.closed { // 关闭后直接写入
+		w.mx.Unlock()
+		w.writeMx.Lock()
+		_, _ = w.ws.Write(data)
+		w.writeMx.Unlock()
+		return
+	}
+
+	if w.size == len(w.buf) {
+		switch w.policy {
+		case OverflowBlock:
+			for w.size == len(w.buf) && !w.closed {
+				w.notify()
+				w.notFull.Wait()
+			}
+		case OverflowDropOldest:
+			w.removeAt(0)
+		case OverflowDropLowLevel:
+			if level <= zapcore.InfoLevel { // 丢弃当前的低等级日志
+				atomic.AddUint64(&w.dropped, 1)
+				w.mx.Unlock()
+				return
+			}
+			w.removeAt(w.lowLevelIndex())
+		}
+	}
+	if w.closed {
+		w.mx.Unlock()
+		w.Write(level, data)
+		return
+	}
+
+	w.buf[(w.head+w.size)%len(w.buf)] = asyncEntry{level: level, data: data}
+	w.size++
+	full := w.size >= w.batchSize
+	w.mx.Unlock()
+	if full {
+		w.notify()
+	}
+}
+
+// 查找最旧的低等级日志的位置, 没有时返回0
+func (w *asyncWriter) lowLevelIndex() int {
+	for i := 0; i < w.size; i++ {
+		if w.buf[(w.head+i)%len(w.buf)].level <= zapcore.InfoLevel {
+			return i
+		}
+	}
+	return 0
+}
+
+// 移除缓冲区中第 i 条日志并计入丢弃数, 需要持有锁
+func (w *asyncWriter) removeAt(i int) {
+	n := len(w.buf)
+	for j := i; j > 0; j-- { // 将前面的日志后移, 保持顺序
+		w.buf[(w.head+j)%n] = w.buf[(w.head+j-1)%n]
+	}
+	w.buf[w.head] = asyncEntry{}
+	w.head = (w.head + 1) % n
+	w.size--
+	atomic.AddUint64(&w.dropped, 1)
+}
+
+func (w *asyncWriter) notify() {
+	select {
+	case w.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// 写入一批日志, 返回是否还有剩余日志
+func (w *asyncWriter) writeBatch() bool {
+	w.writeMx.Lock()
+	defer w.writeMx.Unlock()
+
+	w.mx.Lock()
+	n := w.size
+	if n > w.batchSize {
+		n = w.batchSize
+	}
+	if n == 0 {
+		w.mx.Unlock()
+		return false
+	}
+	var size int
+	for i := 0; i < n; i++ {
+		size += len(w.buf[(w.head+i)%len(w.buf)].data)
+	}
+	data := make([]byte, 0, size)
+	for i := 0; i < n; i++ {
+		idx := (w.head + i) % len(w.buf)
+		data = append(data, w.buf[idx].data...)
+		w.buf[idx] = asyncEntry{}
+	}
+	w.head = (w.head + n) % len(w.buf)
+	w.size -= n
+	remain := w.size > 0
+	w.notFull.Broadcast()
+	w.mx.Unlock()
+
+	_, _ = w.ws.Write(data)
+	return remain
+}
+
+// 将缓冲区中的日志全部写入 ws
+func (w *asyncWriter) writeAll() {
+	for w.writeBatch() {
+	}
+}
+
+// 将缓冲区中的日志全部写入 ws 并同步
+func (w *asyncWriter) Flush() error {
+	w.writeAll()
+	return w.ws.Sync()
+}
+
+func (w *asyncWriter) loop() {
+	defer close(w.done)
+	t := time.NewTicker(w.flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+		case <-w.wakeup:
+		}
+		w.writeAll()
+	}
+}
+
+// 关闭, 会写入缓冲区中所有日志, 关闭后的日志会同步写入
+func (w *asyncWriter) Close() error {
+	w.mx.Lock()
+	if w.closed {
+		w.mx.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	w.mx.Unlock()
+
+	close(w.stop)
+	<-w.done
+	return w.Flush()
+}
+
+// 丢弃的日志数
+func (w *asyncWriter) Dropped() uint64 { return atomic.LoadUint64(&w.dropped) }
+
+// 异步写入核心
+type asyncCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *asyncWriter
+}
+
+func newAsyncCore(enc zapcore.Encoder, w *asyncWriter, enab zapcore.LevelEnabler) zapcore.Core {
+	return &asyncCore{LevelEnabler: enab, enc: enc, w: w}
+}
+
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+	return &asyncCore{LevelEnabler: c.LevelEnabler, enc: enc, w: c.w}
+}
+
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	buf.Free()
+	c.w.Write(ent.Level, data)
+
+	// error以上等级的日志立即写入, 避免程序崩溃时丢失
+	if ent.Level >= zapcore.ErrorLevel {
+		c.w.writeAll()
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		_ = c.w.ws.Sync() // 和 zapcore.ioCore 一致, 忽略同步错误
+	}
+	return nil
+}
+
+func (c *asyncCore) Sync() error {
+	return c.w.Flush()
+}
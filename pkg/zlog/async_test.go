@@ -0,0 +1,118 @@
+package zlog
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+type testWriteSyncer struct {
+	mx    sync.Mutex
+	buf   bytes.Buffer
+	block chan struct{}
+}
+
+func (t *testWriteSyncer) Write(p []byte) (int, error) {
+	if t.block != nil {
+		<-t.block
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.buf.Write(p)
+}
+func (t *testWriteSyncer) Sync() error { return nil }
+func (t *testWriteSyncer) String() string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.buf.String()
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	ws := &testWriteSyncer{}
+	w := newAsyncWriter(&core.LogConfig{AsyncBatchSize: 3, AsyncFlushInterval: 60000}, ws)
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		w.Write(zapcore.InfoLevel, []byte(s))
+	}
+	require.NoError(t, w.Flush())
+	require.Equal(t, "abcde", ws.String())
+
+	require.NoError(t, w.Close())
+	w.Write(zapcore.InfoLevel, []byte("f")) // 关闭后同步写入
+	require.Equal(t, "abcdef", ws.String())
+}
+
+func TestAsyncWriterOverflow(t *testing.T) {
+	write := func(policy string, logs []string) (string, uint64) {
+		ws := &testWriteSyncer{block: make(chan struct{})}
+		w := newAsyncWriter(&core.LogConfig{AsyncBufferSize: 3, AsyncBatchSize: 100, AsyncFlushInterval: 60000, AsyncOverflowPolicy: policy}, ws)
+		for _, s := range logs {
+			level := zapcore.InfoLevel
+			if strings.HasPrefix(s, "E") {
+				level = zapcore.ErrorLevel
+			}
+			w.Write(level, []byte(s))
+		}
+		close(ws.block)
+		require.NoError(t, w.Close())
+		return ws.String(), w.Dropped()
+	}
+
+	out, dropped := write(OverflowDropOldest, []string{"a", "b", "c", "d", "e"})
+	require.Equal(t, "cde", out)
+	require.Equal(t, uint64(2), dropped)
+
+	out, dropped = write(OverflowDropLowLevel, []string{"a", "E1", "b", "c", "E2", "E3"})
+	require.Equal(t, "E1E2E3", out)
+	require.Equal(t, uint64(3), dropped)
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	ws := &testWriteSyncer{block: make(chan struct{})}
+	w := newAsyncWriter(&core.LogConfig{AsyncBufferSize: 2, AsyncBatchSize: 1, AsyncFlushInterval: 60000}, ws)
+
+	done := make(chan struct{})
+	go func() {
+		for _, s := range []string{"a", "b", "c", "d", "e"} {
+			w.Write(zapcore.InfoLevel, []byte(s))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("缓冲区满时没有阻塞")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(ws.block)
+	<-done
+	require.NoError(t, w.Close())
+	require.Equal(t, "abcde", ws.String())
+	require.Equal(t, uint64(0), w.Dropped())
+}
+
+func TestAsyncLogger(t *testing.T) {
+	conf := DefaultConfig
+	conf.WriteToStream = false
+	conf.Async = true
+	l := New(&conf)
+	ws := &testWriteSyncer{}
+	l.async[0].ws = ws
+
+	l.Info("info")
+	require.Equal(t, "", ws.String())
+	l.Error("error") // error日志会立即写入
+	out := ws.String()
+	require.Contains(t, out, "info")
+	require.Contains(t, out, "error")
+
+	l.Warn("warn")
+	require.NoError(t, Close(l))
+	require.Contains(t, ws.String(), "warn")
+}
@@ -0,0 +1,266 @@
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+const logModuleKey = "module"
+
+// 日志等级配置, 可用于运行时修改日志等级
+type LevelConfig struct {
+	Level      string            `json:"level,omitempty" yaml:"level"`           // 全局日志等级
+	TraceLevel string            `json:"traceLevel,omitempty" yaml:"traceLevel"` // 将日志附加到trace的等级
+	Modules    map[string]string `json:"modules,omitempty" yaml:"modules"`       // 模块日志等级, 值为空表示使用全局日志等级
+}
+
+// 模块日志等级
+type moduleLevel struct {
+	set   int32 // 是否设置了等级, 未设置时使用全局日志等级
+	level zap.AtomicLevel
+}
+
+/*
+日志等级控制
+
+	由同一个 New 创建的 logger 及其会话 logger 共享, 修改后立即对所有 logger 生效
+*/
+type levelControl struct {
+	level        zap.AtomicLevel
+	traceLevel   zap.AtomicLevel
+	traceEnabled int32 // TraceLevel 为空表示不附加日志到trace
+
+	mx      sync.RWMutex
+	modules map[string]*moduleLevel
+}
+
+func newLevelControl(conf *core.LogConfig) *levelControl {
+	c := &levelControl{
+		level:      zap.NewAtomicLevelAt(parserLogLevel(Level(conf.Level))),
+		traceLevel: zap.NewAtomicLevelAt(parserLogLevel(Level(conf.TraceLevel))),
+		modules:    make(map[string]*moduleLevel),
+	}
+	if conf.TraceLevel != "" {
+		c.traceEnabled = 1
+	}
+	for module, level := range conf.ModuleLevels {
+		if level == "" {
+			continue
+		}
+		c.getModule(module).setLevel(parserLogLevel(Level(level)))
+	}
+	return c
+}
+
+// 获取模块, 不存在时创建一个使用全局日志等级的模块
+func (c *levelControl) getModule(module string) *moduleLevel {
+	c.mx.RLock()
+	m, ok := c.modules[module]
+	c.mx.RUnlock()
+	if ok {
+		return m
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	m, ok = c.modules[module]
+	if !ok {
+		m = &moduleLevel{level: zap.NewAtomicLevel()}
+		c.modules[module] = m
+	}
+	return m
+}
+
+func (m *moduleLevel) setLevel(level zapcore.Level) {
+	m.level.SetLevel(level)
+	atomic.StoreInt32(&m.set, 1)
+}
+
+func (m *moduleLevel) reset() {
+	atomic.StoreInt32(&m.set, 0)
+}
+
+// 检查日志等级是否启用, m 为 nil 表示不属于任何模块
+func (c *levelControl) enabled(m *moduleLevel, level zapcore.Level) bool {
+	if m != nil && atomic.LoadInt32(&m.set) == 1 {
+		return m.level.Enabled(level)
+	}
+	return c.level.Enabled(level)
+}
+
+// 检查是否需要将日志附加到trace
+func (c *levelControl) traceEnabledFor(level zapcore.Level) bool {
+	return atomic.LoadInt32(&c.traceEnabled) == 1 && c.traceLevel.Enabled(level)
+}
+
+// 解析日志等级, 不存在的等级返回错误
+func parseLevelStrict(level string) (zapcore.Level, error) {
+	l, ok := levelMapping[Level(strings.ToLower(level))]
+	if !ok {
+		return 0, fmt.Errorf("日志等级<%s>不存在", level)
+	}
+	return l, nil
+}
+
+// 应用日志等级配置, 只会修改不为空的配置
+func (c *levelControl) apply(conf *LevelConfig) error {
+	// 先检查所有等级, 避免只应用了一部分
+	var err error
+	var level, traceLevel zapcore.Level
+	if conf.Level != "" {
+		if level, err = parseLevelStrict(conf.Level); err != nil {
+			return err
+		}
+	}
+	if conf.TraceLevel != "" {
+		if traceLevel, err = parseLevelStrict(conf.TraceLevel); err != nil {
+			return err
+		}
+	}
+	moduleLevels := make(map[string]zapcore.Level, len(conf.Modules))
+	for module, l := range conf.Modules {
+		if l == "" {
+			continue
+		}
+		if moduleLevels[module], err = parseLevelStrict(l); err != nil {
+			return err
+		}
+	}
+
+	if conf.Level != "" {
+		c.level.SetLevel(level)
+	}
+	if conf.TraceLevel != "" {
+		c.traceLevel.SetLevel(traceLevel)
+		atomic.StoreInt32(&c.traceEnabled, 1)
+	}
+	for module, l := range conf.Modules {
+		m := c.getModule(module)
+		if l == "" {
+			m.reset()
+			continue
+		}
+		m.setLevel(moduleLevels[module])
+	}
+	return nil
+}
+
+// 获取当前的日志等级配置
+func (c *levelControl) get() *LevelConfig {
+	conf := &LevelConfig{
+		Level:   string(levelMappingReverse[c.level.Level()]),
+		Modules: make(map[string]string),
+	}
+	if atomic.LoadInt32(&c.traceEnabled) == 1 {
+		conf.TraceLevel = string(levelMappingReverse[c.traceLevel.Level()])
+	}
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	for module, m := range c.modules {
+		if atomic.LoadInt32(&m.set) == 1 {
+			conf.Modules[module] = string(levelMappingReverse[m.level.Level()])
+		}
+	}
+	return conf
+}
+
+// 获取日志等级控制
+func getLevelControl(l interface{}) (*levelControl, error) {
+	switch a := l.(type) {
+	case *logCore:
+		return a.levels, nil
+	case *logWrap:
+		return a.levels, nil
+	}
+	return nil, fmt.Errorf("不支持的logger类型: %T", l)
+}
+
+/*
+模块字段, 创建会话logger时传入该字段, 会话logger会使用该模块的日志等级
+
+	log.NewSessionLogger(zlog.WithModule("redis"))
+
+也可以作为单条日志的字段传入, 此时只用于日志文件路由
+*/
+func WithModule(module string) zap.Field {
+	return zap.String(logModuleKey, module)
+}
+
+// 设置全局日志等级
+func SetLevel(l interface{}, level string) error {
+	return ApplyLevels(l, &LevelConfig{Level: level})
+}
+
+// 设置将日志附加到trace的等级
+func SetTraceLevel(l interface{}, level string) error {
+	return ApplyLevels(l, &LevelConfig{TraceLevel: level})
+}
+
+// 设置模块日志等级, level 为空表示使用全局日志等级
+func SetModuleLevel(l interface{}, module, level string) error {
+	return ApplyLevels(l, &LevelConfig{Modules: map[string]string{module: level}})
+}
+
+// 应用日志等级配置, 只会修改不为空的配置, 模块等级为空表示使用全局日志等级
+func ApplyLevels(l interface{}, conf *LevelConfig) error {
+	c, err := getLevelControl(l)
+	if err != nil {
+		return err
+	}
+	return c.apply(conf)
+}
+
+// 获取当前的日志等级配置
+func GetLevels(l interface{}) (*LevelConfig, error) {
+	c, err := getLevelControl(l)
+	if err != nil {
+		return nil, err
+	}
+	return c.get(), nil
+}
+
+/*
+日志等级的http处理器
+
+	GET 获取当前日志等级配置
+	PUT/POST 修改日志等级, body 为 LevelConfig 的json, 如 {"level":"debug","modules":{"redis":"warn"}}
+*/
+func LevelHandler(l interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := getLevelControl(l)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			conf := new(LevelConfig)
+			if err := json.NewDecoder(r.Body).Decode(conf); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := c.apply(conf); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c.get())
+	})
+}
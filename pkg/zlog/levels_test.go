@@ -0,0 +1,94 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+// 创建一个记录输出日志的logger
+func newTestLevelLogger(conf core.LogConfig) (*logWrap, func() []string) {
+	var mx sync.Mutex
+	var msgs []string
+	conf.WriteToStream = false
+	l := New(&conf, WithHook(func(ent *zapcore.Entry, fields []zapcore.Field) bool {
+		mx.Lock()
+		msgs = append(msgs, ent.Message)
+		mx.Unlock()
+		return true
+	}))
+	return l, func() []string {
+		mx.Lock()
+		defer mx.Unlock()
+		out := msgs
+		msgs = nil
+		return out
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	conf := DefaultConfig
+	conf.Level = "info"
+	conf.ModuleLevels = map[string]string{"redis": "error"}
+	l, msgs := newTestLevelLogger(conf)
+	redis := l.NewSessionLogger(WithModule("redis"))
+	mysql := l.NewSessionLogger(WithModule("mysql"))
+
+	l.Debug("d1")
+	l.Info("i1")
+	redis.Warn("redis-w1")
+	redis.Error("redis-e1")
+	mysql.Info("mysql-i1")
+	require.Equal(t, []string{"i1", "redis-e1", "mysql-i1"}, msgs())
+
+	require.NoError(t, SetLevel(l, "debug"))
+	require.NoError(t, SetModuleLevel(l, "mysql", "warn"))
+	require.NoError(t, SetModuleLevel(l, "redis", "")) // 恢复为全局日志等级
+	l.Debug("d2")
+	redis.Debug("redis-d2")
+	mysql.Info("mysql-i2")
+	mysql.NewTraceLogger(context.Background()).Info("mysql-i3") // 继承模块
+	require.Equal(t, []string{"d2", "redis-d2"}, msgs())
+
+	require.Error(t, SetLevel(l, "abc"))
+	require.Error(t, ApplyLevels(l, &LevelConfig{Level: "warn", Modules: map[string]string{"a": "abc"}}))
+	levels, err := GetLevels(l)
+	require.NoError(t, err)
+	require.Equal(t, &LevelConfig{Level: "debug", TraceLevel: "debug", Modules: map[string]string{"mysql": "warn"}}, levels)
+}
+
+func TestLevelHandler(t *testing.T) {
+	conf := DefaultConfig
+	conf.Level = "info"
+	conf.TraceLevel = ""
+	l, msgs := newTestLevelLogger(conf)
+	server := httptest.NewServer(LevelHandler(l))
+	defer server.Close()
+
+	rsp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"level":"warn","traceLevel":"error","modules":{"redis":"debug"}}`))
+	require.NoError(t, err)
+	levels := new(LevelConfig)
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(levels))
+	_ = rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, &LevelConfig{Level: "warn", TraceLevel: "error", Modules: map[string]string{"redis": "debug"}}, levels)
+
+	l.Info("i1")
+	l.Warn("w1")
+	l.NewSessionLogger(WithModule("redis")).Debug("redis-d1")
+	require.Equal(t, []string{"w1", "redis-d1"}, msgs())
+
+	rsp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"level":"abc"}`))
+	require.NoError(t, err)
+	_ = rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+}
@@ -33,14 +33,61 @@ var DefaultLogger = func() core.ILogger {
 
 func New(conf *core.LogConfig, opts ...zap.Option) *logWrap {
 	var encoder = makeEncoder(conf) // 编码器配置
-	var ws = makeWriteSyncer(conf)  // 输出合成器
+	var ws zapcore.WriteSyncer      // 输出合成器
 
 	opts = makeOpts(conf, opts...)
-	zapCore := zapcore.NewCore(encoder, ws, zapcore.DebugLevel)
+	var zapCore zapcore.Core
+	var async []*asyncWriter
+	newCore := func(ws zapcore.WriteSyncer) zapcore.Core {
+		if conf.Async {
+			w := newAsyncWriter(conf, ws)
+			async = append(async, w)
+			return newAsyncCore(encoder, w, zapcore.DebugLevel)
+		}
+		return zapcore.NewCore(encoder, ws, zapcore.DebugLevel)
+	}
+	if len(conf.Routes) > 0 {
+		zapCore, ws = makeRouteCore(conf, newCore)
+	} else {
+		ws = makeWriteSyncer(conf)
+		zapCore = newCore(ws)
+	}
+	sinkCores, sinks := makeSinkCores(conf) // 额外的输出
+	if len(sinkCores) > 0 {
+		zapCore = zapcore.NewTee(append([]zapcore.Core{zapCore}, sinkCores...)...)
+	}
+
+	// 折叠和采样放在拦截器外层, 拦截器只会收到实际输出的日志, 采样在Check时决定是否丢弃, 所以要放在最外层
+	var repeat *repeatCollapser
+	if conf.RepeatCollapseWindow > 0 {
+		repeat = newRepeatCollapser(time.Duration(conf.RepeatCollapseWindow) * time.Millisecond)
+		opts = append(opts, zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return &repeatCore{Core: c, r: repeat}
+		}))
+	}
+	if conf.SampleInitial > 0 {
+		opts = append(opts, zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newSamplerCore(c, conf)
+		}))
+	}
 	log := newLogCore(conf, zap.New(zapCore, opts...), ws)
+	log.sinks = sinks
+	log.async = async
+	log.repeat = repeat
+	log.redactor = makeRedactor(conf)
 	return newLogWrap(log)
 }
 
+// 创建脱敏器, 没有配置时返回nil
+func makeRedactor(conf *core.LogConfig) *Redactor {
+	r, err := NewRedactor(conf.RedactKeys, conf.RedactValues, conf.RedactMask)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "创建日志脱敏器失败: %v\n", err)
+		os.Exit(1)
+	}
+	return r
+}
+
 func makeEncoder(conf *core.LogConfig) zapcore.Encoder {
 	cfg := zapcore.EncoderConfig{
 		MessageKey:    "msg",
@@ -81,35 +128,53 @@ func makeEncoder(conf *core.LogConfig) zapcore.Encoder {
 func makeWriteSyncer(conf *core.LogConfig) zapcore.WriteSyncer {
 	var ws []zapcore.WriteSyncer
 	if conf.WriteToStream {
-		ws = append(ws, zapcore.AddSync(os.Stdout))
+		ws = append(ws, makeStreamWriteSyncer())
 	}
-
 	if conf.WriteToFile {
-		// 创建文件夹
-		err := os.MkdirAll(conf.Path, 666)
-		if err != nil {
-			fmt.Printf("无法创建日志目录: <%s>: %s\n", conf.Path, err)
-			os.Exit(1)
-		}
-
-		// 构建lumberjack的hook
-		name := conf.Name
-		if conf.AppendPid {
-			name = fmt.Sprintf("%s_%d", name, os.Getpid())
-		}
-		lumberjackHook := &lumberjack.Logger{
-			Filename:   fmt.Sprintf("%s/%s.log", conf.Path, name), // 日志文件路径
-			MaxSize:    conf.FileMaxSize,                          // 每个日志文件保存的最大尺寸 单位：M
-			MaxBackups: conf.FileMaxBackupsNum,                    // 日志文件最多保存多少个备份, 0表示永久
-			MaxAge:     conf.FileMaxDurableTime,                   // 文件最多保存多少天, 0表示永久
-			LocalTime:  true,
-			Compress:   conf.Compress, // 是否压缩
-		}
-		ws = append(ws, zapcore.Lock(zapcore.AddSync(lumberjackHook)))
+		ws = append(ws, makeFileWriteSyncer(conf))
 	}
 	return zapcore.NewMultiWriteSyncer(ws...)
 }
 
+// 屏幕输出
+func makeStreamWriteSyncer() zapcore.WriteSyncer {
+	return zapcore.AddSync(os.Stdout)
+}
+
+// 文件输出, 文件名为 conf.Name
+func makeFileWriteSyncer(conf *core.LogConfig) zapcore.WriteSyncer {
+	// 创建文件夹
+	err := os.MkdirAll(conf.Path, 666)
+	if err != nil {
+		fmt.Printf("无法创建日志目录: <%s>: %s\n", conf.Path, err)
+		os.Exit(1)
+	}
+
+	// 构建lumberjack的hook
+	name := conf.Name
+	if conf.AppendPid {
+		name = fmt.Sprintf("%s_%d", name, os.Getpid())
+	}
+	lumberjackHook := &lumberjack.Logger{
+		Filename:   fmt.Sprintf("%s/%s.log", conf.Path, name), // 日志文件路径
+		MaxSize:    conf.FileMaxSize,                          // 每个日志文件保存的最大尺寸 单位：M
+		MaxBackups: conf.FileMaxBackupsNum,                    // 日志文件最多保存多少个备份, 0表示永久
+		MaxAge:     conf.FileMaxDurableTime,                   // 文件最多保存多少天, 0表示永久
+		LocalTime:  true,
+		Compress:   conf.Compress, // 是否压缩
+
+		CompressType:    conf.CompressType,     // 压缩方式
+		RotateTime:      conf.FileRotateTime,   // 按时间轮转
+		FilenamePattern: conf.FileNamePattern,  // 文件名模板
+		MaxTotalSize:    conf.FileMaxTotalSize, // 历史日志总大小上限 单位：M
+	}
+	if err := lumberjackHook.Validate(); err != nil {
+		fmt.Printf("日志文件配置错误: %s\n", err)
+		os.Exit(1)
+	}
+	return zapcore.Lock(zapcore.AddSync(lumberjackHook))
+}
+
 func makeOpts(conf *core.LogConfig, o ...zap.Option) []zap.Option {
 	const callerSkipOffset = 3
 
@@ -48,10 +48,14 @@ type logCore struct {
 	conf           *core.LogConfig
 	log            *zap.Logger
 	fields         []zap.Field
-	level          zapcore.Level
+	levels         *levelControl
+	module         *moduleLevel // 模块日志等级, nil 表示使用全局日志等级
 	callerMinLevel zapcore.Level
-	traceLevel     zapcore.Level
 	ws             zapcore.WriteSyncer
+	sinks          []*AsyncSink
+	async          []*asyncWriter
+	repeat         *repeatCollapser
+	redactor       *Redactor
 }
 
 var _ core.ILogger = (*logCore)(nil)
@@ -61,9 +65,8 @@ func newLogCore(conf *core.LogConfig, log *zap.Logger, ws zapcore.WriteSyncer) *
 		conf:           conf,
 		log:            log,
 		fields:         nil,
-		level:          parserLogLevel(Level(conf.Level)),
+		levels:         newLevelControl(conf),
 		callerMinLevel: parserLogLevel(Level(conf.ShowFileAndLinenumMinLevel)),
-		traceLevel:     parserLogLevel(Level(conf.TraceLevel)),
 		ws:             ws,
 	}
 	return l
@@ -78,8 +81,15 @@ type logBody struct {
 }
 
 func (l *logCore) print(level Level, v []interface{}) {
-	body := l.makeBody(v)
 	zapLevel := parserLogLevel(level)
+	enabled := l.levels.enabled(l.module, zapLevel)
+	traceEnabled := l.levels.traceEnabledFor(zapLevel)
+	if !enabled && !traceEnabled { // 避免不输出的日志被计入采样
+		return
+	}
+
+	body := l.makeBody(v)
+	body.fields = l.redactor.RedactFields(body.fields)
 	ce := l.log.Check(zapLevel, body.msg)
 	if ce != nil {
 		if body.customCaller != nil {
@@ -89,13 +99,13 @@ func (l *logCore) print(level Level, v []interface{}) {
 			ce.Caller.Defined = true
 		}
 		ce.Caller.Defined = l.conf.ShowFileAndLinenumMinLevel != "" && zapLevel >= l.callerMinLevel
-		if zapLevel >= l.level {
+		if enabled {
 			ce.Write(body.fields...)
 		}
 	}
 
 	// 将log附到trace上
-	if l.conf.TraceLevel != "" && zapLevel >= l.traceLevel {
+	if traceEnabled {
 		l.attachLog2Trace(ce, body)
 	}
 }
@@ -245,10 +255,14 @@ func (l *logCore) NewSessionLogger(fields ...zap.Field) core.ILogger {
 		conf:           l.conf,
 		log:            l.log,
 		fields:         append(append(append([]zap.Field{}, l.fields...), zap.String(logIdKey, l.nextLoggerId())), fields...),
-		level:          l.level,
+		levels:         l.levels,
+		module:         l.getModule(fields),
 		callerMinLevel: l.callerMinLevel,
-		traceLevel:     l.traceLevel,
 		ws:             l.ws,
+		sinks:          l.sinks,
+		async:          l.async,
+		repeat:         l.repeat,
+		redactor:       l.redactor,
 	}
 }
 
@@ -259,11 +273,25 @@ func (l *logCore) NewTraceLogger(ctx context.Context, fields ...zap.Field) core.
 		conf:           l.conf,
 		log:            l.log,
 		fields:         append(append(append([]zap.Field{}, l.fields...), zap.String(logTraceIdKey, traceID)), fields...),
-		level:          l.level,
+		levels:         l.levels,
+		module:         l.getModule(fields),
 		callerMinLevel: l.callerMinLevel,
-		traceLevel:     l.traceLevel,
 		ws:             l.ws,
+		sinks:          l.sinks,
+		async:          l.async,
+		repeat:         l.repeat,
+		redactor:       l.redactor,
+	}
+}
+
+// 从字段中获取模块, 没有模块字段时继承当前模块
+func (l *logCore) getModule(fields []zap.Field) *moduleLevel {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == logModuleKey && fields[i].Type == zapcore.StringType {
+			return l.levels.getModule(fields[i].String)
+		}
 	}
+	return l.module
 }
 
 func (l *logCore) attachLog2Trace(ce *zapcore.CheckedEntry, body logBody) {
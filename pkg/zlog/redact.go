@@ -0,0 +1,190 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/pkg/utils"
+)
+
+const defaultRedactMask = "***"
+
+/*
+脱敏器
+
+	keys 需要脱敏的字段名或路径, 不区分大小写, 支持通配符 * 和 ?, 完整路径或字段名匹配时会将整个值替换为 mask
+		如 password 会匹配任意层级的 password 字段, *.idCard 会匹配任意对象下的 idCard 字段, user.card_no 只匹配 user 下的 card_no 字段
+		路径以 . 分隔, 数组不会产生路径
+	values 需要脱敏的值的正则, 字符串中匹配的部分会被替换为 mask, 如手机号 1[3-9]\d{9}
+	mask 替换后的值, 默认为 ***
+*/
+type Redactor struct {
+	exactKeys    map[string]struct{}
+	wildcardKeys []string
+	values       []*regexp.Regexp
+	mask         string
+}
+
+// 创建脱敏器, 没有任何规则时返回 nil, nil 脱敏器不会做任何处理
+func NewRedactor(keys, values []string, mask string) (*Redactor, error) {
+	r := &Redactor{
+		exactKeys: make(map[string]struct{}),
+		mask:      mask,
+	}
+	if r.mask == "" {
+		r.mask = defaultRedactMask
+	}
+	for _, k := range keys {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		if strings.ContainsAny(k, "*?") {
+			r.wildcardKeys = append(r.wildcardKeys, k)
+		} else {
+			r.exactKeys[k] = struct{}{}
+		}
+	}
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("脱敏正则<%s>无效: %v", v, err)
+		}
+		r.values = append(r.values, re)
+	}
+	if len(r.exactKeys) == 0 && len(r.wildcardKeys) == 0 && len(r.values) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// 检查字段是否需要脱敏, path 为完整路径, key 为字段名
+func (r *Redactor) matchKey(path, key string) bool {
+	path, key = strings.ToLower(path), strings.ToLower(key)
+	if _, ok := r.exactKeys[path]; ok {
+		return true
+	}
+	if _, ok := r.exactKeys[key]; ok {
+		return true
+	}
+	return utils.Text.IsMatchWildcardAny(path, r.wildcardKeys...) || utils.Text.IsMatchWildcardAny(key, r.wildcardKeys...)
+}
+
+// 对字符串中匹配值正则的部分脱敏
+func (r *Redactor) RedactString(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.values {
+		s = re.ReplaceAllString(s, r.mask)
+	}
+	return s
+}
+
+// 对解析后的json数据脱敏, path 为数据所在的路径
+func (r *Redactor) redactValue(path string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, vv := range t {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if r.matchKey(p, k) {
+				t[k] = r.mask
+				continue
+			}
+			t[k] = r.redactValue(p, vv)
+		}
+	case []interface{}:
+		for i, vv := range t {
+			t[i] = r.redactValue(path, vv)
+		}
+	case string:
+		return r.RedactString(t)
+	}
+	return v
+}
+
+// 对json脱敏, 无法解析时只对值脱敏
+func (r *Redactor) RedactJSON(data string) string {
+	if r == nil {
+		return data
+	}
+	out, err := r.redactJSON("", []byte(data))
+	if err != nil {
+		return r.RedactString(data)
+	}
+	return string(out)
+}
+
+func (r *Redactor) redactJSON(path string, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	v = r.redactValue(path, v)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// 对日志字段脱敏, 会直接修改 fields
+func (r *Redactor) RedactFields(fields []zap.Field) []zap.Field {
+	if r == nil {
+		return fields
+	}
+	for i, f := range fields {
+		if r.matchKey(f.Key, f.Key) {
+			fields[i] = zap.String(f.Key, r.mask)
+			continue
+		}
+		switch f.Type {
+		case zapcore.StringType:
+			fields[i].String = r.RedactString(f.String)
+		case zapcore.ErrorType, zapcore.StringerType:
+			if len(r.values) == 0 || f.Interface == nil {
+				continue
+			}
+			var s string
+			if err, ok := f.Interface.(error); ok {
+				s = err.Error()
+			} else if st, ok := f.Interface.(fmt.Stringer); ok {
+				s = st.String()
+			}
+			if rs := r.RedactString(s); rs != s {
+				fields[i] = zap.String(f.Key, rs)
+			}
+		case zapcore.ReflectType:
+			if f.Interface == nil {
+				continue
+			}
+			bs, err := json.Marshal(f.Interface)
+			if err != nil {
+				continue
+			}
+			out, err := r.redactJSON(f.Key, bs)
+			if err != nil {
+				continue
+			}
+			fields[i] = zap.Reflect(f.Key, json.RawMessage(out))
+		}
+	}
+	return fields
+}
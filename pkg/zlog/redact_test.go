@@ -0,0 +1,79 @@
+package zlog
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRedactJSON(t *testing.T) {
+	r, err := NewRedactor([]string{"password", "*.idCard", "user.card_no"}, []string{`1[3-9]\d{9}`}, "")
+	require.NoError(t, err)
+
+	in := `{"password":"123","user":{"name":"a","idCard":"110","card_no":"6222","phone":"13812345678"},"list":[{"idCard":"111","Password":"x"}],"card_no":"keep","id":12345678901234567890,"html":"<a>"}`
+	out := r.RedactJSON(in)
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &m))
+	require.Equal(t, "***", m["password"])
+	require.Equal(t, "keep", m["card_no"])
+	user := m["user"].(map[string]interface{})
+	require.Equal(t, "a", user["name"])
+	require.Equal(t, "***", user["idCard"])
+	require.Equal(t, "***", user["card_no"])
+	require.Equal(t, "***", user["phone"])
+	item := m["list"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, "***", item["idCard"]) // 数组不产生路径, list.idCard 匹配 *.idCard
+	require.Equal(t, "***", item["Password"])
+	require.Contains(t, out, `12345678901234567890`) // 数字保持原样
+	require.Contains(t, out, `"<a>"`)
+
+	// 无法解析的数据只对值脱敏
+	require.Equal(t, "phone=***", r.RedactJSON("phone=13812345678"))
+
+	// 没有规则时为nil
+	r, err = NewRedactor(nil, nil, "")
+	require.NoError(t, err)
+	require.Nil(t, r)
+	require.Equal(t, in, r.RedactJSON(in))
+
+	_, err = NewRedactor(nil, []string{"("}, "")
+	require.Error(t, err)
+}
+
+func TestRedactFields(t *testing.T) {
+	conf := DefaultConfig
+	conf.RedactKeys = []string{"password", "*.idCard"}
+	conf.RedactValues = []string{`1[3-9]\d{9}`}
+	conf.RedactMask = "#"
+
+	var fields []zapcore.Field
+	conf.WriteToStream = false
+	l := New(&conf, WithHook(func(ent *zapcore.Entry, fs []zapcore.Field) bool {
+		fields = fs
+		return true
+	}))
+	l.NewSessionLogger(zap.String("Password", "abc")).Info("msg",
+		zap.String("phone", "tel 13812345678"),
+		zap.Int("password", 1),
+		zap.Error(errors.New("user 13812345678 not found")),
+		zap.Any("user", map[string]interface{}{"name": "a", "idCard": "110"}),
+	)
+
+	got := make(map[string]interface{})
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	for k, v := range enc.Fields {
+		got[k] = v
+	}
+	require.Equal(t, "#", got["Password"])
+	require.Equal(t, "#", got["password"])
+	require.Equal(t, "tel #", got["phone"])
+	require.Equal(t, "user # not found", got["error"])
+	require.JSONEq(t, `{"name":"a","idCard":"#"}`, string(got["user"].(json.RawMessage)))
+}
@@ -0,0 +1,180 @@
+package zlog
+
+import (
+	"errors"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/pkg/utils"
+)
+
+// 日志文件路由
+type logRoute struct {
+	level     zapcore.Level
+	modules   []string
+	exclusive bool
+	core      zapcore.Core
+}
+
+// 检查日志是否匹配路由
+func (r *logRoute) match(level zapcore.Level, module string) bool {
+	if level < r.level {
+		return false
+	}
+	if len(r.modules) == 0 {
+		return true
+	}
+	return module != "" && utils.Text.IsMatchWildcardAny(module, r.modules...)
+}
+
+/*
+日志路由核心
+
+	屏幕输出不受路由影响, 匹配路由的日志会写入路由的文件, 没有匹配独占路由的日志会写入默认日志文件
+	模块来自 zlog.WithModule 设置的 module 字段
+*/
+type routeCore struct {
+	zapcore.LevelEnabler
+	stream zapcore.Core // 屏幕输出, 可能为nil
+	file   zapcore.Core // 默认日志文件, 可能为nil
+	routes []*logRoute
+	module string // 通过 With 添加的模块
+}
+
+// 根据配置创建路由核心, 返回核心和屏幕与默认日志文件的输出合成器
+func makeRouteCore(conf *core.LogConfig, newCore func(ws zapcore.WriteSyncer) zapcore.Core) (zapcore.Core, zapcore.WriteSyncer) {
+	var ws []zapcore.WriteSyncer
+	c := &routeCore{LevelEnabler: zapcore.DebugLevel}
+	if conf.WriteToStream {
+		streamWS := makeStreamWriteSyncer()
+		ws = append(ws, streamWS)
+		c.stream = newCore(streamWS)
+	}
+	if conf.WriteToFile {
+		fileWS := makeFileWriteSyncer(conf)
+		ws = append(ws, fileWS)
+		c.file = newCore(fileWS)
+	}
+
+	for _, routeConf := range conf.Routes {
+		fileConf := makeRouteFileConfig(conf, &routeConf)
+		level := zapcore.DebugLevel // 默认匹配所有等级
+		if routeConf.Level != "" {
+			level = parserLogLevel(Level(routeConf.Level))
+		}
+		c.routes = append(c.routes, &logRoute{
+			level:     level,
+			modules:   routeConf.Modules,
+			exclusive: routeConf.Exclusive,
+			core:      newCore(makeFileWriteSyncer(fileConf)),
+		})
+	}
+	return c, zapcore.NewMultiWriteSyncer(ws...)
+}
+
+// 生成路由的文件配置, 为0或空的配置使用 Log 的配置
+func makeRouteFileConfig(conf *core.LogConfig, routeConf *core.LogRouteConfig) *core.LogConfig {
+	fileConf := *conf
+	fileConf.Name = routeConf.Name
+	if routeConf.FileMaxSize > 0 {
+		fileConf.FileMaxSize = routeConf.FileMaxSize
+	}
+	if routeConf.FileMaxBackupsNum > 0 {
+		fileConf.FileMaxBackupsNum = routeConf.FileMaxBackupsNum
+	}
+	if routeConf.FileMaxDurableTime > 0 {
+		fileConf.FileMaxDurableTime = routeConf.FileMaxDurableTime
+	}
+	if routeConf.FileRotateTime != "" {
+		fileConf.FileRotateTime = routeConf.FileRotateTime
+	}
+	// 文件名模板不能和默认日志文件共用
+	fileConf.FileNamePattern = routeConf.FileNamePattern
+	if routeConf.FileMaxTotalSize > 0 {
+		fileConf.FileMaxTotalSize = routeConf.FileMaxTotalSize
+	}
+	if routeConf.CompressType != "" {
+		fileConf.CompressType = routeConf.CompressType
+	}
+	return &fileConf
+}
+
+// 从字段中获取模块
+func moduleFromFields(module string, fields []zapcore.Field) string {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == logModuleKey && fields[i].Type == zapcore.StringType {
+			return fields[i].String
+		}
+	}
+	return module
+}
+
+func (c *routeCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &routeCore{
+		LevelEnabler: c.LevelEnabler,
+		routes:       make([]*logRoute, len(c.routes)),
+		module:       moduleFromFields(c.module, fields),
+	}
+	if c.stream != nil {
+		clone.stream = c.stream.With(fields)
+	}
+	if c.file != nil {
+		clone.file = c.file.With(fields)
+	}
+	for i, r := range c.routes {
+		rr := *r
+		rr.core = r.core.With(fields)
+		clone.routes[i] = &rr
+	}
+	return clone
+}
+
+func (c *routeCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *routeCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var errs []error
+	if c.stream != nil {
+		if err := c.stream.Write(ent, fields); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	module := moduleFromFields(c.module, fields)
+	exclusive := false
+	for _, r := range c.routes {
+		if !r.match(ent.Level, module) {
+			continue
+		}
+		if err := r.core.Write(ent, fields); err != nil {
+			errs = append(errs, err)
+		}
+		exclusive = exclusive || r.exclusive
+	}
+
+	if c.file != nil && !exclusive {
+		if err := c.file.Write(ent, fields); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *routeCore) Sync() error {
+	var errs []error
+	if c.stream != nil {
+		errs = append(errs, c.stream.Sync())
+	}
+	if c.file != nil {
+		errs = append(errs, c.file.Sync())
+	}
+	for _, r := range c.routes {
+		errs = append(errs, r.core.Sync())
+	}
+	return errors.Join(errs...)
+}
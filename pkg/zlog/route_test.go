@@ -0,0 +1,60 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/core"
+)
+
+func TestRoutes(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		dir := t.TempDir()
+		conf := DefaultConfig
+		conf.WriteToStream = false
+		conf.WriteToFile = true
+		conf.Color = false
+		conf.Path = dir
+		conf.Name = "app"
+		conf.Async = async
+		conf.Level = "debug"
+		conf.Routes = []core.LogRouteConfig{
+			{Name: "error", Level: "error"},
+			{Name: "access", Modules: []string{"base.*"}, Exclusive: true},
+		}
+		l := New(&conf)
+
+		l.Info("info-msg")
+		l.Error("error-msg")
+		l.NewSessionLogger(WithModule("base.log")).Info("session-access-msg")
+		l.Info(WithModule("base.log"), "field-access-msg")
+		l.Debug(WithModule("base.log"), "debug-access-msg") // 路由未设置等级时匹配 debug
+		l.NewSessionLogger(WithModule("redis")).Info("redis-msg")
+		require.NoError(t, Close(l))
+
+		read := func(name string) string {
+			bs, err := os.ReadFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			return string(bs)
+		}
+
+		app := read("app.log")
+		require.Contains(t, app, "info-msg")
+		require.Contains(t, app, "error-msg")
+		require.Contains(t, app, "redis-msg")
+		require.NotContains(t, app, "access-msg") // 独占路由
+
+		errLog := read("error.log")
+		require.Contains(t, errLog, "error-msg")
+		require.NotContains(t, errLog, "info-msg")
+
+		access := read("access.log")
+		require.Contains(t, access, "session-access-msg")
+		require.Contains(t, access, "field-access-msg")
+		require.Contains(t, access, "debug-access-msg")
+		require.NotContains(t, access, "redis-msg")
+	}
+}
@@ -0,0 +1,188 @@
+package zlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/component/metrics"
+	"github.com/zly-app/zapp/core"
+)
+
+const (
+	defaultSampleTick = 1000 // 毫秒
+
+	metricsLogSuppressedTotal = "log_suppressed_total" // 被采样或折叠而没有输出的日志数
+
+	suppressReasonSample = "sample"
+	suppressReasonRepeat = "repeat"
+)
+
+// 日志在指标插件设置默认client之前就会输出, 所以使用跟随默认client的计数器
+var suppressedCounter = metrics.NewLazyCounter(metricsLogSuppressedTotal, "被采样或折叠而没有输出的日志数", nil, "level", "reason")
+
+// 记录被抑制的日志
+func reportSuppressed(level zapcore.Level, reason string, n int) {
+	suppressedCounter.Add(float64(n), metrics.Labels{"level": level.String(), "reason": reason}, nil)
+}
+
+/*
+采样, 相同等级和消息的日志在每个周期内前 first 条全部输出, 之后每 thereafter 条输出一条
+
+	thereafter 为 0 表示超过 first 后全部丢弃
+*/
+func newSamplerCore(c zapcore.Core, conf *core.LogConfig) zapcore.Core {
+	tick := conf.SampleTick
+	if tick <= 0 {
+		tick = defaultSampleTick
+	}
+	return zapcore.NewSamplerWithOptions(c, time.Duration(tick)*time.Millisecond, conf.SampleInitial, conf.SampleThereafter,
+		zapcore.SamplerHook(func(ent zapcore.Entry, dec zapcore.SamplingDecision) {
+			if dec&zapcore.LogDropped > 0 {
+				reportSuppressed(ent.Level, suppressReasonSample, 1)
+			}
+		}))
+}
+
+type repeatKey struct {
+	level zapcore.Level
+	msg   string
+}
+
+type repeatEntry struct {
+	start time.Time     // 窗口开始时间
+	count int           // 窗口内被折叠的日志数
+	last  zapcore.Entry // 最后一条被折叠的日志
+	core  zapcore.Core  // 最后一条被折叠的日志所在的核心, 输出汇总时会带上它的字段
+}
+
+/*
+重复日志折叠
+
+	在窗口内相同等级和消息的日志只输出第一条, 窗口结束后如果有被折叠的日志会输出一条 "消息 (repeated N times)" 的日志
+*/
+type repeatCollapser struct {
+	window  time.Duration
+	mx      sync.Mutex
+	entries map[repeatKey]*repeatEntry
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newRepeatCollapser(window time.Duration) *repeatCollapser {
+	r := &repeatCollapser{
+		window:  window,
+		entries: make(map[repeatKey]*repeatEntry),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// 检查日志是否需要折叠, 返回需要先输出的汇总日志
+func (r *repeatCollapser) collapse(c zapcore.Core, ent zapcore.Entry) (collapsed bool, summary *repeatEntry) {
+	key := repeatKey{level: ent.Level, msg: ent.Message}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	e, ok := r.entries[key]
+	if ok && ent.Time.Sub(e.start) < r.window {
+		e.count++
+		e.last = ent
+		e.core = c
+		return true, nil
+	}
+	if ok && e.count > 0 {
+		summary = e
+	}
+	r.entries[key] = &repeatEntry{start: ent.Time}
+	return false, summary
+}
+
+// 取出窗口已结束的日志
+func (r *repeatCollapser) expired(now time.Time) []*repeatEntry {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	var out []*repeatEntry
+	for key, e := range r.entries {
+		if now.Sub(e.start) < r.window {
+			continue
+		}
+		delete(r.entries, key)
+		if e.count > 0 {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// 输出汇总日志
+func (r *repeatCollapser) writeSummary(e *repeatEntry) {
+	ent := e.last
+	ent.Message = fmt.Sprintf("%s (repeated %d times)", ent.Message, e.count)
+	ent.Time = time.Now()
+	ent.Stack = ""
+	_ = e.core.Write(ent, []zapcore.Field{zap.Int("repeated", e.count)})
+}
+
+func (r *repeatCollapser) loop() {
+	defer close(r.done)
+	t := time.NewTicker(r.window)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-t.C:
+			for _, e := range r.expired(now) {
+				r.writeSummary(e)
+			}
+		}
+	}
+}
+
+// 关闭, 会输出所有汇总日志
+func (r *repeatCollapser) Close() {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+		for _, e := range r.expired(time.Now().Add(r.window)) {
+			r.writeSummary(e)
+		}
+	})
+}
+
+// 重复日志折叠核心
+type repeatCore struct {
+	zapcore.Core
+	r *repeatCollapser
+}
+
+func (c *repeatCore) With(fields []zapcore.Field) zapcore.Core {
+	return &repeatCore{Core: c.Core.With(fields), r: c.r}
+}
+
+func (c *repeatCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *repeatCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	collapsed, summary := c.r.collapse(c.Core, ent)
+	if collapsed {
+		reportSuppressed(ent.Level, suppressReasonRepeat, 1)
+		return nil
+	}
+	if summary != nil {
+		c.r.writeSummary(summary)
+	}
+	return c.Core.Write(ent, fields)
+}
@@ -0,0 +1,61 @@
+package zlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampling(t *testing.T) {
+	conf := DefaultConfig
+	conf.SampleInitial = 2
+	conf.SampleThereafter = 3
+	conf.SampleTick = 60000
+	l, msgs := newTestLevelLogger(conf)
+
+	for i := 0; i < 10; i++ {
+		l.Info("a")
+	}
+	l.Warn("a") // 不同等级分开采样
+	l.Info("b")
+	require.Equal(t, []string{"a", "a", "a", "a", "a", "b"}, msgs())
+}
+
+func TestRepeatCollapse(t *testing.T) {
+	conf := DefaultConfig
+	conf.RepeatCollapseWindow = 60000
+	l, msgs := newTestLevelLogger(conf)
+
+	for i := 0; i < 5; i++ {
+		l.Info("a")
+		l.Info("b")
+	}
+	l.NewSessionLogger().Error("a")
+	require.Equal(t, []string{"a", "b", "a"}, msgs())
+
+	require.NoError(t, Close(l))
+	out := msgs()
+	require.ElementsMatch(t, []string{"a (repeated 4 times)", "b (repeated 4 times)"}, out)
+}
+
+func TestRepeatCollapseWindow(t *testing.T) {
+	conf := DefaultConfig
+	conf.RepeatCollapseWindow = 500
+	l, msgs := newTestLevelLogger(conf)
+
+	l.Info("a")
+	l.Info("a")
+	l.Info("a")
+	require.Equal(t, []string{"a"}, msgs())
+
+	// 窗口结束后输出汇总
+	require.Eventually(t, func() bool {
+		out := msgs()
+		return len(out) == 1 && out[0] == "a (repeated 2 times)"
+	}, 3*time.Second, 10*time.Millisecond)
+
+	l.Info("a")
+	require.Equal(t, []string{"a"}, msgs())
+	require.NoError(t, Close(l))
+}
@@ -0,0 +1,299 @@
+package zlog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+const (
+	defaultSinkLevel         = InfoLevel
+	defaultSinkQueueSize     = 10000
+	defaultSinkBatchSize     = 100
+	defaultSinkFlushInterval = 1000 // 毫秒
+	defaultSinkTimeout       = 3000 // 毫秒
+	defaultSinkCloseTimeout  = 5 * time.Second
+	sinkErrPrintInterval     = time.Minute // 输出错误到stderr的最小间隔
+)
+
+// 编码后的日志
+type SinkEntry struct {
+	Level zapcore.Level
+	Time  time.Time
+	Data  []byte // 编码后的日志, 以换行结尾
+}
+
+// 日志传输, 由异步缓冲sink在后台协程中批量调用, 实现者不需要考虑并发
+type SinkTransport interface {
+	// 批量发送日志
+	Send(entries []*SinkEntry) error
+	// 关闭
+	Close() error
+}
+
+// sink创建者
+type SinkCreator func(conf *core.LogSinkConfig) (SinkTransport, error)
+
+var sinkCreators = map[string]SinkCreator{}
+
+// 注册sink类型, 重复注册会panic
+func RegistrySink(sinkType string, creator SinkCreator) {
+	sinkType = strings.ToLower(sinkType)
+	if _, ok := sinkCreators[sinkType]; ok {
+		panic(fmt.Sprintf("sink类型<%s>已存在", sinkType))
+	}
+	sinkCreators[sinkType] = creator
+}
+
+/*
+异步缓冲sink
+
+	写入时只会放入缓冲队列, 由后台协程批量发送, 队列满时会丢弃日志, 发送失败的日志也会被丢弃, 所以不会阻塞程序
+*/
+type AsyncSink struct {
+	transport     SinkTransport
+	queue         chan *SinkEntry
+	batchSize     int
+	flushInterval time.Duration
+
+	flushReq  chan chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+
+	dropped    uint64 // 丢弃的日志数
+	failed     uint64 // 发送失败的日志数
+	lastErrLog int64  // 最后输出错误的时间
+}
+
+/*
+创建异步缓冲sink
+
+	queueSize 缓冲队列大小
+	batchSize 批量发送的最大条数
+	flushInterval 批量发送的间隔时间
+*/
+func NewAsyncSink(transport SinkTransport, queueSize, batchSize int, flushInterval time.Duration) *AsyncSink {
+	if queueSize <= 0 {
+		queueSize = defaultSinkQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = defaultSinkBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Duration(defaultSinkFlushInterval) * time.Millisecond
+	}
+	s := &AsyncSink{
+		transport:     transport,
+		queue:         make(chan *SinkEntry, queueSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		flushReq:      make(chan chan struct{}),
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// 写入日志, 不会阻塞, 队列满或已关闭时丢弃并返回false
+func (s *AsyncSink) Write(entry *SinkEntry) bool {
+	select {
+	case <-s.closed:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	default:
+	}
+	select {
+	case s.queue <- entry:
+		return true
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+}
+
+// 丢弃的日志数
+func (s *AsyncSink) Dropped() uint64 { return atomic.LoadUint64(&s.dropped) }
+
+// 发送失败的日志数
+func (s *AsyncSink) Failed() uint64 { return atomic.LoadUint64(&s.failed) }
+
+// 立即发送缓冲中的日志, 最多等待 timeout
+func (s *AsyncSink) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	select {
+	case s.flushReq <- done:
+	case <-s.done:
+		return
+	case <-time.After(timeout):
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// 关闭, 会等待缓冲中的日志发送完毕, 最多等待 timeout
+func (s *AsyncSink) Close(timeout time.Duration) error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		return fmt.Errorf("等待sink关闭超时")
+	}
+	return s.transport.Close()
+}
+
+func (s *AsyncSink) loop() {
+	defer close(s.done)
+
+	batch := make([]*SinkEntry, 0, s.batchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.transport.Send(batch); err != nil {
+			atomic.AddUint64(&s.failed, uint64(len(batch)))
+			s.printErr(err)
+		}
+		batch = make([]*SinkEntry, 0, s.batchSize)
+	}
+	// 取出队列中已有的日志
+	drain := func() {
+		for {
+			select {
+			case e := <-s.queue:
+				batch = append(batch, e)
+				if len(batch) >= s.batchSize {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	t := time.NewTicker(s.flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case e := <-s.queue:
+			batch = append(batch, e)
+			if len(batch) >= s.batchSize {
+				send()
+			}
+		case <-t.C:
+			send()
+		case done := <-s.flushReq:
+			drain()
+			close(done)
+		case <-s.closed:
+			drain()
+			return
+		}
+	}
+}
+
+// 输出错误到stderr, 不能使用日志, 否则可能导致循环
+func (s *AsyncSink) printErr(err error) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&s.lastErrLog)
+	if now-last < int64(sinkErrPrintInterval) || !atomic.CompareAndSwapInt64(&s.lastErrLog, last, now) {
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "日志sink发送失败, 已丢弃 %d 条日志, 发送失败 %d 条日志: %v\n", s.Dropped(), s.Failed(), err)
+}
+
+// sink核心, 将日志编码后写入异步sink
+type sinkCore struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	sink *AsyncSink
+}
+
+func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+	return &sinkCore{LevelEnabler: c.LevelEnabler, enc: enc, sink: c.sink}
+}
+
+func (c *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sinkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.Enabled(ent.Level) { // 被 interceptor 包装时不会经过 Check
+		return nil
+	}
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	buf.Free()
+	c.sink.Write(&SinkEntry{Level: ent.Level, Time: ent.Time, Data: data})
+	return nil
+}
+
+// 异步发送, 这里不等待
+func (c *sinkCore) Sync() error { return nil }
+
+// 根据配置创建sink核心
+func makeSinkCores(conf *core.LogConfig) ([]zapcore.Core, []*AsyncSink) {
+	var cores []zapcore.Core
+	var sinks []*AsyncSink
+	for i := range conf.Sinks {
+		sinkConf := conf.Sinks[i]
+		if sinkConf.Tag == "" {
+			sinkConf.Tag = conf.Name
+		}
+		if sinkConf.Timeout <= 0 {
+			sinkConf.Timeout = defaultSinkTimeout
+		}
+
+		creator, ok := sinkCreators[strings.ToLower(sinkConf.Type)]
+		if !ok {
+			_, _ = fmt.Fprintf(os.Stderr, "日志sink类型<%s>不存在\n", sinkConf.Type)
+			os.Exit(1)
+		}
+		transport, err := creator(&sinkConf)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "创建日志sink<%s>失败: %v\n", sinkConf.Type, err)
+			os.Exit(1)
+		}
+
+		sink := NewAsyncSink(transport, sinkConf.QueueSize, sinkConf.BatchSize, time.Duration(sinkConf.FlushInterval)*time.Millisecond)
+		level := sinkConf.Level
+		if level == "" {
+			level = defaultSinkLevel
+		}
+		encConf := *conf
+		encConf.Json = strings.ToLower(sinkConf.Encoder) != "console"
+		encConf.Color = false
+		cores = append(cores, &sinkCore{
+			LevelEnabler: parserLogLevel(Level(level)),
+			enc:          makeEncoder(&encConf),
+			sink:         sink,
+		})
+		sinks = append(sinks, sink)
+	}
+	return cores, sinks
+}
@@ -0,0 +1,76 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zly-app/zapp/core"
+)
+
+const HttpSinkType = "http"
+
+func init() {
+	RegistrySink(HttpSinkType, newHttpSink)
+}
+
+// 将日志以换行分隔批量 POST 到 http 收集器
+type httpSink struct {
+	url         string
+	contentType string
+	headers     map[string]string
+	client      *http.Client
+}
+
+func newHttpSink(conf *core.LogSinkConfig) (SinkTransport, error) {
+	if conf.Address == "" {
+		return nil, fmt.Errorf("http sink 的 Address 不能为空")
+	}
+	s := &httpSink{
+		url:         conf.Address,
+		contentType: "application/x-ndjson",
+		headers:     conf.Headers,
+		client:      &http.Client{Timeout: time.Duration(conf.Timeout) * time.Millisecond},
+	}
+	if strings.ToLower(conf.Encoder) == "console" {
+		s.contentType = "text/plain; charset=utf-8"
+	}
+	return s, nil
+}
+
+func (s *httpSink) Send(entries []*SinkEntry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.Write(e.Data)
+		if len(e.Data) > 0 && e.Data[len(e.Data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return fmt.Errorf("http sink 收到错误的状态码: %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,113 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+const (
+	SyslogSinkType        = "syslog"
+	defaultSyslogAddress  = "/dev/log"
+	syslogFacilityUser    = 1 // user-level messages
+	syslogTimestampLayout = time.Stamp
+)
+
+func init() {
+	RegistrySink(SyslogSinkType, newSyslogSink)
+}
+
+// 通过unix socket写入本地syslog, 使用 RFC3164 格式
+type syslogSink struct {
+	address string
+	tag     string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func newSyslogSink(conf *core.LogSinkConfig) (SinkTransport, error) {
+	s := &syslogSink{
+		address: conf.Address,
+		tag:     conf.Tag,
+		timeout: time.Duration(conf.Timeout) * time.Millisecond,
+	}
+	if s.address == "" {
+		s.address = defaultSyslogAddress
+	}
+	if s.tag == "" {
+		s.tag = "zapp"
+	}
+	return s, nil
+}
+
+func (s *syslogSink) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		var conn net.Conn
+		conn, err = net.DialTimeout(network, s.address, s.timeout)
+		if err == nil {
+			s.conn = conn
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *syslogSink) Send(entries []*SinkEntry) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		if _, err := s.conn.Write(s.format(e)); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil // 下次发送时重连
+			return err
+		}
+	}
+	return nil
+}
+
+// 格式化为 <PRI>Mmm dd hh:mm:ss TAG[PID]: MSG
+func (s *syslogSink) format(e *SinkEntry) []byte {
+	pri := syslogFacilityUser*8 + syslogSeverity(e.Level)
+	msg := bytes.TrimRight(e.Data, "\n")
+	return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s\n", pri, e.Time.Format(syslogTimestampLayout), s.tag, os.Getpid(), msg))
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// 日志等级转为syslog的severity
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7 // debug
+	case zapcore.InfoLevel:
+		return 6 // info
+	case zapcore.WarnLevel:
+		return 4 // warning
+	case zapcore.ErrorLevel:
+		return 3 // err
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return 2 // crit
+	case zapcore.FatalLevel:
+		return 0 // emerg
+	}
+	return 5 // notice
+}
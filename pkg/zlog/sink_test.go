@@ -0,0 +1,132 @@
+package zlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/zly-app/zapp/core"
+)
+
+func TestHttpSink(t *testing.T) {
+	var mx sync.Mutex
+	var lines []map[string]interface{}
+	var batches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		require.Equal(t, "abc", r.Header.Get("X-Token"))
+		mx.Lock()
+		defer mx.Unlock()
+		batches++
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			m := make(map[string]interface{})
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+			lines = append(lines, m)
+		}
+	}))
+	defer server.Close()
+
+	conf := DefaultConfig
+	conf.WriteToStream = false
+	conf.Sinks = []core.LogSinkConfig{{
+		Type:          HttpSinkType,
+		Level:         "warn",
+		Address:       server.URL,
+		BatchSize:     2,
+		FlushInterval: 60000,
+		Headers:       map[string]string{"X-Token": "abc"},
+	}}
+	l := New(&conf)
+	l.Info("info")
+	l.Warn("warn1")
+	l.Error("error1")
+	l.Warn("warn2")
+	require.NoError(t, Close(l))
+
+	mx.Lock()
+	defer mx.Unlock()
+	require.Equal(t, 2, batches)
+	require.Len(t, lines, 3)
+	require.Equal(t, "warn1", lines[0]["msg"])
+	require.Equal(t, "error1", lines[1]["msg"])
+	require.Equal(t, "warn2", lines[2]["msg"])
+
+	// 关闭后不会再发送
+	l.Error("closed")
+	require.Len(t, lines, 3)
+}
+
+type blockTransport struct {
+	block chan struct{}
+	sent  int
+	mx    sync.Mutex
+}
+
+func (b *blockTransport) Send(entries []*SinkEntry) error {
+	<-b.block
+	b.mx.Lock()
+	b.sent += len(entries)
+	b.mx.Unlock()
+	return errors.New("send err")
+}
+func (b *blockTransport) Close() error { return nil }
+
+func TestAsyncSinkNotBlock(t *testing.T) {
+	tr := &blockTransport{block: make(chan struct{})}
+	sink := NewAsyncSink(tr, 2, 1, time.Hour)
+
+	// 发送被阻塞时写入不会阻塞, 超出队列的日志会被丢弃
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			sink.Write(&SinkEntry{Level: zapcore.InfoLevel, Data: []byte("a\n")})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("写入被阻塞")
+	}
+	require.GreaterOrEqual(t, sink.Dropped(), uint64(7))
+
+	close(tr.block)
+	require.NoError(t, sink.Close(time.Second))
+	require.Equal(t, uint64(10)-sink.Dropped(), sink.Failed())
+	tr.mx.Lock()
+	require.Equal(t, int(sink.Failed()), tr.sent)
+	tr.mx.Unlock()
+}
+
+func TestSyslogSink(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tr, err := newSyslogSink(&core.LogSinkConfig{Address: addr, Tag: "test", Timeout: 1000})
+	require.NoError(t, err)
+	defer tr.Close()
+	now := time.Now()
+	require.NoError(t, tr.Send([]*SinkEntry{{Level: zapcore.ErrorLevel, Time: now, Data: []byte("hello\n")}}))
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	require.True(t, strings.HasPrefix(msg, "<11>"+now.Format(time.Stamp)+" test["), msg)
+	require.True(t, strings.HasSuffix(msg, "]: hello\n"), msg)
+}
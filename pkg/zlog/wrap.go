@@ -2,6 +2,7 @@ package zlog
 
 import (
 	"context"
+	"errors"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -74,6 +75,57 @@ func GetLogWriteSyncer(l interface{}) (zapcore.WriteSyncer, bool) {
 	return nil, false
 }
 
+/*
+关闭log, 会输出重复日志的汇总, 写入异步缓冲区中的日志, 发送sink中缓冲的日志并关闭sink
+
+	关闭后的日志会同步写入屏幕和文件, 写入sink的日志会被丢弃
+*/
+func Close(l interface{}) error {
+	var a *logCore
+	switch t := l.(type) {
+	case *logCore:
+		a = t
+	case *logWrap:
+		a = t.logCore
+	default:
+		return nil
+	}
+	var errs []error
+	if a.repeat != nil {
+		a.repeat.Close()
+	}
+	for _, w := range a.async {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, sink := range a.sinks {
+		if err := sink.Close(defaultSinkCloseTimeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 获取异步写入时因缓冲区满丢弃的日志数
+func AsyncDropped(l interface{}) (uint64, bool) {
+	var async []*asyncWriter
+	switch a := l.(type) {
+	case *logCore:
+		async = a.async
+	case *logWrap:
+		async = a.async
+	}
+	if len(async) == 0 {
+		return 0, false
+	}
+	var dropped uint64
+	for _, w := range async {
+		dropped += w.Dropped()
+	}
+	return dropped, true
+}
+
 // 为log添加一些field
 func AddFields(l interface{}, fields ...zap.Field) bool {
 	switch a := l.(type) {
@@ -0,0 +1,100 @@
+package apollo_provider
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/config"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/log"
+)
+
+const (
+	// 表示整个命名空间的key, 获取到的数据为命名空间下所有配置的json, 如 {"a":"1","b":"2"}
+	NamespaceKey = "*"
+	// 非 properties 类型命名空间的内容所在的key
+	ContentKey = "content"
+)
+
+// 变更类型
+type ChangeType string
+
+const (
+	ChangeTypeAdded    ChangeType = "added"
+	ChangeTypeModified ChangeType = "modified"
+	ChangeTypeDeleted  ChangeType = "deleted"
+)
+
+// key的变更
+type KeyChange struct {
+	ChangeType ChangeType
+	OldValue   string
+	NewValue   string
+}
+
+// 命名空间回调, changes 的 key 为发生变更的配置key
+type NamespaceCallback func(namespace string, changes map[string]*KeyChange)
+
+// 对比命名空间数据
+func diffConfigurations(oldData, newData map[string]string) map[string]*KeyChange {
+	changes := make(map[string]*KeyChange)
+	for k, newValue := range newData {
+		oldValue, ok := oldData[k]
+		if !ok {
+			changes[k] = &KeyChange{ChangeType: ChangeTypeAdded, NewValue: newValue}
+			continue
+		}
+		if oldValue != newValue {
+			changes[k] = &KeyChange{ChangeType: ChangeTypeModified, OldValue: oldValue, NewValue: newValue}
+		}
+	}
+	for k, oldValue := range oldData {
+		if _, ok := newData[k]; !ok {
+			changes[k] = &KeyChange{ChangeType: ChangeTypeDeleted, OldValue: oldValue}
+		}
+	}
+	return changes
+}
+
+// 将命名空间数据序列化, json会对key排序, 所以相同的数据结果是一样的
+func marshalConfigurations(data map[string]string) []byte {
+	if data == nil {
+		data = map[string]string{}
+	}
+	bs, _ := json.Marshal(data)
+	return bs
+}
+
+// 根据命名空间名获取其数据格式和需要观察的key
+func namespaceFormat(namespace string) (config.StructType, string) {
+	switch ext := strings.ToLower(path.Ext(namespace)); ext {
+	case ".json":
+		return config.Json, ContentKey
+	case ".yaml", ".yml":
+		return config.Yaml, ContentKey
+	case ".txt":
+		return config.Txt, ContentKey
+	case ".xml":
+		log.Log.Fatal("不支持观察xml格式的命名空间", zap.String("namespace", namespace))
+	}
+	return config.Properties, NamespaceKey
+}
+
+/*
+观察整个命名空间并解析为结构体, 失败会fatal
+
+	根据命名空间的后缀选择解析方式:
+		.json          解析 content 的 json 数据
+		.yaml .yml     解析 content 的 yaml 数据
+		.txt           content 作为文本, T 必须为 *string 或 *[]byte
+		其它           作为 properties 解析, key中的 . 会被解析为层级, 值会按字段类型转换
+*/
+func WatchNamespace[T any](namespace string, opts ...core.ConfigWatchOption) core.IConfigWatchKeyStruct[T] {
+	structType, key := namespaceFormat(namespace)
+	opts = append([]core.ConfigWatchOption{config.WithWatchProvider(ProviderName)}, opts...)
+	opts = append(opts, config.WithWatchStructType(structType))
+	return config.WatchKeyStruct[T](namespace, key, opts...)
+}
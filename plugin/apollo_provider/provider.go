@@ -16,14 +16,17 @@ import (
 )
 
 // 观察失败等待时间
+//
+// Deprecated: 失败后会按apollo配置的 RetryMinInterval 和 RetryMaxInterval 退避重试, 该值不再生效
 var WatchErrWaitTime = time.Second * 5
 
 type ApolloProvider struct {
 	app    core.IApp
 	client *apollo_sdk.ApolloClient
 
-	watchNamespaces       map[string]int          // 观察的命名空间, value为notificationID
-	namespaceCallbackList map[string]KeyCallbacks // 命名空间回调列表
+	watchNamespaces       map[string]int                 // 观察的命名空间, value为notificationID
+	namespaceCallbackList map[string]KeyCallbacks        // 命名空间回调列表
+	namespaceWatchers     map[string][]NamespaceCallback // 整个命名空间的回调列表
 
 	watchCtx       context.Context
 	watchCtxCancel context.CancelFunc
@@ -50,13 +53,19 @@ func NewApolloProvider(app core.IApp) *ApolloProvider {
 	if err != nil {
 		app.Fatal("获取客户端失败", zap.Error(err))
 	}
+	p := newApolloProvider(app.BaseContext(), client)
+	p.app = app
+	return p
+}
+
+func newApolloProvider(ctx context.Context, client *apollo_sdk.ApolloClient) *ApolloProvider {
 	p := &ApolloProvider{
-		app:                   app,
 		client:                client,
 		watchNamespaces:       make(map[string]int),
 		namespaceCallbackList: make(map[string]KeyCallbacks),
+		namespaceWatchers:     make(map[string][]NamespaceCallback),
 	}
-	p.watchCtx, p.watchCtxCancel = context.WithCancel(app.BaseContext())
+	p.watchCtx, p.watchCtxCancel = context.WithCancel(ctx)
 	return p
 }
 
@@ -69,6 +78,9 @@ func (p *ApolloProvider) Get(groupName, keyName string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if keyName == NamespaceKey {
+		return marshalConfigurations(data.Configurations), nil
+	}
 	value, ok := data.Configurations[keyName]
 	if !ok {
 		return nil, fmt.Errorf("配置数据不存在 groupName: %s, keyName: %s", groupName, keyName)
@@ -86,7 +98,7 @@ func (p *ApolloProvider) Watch(groupName, keyName string, callback core.ConfigWa
 		return err
 	}
 	_, ok := data.Configurations[keyName]
-	if !ok {
+	if !ok && keyName != NamespaceKey {
 		return fmt.Errorf("配置数据不存在 groupName: %s, keyName: %s", groupName, keyName)
 	}
 
@@ -99,6 +111,36 @@ func (p *ApolloProvider) Watch(groupName, keyName string, callback core.ConfigWa
 	return nil
 }
 
+/*
+观察整个命名空间, 命名空间数据变更时会收到所有变更的key
+
+	和 Watch 一样, 回调只会在变更时触发, 启动时不会触发
+*/
+func (p *ApolloProvider) WatchNamespace(namespace string, callback NamespaceCallback) error {
+	if namespace == "" {
+		namespace = apollo_sdk.ApplicationNamespace
+	}
+	_, _, _, err := p.client.GetNamespaceData(namespace, false)
+	if err != nil {
+		return fmt.Errorf("获取命名空间<%s>数据失败: %v", namespace, err)
+	}
+
+	p.addWatchNamespace(namespace)
+	p.mx.Lock()
+	p.namespaceWatchers[namespace] = append(p.namespaceWatchers[namespace], callback)
+	p.mx.Unlock()
+	go p.startWatchNamespace()
+	return nil
+}
+
+// 获取命名空间的releaseKey作为版本号
+func (p *ApolloProvider) GetRevision(groupName, keyName string) string {
+	if groupName == "" {
+		groupName = apollo_sdk.ApplicationNamespace
+	}
+	return p.client.GetReleaseKey(groupName)
+}
+
 // 添加观察命名空间
 func (p *ApolloProvider) addWatchNamespace(namespace string) {
 	p.mx.Lock()
@@ -129,6 +171,7 @@ func (p *ApolloProvider) startWatchNamespace() {
 		return
 	}
 
+	failCount := 0 // 连续失败次数
 	for {
 		select {
 		case <-p.watchCtx.Done():
@@ -137,10 +180,17 @@ func (p *ApolloProvider) startWatchNamespace() {
 			param := p.makeNotificationParam()
 			rsp, err := p.client.WaitNotification(p.watchCtx, param)
 			if err != nil {
-				log.Log.Error("创建观察apollo通知失败", zap.Any("param", param), zap.Error(err))
-				time.Sleep(WatchErrWaitTime)
+				failCount++
+				waitTime := p.client.RetryInterval(failCount)
+				log.Log.Error("创建观察apollo通知失败", zap.Any("param", param), zap.Duration("waitTime", waitTime), zap.Error(err))
+				select {
+				case <-p.watchCtx.Done():
+					return
+				case <-time.After(waitTime):
+				}
 				continue
 			}
+			failCount = 0
 
 			// 解析通知结果
 			p.parseNotificationRsp(rsp)
@@ -180,7 +230,7 @@ func (p *ApolloProvider) parseNotificationRsp(rsp []*apollo_sdk.NotificationRsp)
 func (p *ApolloProvider) ReReqNamespaceData(namespace string) {
 	oldData, newData, changed, err := p.client.GetNamespaceData(namespace, true)
 	if err != nil {
-		p.app.Error("重新请求apollo命名空间数据失败", zap.String("namespace", namespace), zap.Error(err))
+		log.Log.Error("重新请求apollo命名空间数据失败", zap.String("namespace", namespace), zap.Error(err))
 		return
 	}
 	if !changed {
@@ -190,16 +240,32 @@ func (p *ApolloProvider) ReReqNamespaceData(namespace string) {
 	p.mx.Lock()
 	defer p.mx.Unlock()
 
+	// 整个命名空间的回调
+	if watchers := p.namespaceWatchers[namespace]; len(watchers) > 0 {
+		changes := diffConfigurations(oldData.Configurations, newData.Configurations)
+		if len(changes) > 0 {
+			for _, fn := range watchers {
+				go fn(namespace, changes)
+			}
+		}
+	}
+
 	// 获取回调函数列表, 遍历回调
 	keyCallbacks, ok := p.namespaceCallbackList[namespace]
 	if !ok {
 		return
 	}
 	for key, callbacks := range keyCallbacks {
-		oldVale := oldData.Configurations[key]
-		newValue := newData.Configurations[key]
+		var oldVale, newValue []byte
+		if key == NamespaceKey {
+			oldVale = marshalConfigurations(oldData.Configurations)
+			newValue = marshalConfigurations(newData.Configurations)
+		} else {
+			oldVale = []byte(oldData.Configurations[key])
+			newValue = []byte(newData.Configurations[key])
+		}
 		for _, fn := range callbacks {
-			go fn(namespace, key, []byte(oldVale), []byte(newValue))
+			go fn(namespace, key, oldVale, newValue)
 		}
 	}
 }
@@ -0,0 +1,81 @@
+package apollo_provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/config/apollo_sdk"
+)
+
+func newTestProvider(t *testing.T, s *apollo_sdk.FakeServer) *ApolloProvider {
+	client := &apollo_sdk.ApolloClient{
+		Address: s.URL,
+		AppId:   "test",
+	}
+	require.NoError(t, client.Init())
+	p := newApolloProvider(context.Background(), client)
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func TestWatchNamespace(t *testing.T) {
+	s := apollo_sdk.NewFakeServer()
+	defer s.Close()
+	s.SetLongPollTimeout(time.Millisecond * 200)
+	s.SetNamespace(apollo_sdk.DefaultCluster, "feature", map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	p := newTestProvider(t, s)
+
+	data, err := p.Get("feature", NamespaceKey)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":"1","b":"2","c":"3"}`, string(data))
+
+	changesCh := make(chan map[string]*KeyChange, 1)
+	err = p.WatchNamespace("feature", func(namespace string, changes map[string]*KeyChange) {
+		require.Equal(t, "feature", namespace)
+		changesCh <- changes
+	})
+	require.NoError(t, err)
+	dataCh := make(chan string, 1)
+	err = p.Watch("feature", NamespaceKey, func(groupName, keyName string, oldData, newData []byte) {
+		dataCh <- string(newData)
+	})
+	require.NoError(t, err)
+
+	s.SetNamespace(apollo_sdk.DefaultCluster, "feature", map[string]string{"a": "1", "b": "20", "d": "4"})
+	select {
+	case changes := <-changesCh:
+		require.Equal(t, map[string]*KeyChange{
+			"b": {ChangeType: ChangeTypeModified, OldValue: "2", NewValue: "20"},
+			"c": {ChangeType: ChangeTypeDeleted, OldValue: "3"},
+			"d": {ChangeType: ChangeTypeAdded, NewValue: "4"},
+		}, changes)
+	case <-time.After(time.Second * 3):
+		t.Fatal("等待命名空间变更超时")
+	}
+	select {
+	case v := <-dataCh:
+		require.Equal(t, `{"a":"1","b":"20","d":"4"}`, v)
+	case <-time.After(time.Second * 3):
+		t.Fatal("等待命名空间变更超时")
+	}
+
+	err = p.WatchNamespace("not_found", func(namespace string, changes map[string]*KeyChange) {})
+	require.Error(t, err)
+}
+
+func TestNamespaceFormat(t *testing.T) {
+	for namespace, want := range map[string][2]string{
+		"feature":      {"properties", NamespaceKey},
+		"feature.json": {"json", ContentKey},
+		"feature.yml":  {"yaml", ContentKey},
+		"feature.yaml": {"yaml", ContentKey},
+		"feature.txt":  {"txt", ContentKey},
+	} {
+		structType, key := namespaceFormat(namespace)
+		require.Equal(t, want, [2]string{string(structType), key}, namespace)
+	}
+}
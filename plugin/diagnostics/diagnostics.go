@@ -0,0 +1,125 @@
+package diagnostics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/log"
+)
+
+const (
+	defaultBind            = "127.0.0.1:6060"
+	defaultDumpDir         = "./log"
+	defaultCheckInterval   = 10000
+	defaultProfileDuration = 10000
+	defaultProfileCooldown = 300000
+	defaultCloseTimeout    = 5 * time.Second
+)
+
+type Config struct {
+	Bind              string // http监听地址, 默认 127.0.0.1:6060, 设为 - 表示不启动http服务
+	DumpDir           string // 协程栈和profile文件的存放路径, 默认为日志存放路径
+	DisableSignalDump bool   // 收到 SIGUSR1 信号时不写入协程栈和堆profile
+
+	CheckInterval   int     // 检查cpu和内存使用率的间隔时间(毫秒), 默认 10000
+	CpuThreshold    float64 // cpu使用率阈值(百分比, 按cpu核数平均), 超过时采集cpu profile, 0 表示不检查
+	MemoryThreshold float64 // 内存使用率阈值(百分比, 进程常驻内存占系统内存), 超过时采集堆profile, 0 表示不检查
+	ProfileDuration int     // 自动采集cpu profile的时长(毫秒), 默认 10000
+	ProfileCooldown int     // 同一类profile两次自动采集的最小间隔(毫秒), 默认 300000
+}
+
+func newConfig() *Config {
+	return &Config{}
+}
+
+func (c *Config) check() {
+	if c.Bind == "" {
+		c.Bind = defaultBind
+	}
+	if c.DumpDir == "" {
+		c.DumpDir = defaultDumpDir
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = defaultCheckInterval
+	}
+	if c.ProfileDuration <= 0 {
+		c.ProfileDuration = defaultProfileDuration
+	}
+	if c.ProfileCooldown <= 0 {
+		c.ProfileCooldown = defaultProfileCooldown
+	}
+}
+
+// 诊断插件
+type Diagnostics struct {
+	app      core.IApp
+	conf     *Config
+	server   *http.Server
+	profiler *profiler
+}
+
+// 创建诊断插件
+func NewDiagnostics(app core.IApp, conf *Config) *Diagnostics {
+	conf.check()
+	d := &Diagnostics{
+		app:      app,
+		conf:     conf,
+		profiler: newProfiler(app.Name(), conf.DumpDir),
+	}
+	if conf.Bind != "-" {
+		d.server = &http.Server{Handler: d.Handler()}
+	}
+	return d
+}
+
+// 诊断接口的http处理器, 包含 /debug/pprof/ 和 /debug/log/level
+func (d *Diagnostics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/log/level", log.LevelHandler())
+	return mux
+}
+
+func (d *Diagnostics) Inject(a ...interface{}) {}
+
+func (d *Diagnostics) Start() error {
+	ctx := d.app.BaseContext()
+	if d.server != nil {
+		ln, err := net.Listen("tcp", d.conf.Bind)
+		if err != nil {
+			return err
+		}
+		log.Log.Info("诊断服务启动", zap.String("bind", ln.Addr().String()))
+		go func() {
+			if err := d.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Log.Error("诊断服务异常退出", zap.Error(err))
+			}
+		}()
+	}
+	if !d.conf.DisableSignalDump {
+		watchSignal(ctx, d.profiler)
+	}
+	if d.conf.CpuThreshold > 0 || d.conf.MemoryThreshold > 0 {
+		go newMonitor(d.conf, d.profiler).run(ctx)
+	}
+	return nil
+}
+
+func (d *Diagnostics) Close() error {
+	if d.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	return d.server.Shutdown(ctx)
+}
@@ -0,0 +1,83 @@
+package diagnostics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	s := httptest.NewServer((&Diagnostics{}).Handler())
+	defer s.Close()
+
+	rsp, err := http.Get(s.URL + "/debug/pprof/goroutine?debug=1")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+}
+
+func TestProfiler(t *testing.T) {
+	p := newProfiler("test", t.TempDir())
+
+	path, err := p.dumpGoroutines()
+	require.NoError(t, err)
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "TestProfiler")
+
+	path, err = p.dumpHeap()
+	require.NoError(t, err)
+	require.Equal(t, ".pprof", filepath.Ext(path))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type captureResult struct {
+		path string
+		err  error
+	}
+	done := make(chan captureResult, 1)
+	go func() {
+		path, err := p.captureCpu(ctx, time.Hour)
+		done <- captureResult{path: path, err: err}
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&p.cpuRunning) == 1 }, time.Second, time.Millisecond)
+	_, err = p.captureCpu(ctx, time.Millisecond) // 同时只能有一个采集
+	require.Error(t, err)
+	cancel() // ctx结束时停止采集
+	result := <-done
+	require.NoError(t, result.err)
+	info, err := os.Stat(result.path)
+	require.NoError(t, err)
+	require.NotZero(t, info.Size())
+}
+
+func TestMonitor(t *testing.T) {
+	dir := t.TempDir()
+	conf := &Config{CpuThreshold: 80, MemoryThreshold: 50, ProfileDuration: 10}
+	conf.check()
+	m := newMonitor(conf, newProfiler("test", dir))
+	cpu, memory := 10.0, 60.0
+	m.cpuPercent = func() (float64, error) { return cpu, nil }
+	m.memoryPercent = func() (float64, error) { return memory, nil }
+
+	countFiles := func(pattern string) int {
+		files, err := filepath.Glob(filepath.Join(dir, pattern))
+		require.NoError(t, err)
+		return len(files)
+	}
+
+	m.check(context.Background())
+	require.Equal(t, 1, countFiles("test.heap.*"))
+	require.Equal(t, 0, countFiles("test.cpu.*"))
+
+	cpu = 90
+	m.check(context.Background())
+	require.Equal(t, 1, countFiles("test.heap.*")) // 冷却时间内不会重复采集
+	require.Eventually(t, func() bool { return countFiles("test.cpu.*") == 1 && atomic.LoadInt32(&m.profiler.cpuRunning) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,114 @@
+package diagnostics
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/log"
+)
+
+// 定期检查cpu和内存使用率, 超过阈值时自动采集profile
+type monitor struct {
+	conf     *Config
+	profiler *profiler
+	proc     *process.Process
+
+	// 获取使用率, 可在测试中替换
+	cpuPercent    func() (float64, error)
+	memoryPercent func() (float64, error)
+
+	lastCpu  time.Time
+	lastHeap time.Time
+}
+
+func newMonitor(conf *Config, p *profiler) *monitor {
+	m := &monitor{conf: conf, profiler: p}
+	m.proc, _ = process.NewProcess(int32(os.Getpid()))
+	m.cpuPercent = m.processCpuPercent
+	m.memoryPercent = m.processMemoryPercent
+	return m
+}
+
+// 进程cpu使用率, 按cpu核数平均
+func (m *monitor) processCpuPercent() (float64, error) {
+	if m.proc == nil {
+		return 0, os.ErrNotExist
+	}
+	v, err := m.proc.Percent(0) // 自上次调用以来的使用率
+	if err != nil {
+		return 0, err
+	}
+	return v / float64(runtime.NumCPU()), nil
+}
+
+// 进程常驻内存占系统内存的百分比
+func (m *monitor) processMemoryPercent() (float64, error) {
+	if m.proc == nil {
+		return 0, os.ErrNotExist
+	}
+	info, err := m.proc.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	if vm.Total == 0 {
+		return 0, nil
+	}
+	return float64(info.RSS) / float64(vm.Total) * 100, nil
+}
+
+func (m *monitor) run(ctx context.Context) {
+	_, _ = m.cpuPercent() // 初始化cpu使用率的计算起点
+
+	t := time.NewTicker(time.Duration(m.conf.CheckInterval) * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.check(ctx)
+		}
+	}
+}
+
+// 检查一次使用率
+func (m *monitor) check(ctx context.Context) {
+	now := time.Now()
+	cooldown := time.Duration(m.conf.ProfileCooldown) * time.Millisecond
+
+	if m.conf.CpuThreshold > 0 && now.Sub(m.lastCpu) >= cooldown {
+		if v, err := m.cpuPercent(); err == nil && v >= m.conf.CpuThreshold {
+			m.lastCpu = now
+			go func() {
+				path, err := m.profiler.captureCpu(ctx, time.Duration(m.conf.ProfileDuration)*time.Millisecond)
+				if err != nil {
+					log.Log.Error("自动采集cpu profile失败", zap.Float64("cpuPercent", v), zap.Error(err))
+					return
+				}
+				log.Log.Warn("cpu使用率超过阈值, 已采集cpu profile", zap.Float64("cpuPercent", v), zap.String("path", path))
+			}()
+		}
+	}
+
+	if m.conf.MemoryThreshold > 0 && now.Sub(m.lastHeap) >= cooldown {
+		if v, err := m.memoryPercent(); err == nil && v >= m.conf.MemoryThreshold {
+			m.lastHeap = now
+			path, err := m.profiler.dumpHeap()
+			if err != nil {
+				log.Log.Error("自动采集堆profile失败", zap.Float64("memoryPercent", v), zap.Error(err))
+				return
+			}
+			log.Log.Warn("内存使用率超过阈值, 已采集堆profile", zap.Float64("memoryPercent", v), zap.String("path", path))
+		}
+	}
+}
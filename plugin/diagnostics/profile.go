@@ -0,0 +1,91 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// profile类型
+const (
+	ProfileGoroutine = "goroutine"
+	ProfileHeap      = "heap"
+	ProfileCpu       = "cpu"
+)
+
+// 将协程栈和profile写入文件
+type profiler struct {
+	name       string
+	dir        string
+	cpuRunning int32
+}
+
+func newProfiler(name, dir string) *profiler {
+	return &profiler{name: name, dir: dir}
+}
+
+// 生成文件路径, 如 log/myapp.heap.20060102-150405.000.123.pprof
+func (p *profiler) makePath(kind, ext string) string {
+	name := fmt.Sprintf("%s.%s.%s.%d.%s", p.name, kind, time.Now().Format("20060102-150405.000"), os.Getpid(), ext)
+	return filepath.Join(p.dir, name)
+}
+
+func (p *profiler) create(kind, ext string) (*os.File, error) {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(p.makePath(kind, ext))
+}
+
+// 写入所有协程栈, 返回文件路径
+func (p *profiler) dumpGoroutines() (string, error) {
+	f, err := p.create(ProfileGoroutine, "txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return f.Name(), pprof.Lookup("goroutine").WriteTo(f, 2)
+}
+
+// 写入堆profile, 返回文件路径
+func (p *profiler) dumpHeap() (string, error) {
+	f, err := p.create(ProfileHeap, "pprof")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	runtime.GC() // 获取最新的统计数据
+	return f.Name(), pprof.Lookup("heap").WriteTo(f, 0)
+}
+
+// 采集cpu profile, 会阻塞到采集结束或ctx结束, 同时只能有一个采集, 返回文件路径
+func (p *profiler) captureCpu(ctx context.Context, duration time.Duration) (string, error) {
+	if !atomic.CompareAndSwapInt32(&p.cpuRunning, 0, 1) {
+		return "", fmt.Errorf("cpu profile is running")
+	}
+	defer atomic.StoreInt32(&p.cpuRunning, 0)
+
+	f, err := p.create(ProfileCpu, "pprof")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err = pprof.StartCPUProfile(f); err != nil { // 可能已经通过 /debug/pprof/profile 在采集
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+
+	t := time.NewTimer(duration)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	pprof.StopCPUProfile()
+	return f.Name(), nil
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package diagnostics
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/log"
+)
+
+// 收到 SIGUSR1 信号时写入协程栈和堆profile, ctx结束后停止
+func watchSignal(ctx context.Context, p *profiler) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				dumpOnSignal(p)
+			}
+		}
+	}()
+}
+
+func dumpOnSignal(p *profiler) {
+	if path, err := p.dumpGoroutines(); err != nil {
+		log.Log.Error("写入协程栈失败", zap.Error(err))
+	} else {
+		log.Log.Warn("已写入协程栈", zap.String("path", path))
+	}
+	if path, err := p.dumpHeap(); err != nil {
+		log.Log.Error("写入堆profile失败", zap.Error(err))
+	} else {
+		log.Log.Warn("已写入堆profile", zap.String("path", path))
+	}
+}
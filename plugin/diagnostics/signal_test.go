@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package diagnostics
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchSignal(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchSignal(ctx, newProfiler("test", dir))
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	require.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "test.*"))
+		return len(files) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
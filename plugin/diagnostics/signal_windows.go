@@ -0,0 +1,8 @@
+package diagnostics
+
+import (
+	"context"
+)
+
+// windows 不支持 SIGUSR1
+func watchSignal(ctx context.Context, p *profiler) {}
@@ -0,0 +1,37 @@
+package diagnostics
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/plugin"
+)
+
+// 默认插件类型
+const DefaultPluginType core.PluginType = "diagnostics"
+
+func init() {
+	plugin.RegisterCreatorFunc(DefaultPluginType, func(app core.IApp) core.IPlugin {
+		conf := newConfig()
+		err := app.GetConfig().ParsePluginConfig(DefaultPluginType, conf, true)
+		if err != nil {
+			app.Fatal("解析diagnostics插件配置失败", zap.Error(err))
+		}
+		if conf.DumpDir == "" {
+			conf.DumpDir = app.GetConfig().Config().Frame.Log.Path
+		}
+		return NewDiagnostics(app, conf)
+	})
+}
+
+/*
+启用诊断插件
+
+	提供 pprof 和日志等级的http接口
+	收到 SIGUSR1 信号时将协程栈和堆profile写入日志目录
+	cpu或内存使用率超过阈值时自动采集profile
+*/
+func WithPlugin() zapp.Option {
+	return zapp.WithPlugin(DefaultPluginType)
+}
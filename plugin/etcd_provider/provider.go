@@ -0,0 +1,237 @@
+package etcd_provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/config/etcd_sdk"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/log"
+)
+
+// 观察失败等待时间
+var WatchErrWaitTime = time.Second * 5
+
+type Config struct {
+	Address              string // etcd网关地址, 多个地址用英文逗号连接, 如 http://127.0.0.1:2379
+	User                 string // 用户名
+	Password             string // 密码
+	Prefix               string // key前缀, 完整的key为 Prefix + groupName + "/" + keyName
+	AlwaysLoadFromRemote bool   // 总是从远程获取, 在远程加载失败时不会从备份文件加载
+	BackupFile           string // 备份文件名
+}
+
+type EtcdProvider struct {
+	client *etcd_sdk.EtcdClient
+
+	watchKeys map[string]*watchKey // 观察的key
+
+	watchCtx       context.Context
+	watchCtxCancel context.CancelFunc
+
+	mx sync.Mutex // 用于锁 watchKeys
+}
+
+// 观察的key
+type watchKey struct {
+	groupName string
+	keyName   string
+	revision  int64  // 最后收到的版本
+	data      []byte // 最后收到的数据
+	callbacks []core.ConfigWatchProviderCallback
+}
+
+func (p *EtcdProvider) Inject(a ...interface{}) {}
+func (p *EtcdProvider) Start() error {
+	return nil
+}
+func (p *EtcdProvider) Close() error {
+	p.watchCtxCancel()
+	return nil
+}
+
+func NewEtcdProvider(ctx context.Context, conf *Config) (*EtcdProvider, error) {
+	client := &etcd_sdk.EtcdClient{
+		Address:              conf.Address,
+		User:                 conf.User,
+		Password:             conf.Password,
+		Prefix:               conf.Prefix,
+		AlwaysLoadFromRemote: conf.AlwaysLoadFromRemote,
+		BackupFile:           conf.BackupFile,
+	}
+	if err := client.Init(); err != nil {
+		return nil, err
+	}
+
+	p := &EtcdProvider{
+		client:    client,
+		watchKeys: make(map[string]*watchKey),
+	}
+	p.watchCtx, p.watchCtxCancel = context.WithCancel(ctx)
+	return p, nil
+}
+
+func makeKey(groupName, keyName string) string {
+	if groupName == "" {
+		return keyName
+	}
+	return groupName + "/" + keyName
+}
+
+// 获取
+func (p *EtcdProvider) Get(groupName, keyName string) ([]byte, error) {
+	data, err := p.client.Get(p.watchCtx, makeKey(groupName, keyName))
+	if err == os.ErrNotExist {
+		return nil, fmt.Errorf("配置数据不存在 groupName: %s, keyName: %s", groupName, keyName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data.Value), nil
+}
+
+// watch
+func (p *EtcdProvider) Watch(groupName, keyName string, callback core.ConfigWatchProviderCallback) error {
+	key := makeKey(groupName, keyName)
+
+	p.mx.Lock()
+	w, ok := p.watchKeys[key]
+	if ok {
+		w.callbacks = append(w.callbacks, callback)
+		p.mx.Unlock()
+		return nil
+	}
+	p.mx.Unlock()
+
+	data, err := p.client.Get(p.watchCtx, key)
+	if err == os.ErrNotExist {
+		return fmt.Errorf("配置数据不存在 groupName: %s, keyName: %s", groupName, keyName)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if w, ok = p.watchKeys[key]; ok { // 并发添加
+		w.callbacks = append(w.callbacks, callback)
+		return nil
+	}
+	w = &watchKey{
+		groupName: groupName,
+		keyName:   keyName,
+		revision:  data.Revision,
+		data:      []byte(data.Value),
+		callbacks: []core.ConfigWatchProviderCallback{callback},
+	}
+	p.watchKeys[key] = w
+	go p.startWatchKey(key, w)
+	return nil
+}
+
+// 获取key最后收到的版本号, 未观察的key返回空
+func (p *EtcdProvider) GetRevision(groupName, keyName string) string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	w, ok := p.watchKeys[makeKey(groupName, keyName)]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(w.revision, 10)
+}
+
+// 开始观察key, 断开后会从最后收到的版本继续观察
+func (p *EtcdProvider) startWatchKey(key string, w *watchKey) {
+	for {
+		select {
+		case <-p.watchCtx.Done():
+			return
+		default:
+		}
+
+		p.mx.Lock()
+		startRevision := w.revision + 1
+		p.mx.Unlock()
+
+		err := p.client.Watch(p.watchCtx, key, startRevision, func(ev *etcd_sdk.WatchEvent) {
+			p.onEvent(key, w, ev)
+		})
+		if p.watchCtx.Err() != nil {
+			return
+		}
+		var compactedErr *etcd_sdk.CompactedError
+		if errors.As(err, &compactedErr) {
+			// 版本已被压缩, 重新获取数据后从压缩的版本开始观察
+			log.Log.Warn("etcd watch版本已被压缩, 重新获取数据", zap.String("key", key), zap.Int64("startRevision", startRevision))
+			p.reloadKey(key, w)
+			p.mx.Lock()
+			if w.revision < compactedErr.CompactRevision-1 {
+				w.revision = compactedErr.CompactRevision - 1
+			}
+			p.mx.Unlock()
+			continue
+		}
+
+		log.Log.Error("观察etcd的key失败", zap.String("key", key), zap.Int64("startRevision", startRevision), zap.Error(err))
+		select {
+		case <-p.watchCtx.Done():
+			return
+		case <-time.After(WatchErrWaitTime):
+		}
+	}
+}
+
+// 重新获取key数据
+func (p *EtcdProvider) reloadKey(key string, w *watchKey) {
+	data, err := p.client.Get(p.watchCtx, key)
+	if err == os.ErrNotExist {
+		p.onEvent(key, w, &etcd_sdk.WatchEvent{Type: etcd_sdk.EventTypeDelete, Key: key})
+		return
+	}
+	if err != nil {
+		log.Log.Error("重新获取etcd的key数据失败", zap.String("key", key), zap.Error(err))
+		return
+	}
+	p.onEvent(key, w, &etcd_sdk.WatchEvent{
+		Type:     etcd_sdk.EventTypePut,
+		Key:      key,
+		Value:    []byte(data.Value),
+		Revision: data.Revision,
+	})
+}
+
+// 收到事件
+func (p *EtcdProvider) onEvent(key string, w *watchKey, ev *etcd_sdk.WatchEvent) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if ev.Revision > 0 && ev.Revision <= w.revision { // 重复的事件
+		return
+	}
+	if ev.Revision > 0 {
+		w.revision = ev.Revision
+	}
+	oldData := w.data
+	if bytes.Equal(oldData, ev.Value) {
+		return
+	}
+	w.data = ev.Value
+	switch ev.Type {
+	case etcd_sdk.EventTypePut:
+		p.client.SetCache(&etcd_sdk.KeyValue{Key: key, Value: string(ev.Value), Revision: w.revision})
+	case etcd_sdk.EventTypeDelete: // 避免重启后从备份文件加载到已删除的数据
+		p.client.DeleteCache(key)
+	}
+
+	for _, fn := range w.callbacks {
+		go fn(w.groupName, w.keyName, oldData, ev.Value)
+	}
+}
@@ -0,0 +1,127 @@
+package etcd_provider
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/config/etcd_sdk"
+)
+
+func init() {
+	WatchErrWaitTime = time.Millisecond * 50
+}
+
+// 观察回调收到的数据, 回调在提供者的协程中执行, 所以发送到测试协程中断言
+type changedData struct {
+	groupName, keyName string
+	oldData, newData   string
+}
+
+func newTestProvider(t *testing.T, s *etcd_sdk.FakeServer, backupFile string, alwaysLoadFromRemote bool) *EtcdProvider {
+	p, err := NewEtcdProvider(context.Background(), &Config{
+		Address:              s.URL,
+		User:                 "user",
+		Password:             "pwd",
+		Prefix:               "/zapp/",
+		BackupFile:           backupFile,
+		AlwaysLoadFromRemote: alwaysLoadFromRemote,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func waitChanged(t *testing.T, ch chan changedData) changedData {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second * 3):
+		t.Fatal("等待配置变更超时")
+	}
+	return changedData{}
+}
+
+func TestEtcdProvider(t *testing.T) {
+	s := etcd_sdk.NewFakeServer()
+	defer s.Close()
+	s.SetAuth("user", "pwd")
+	s.Put("/zapp/group/key", []byte("v1"))
+
+	backupFile := filepath.Join(t.TempDir(), "etcd_backup.yaml")
+	p := newTestProvider(t, s, backupFile, false)
+
+	data, err := p.Get("group", "key")
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(data))
+
+	_, err = p.Get("group", "not_found")
+	require.Error(t, err)
+
+	ch := make(chan changedData, 10)
+	err = p.Watch("group", "key", func(groupName, keyName string, oldData, newData []byte) {
+		ch <- changedData{groupName, keyName, string(oldData), string(newData)}
+	})
+	require.NoError(t, err)
+
+	s.Put("/zapp/group/key", []byte("v2"))
+	require.Equal(t, changedData{"group", "key", "v1", "v2"}, waitChanged(t, ch))
+
+	// 断开连接期间的变更在重连后会从最后的版本继续收到
+	s.SetUnavailable(true)
+	s.Put("/zapp/group/key", []byte("v3"))
+	s.Put("/zapp/group/other", []byte("x"))
+	time.Sleep(time.Millisecond * 100)
+	s.SetUnavailable(false)
+	require.Equal(t, changedData{"group", "key", "v2", "v3"}, waitChanged(t, ch))
+
+	// 版本被压缩后会重新获取数据
+	s.SetUnavailable(true)
+	s.Put("/zapp/group/key", []byte("v4"))
+	rev := s.Put("/zapp/group/other", []byte("y"))
+	s.Compact(rev)
+	s.SetUnavailable(false)
+	require.Equal(t, changedData{"group", "key", "v3", "v4"}, waitChanged(t, ch))
+
+	s.Put("/zapp/group/key", []byte("v5"))
+	require.Equal(t, changedData{"group", "key", "v4", "v5"}, waitChanged(t, ch))
+
+	// 服务不可用时从备份文件加载
+	s.SetUnavailable(true)
+	p2 := newTestProvider(t, s, backupFile, false)
+	data, err = p2.Get("group", "key")
+	require.NoError(t, err)
+	require.Equal(t, "v5", string(data))
+
+	p3 := newTestProvider(t, s, backupFile, true)
+	_, err = p3.Get("group", "key")
+	require.Error(t, err)
+}
+
+func TestEtcdProviderDelete(t *testing.T) {
+	s := etcd_sdk.NewFakeServer()
+	defer s.Close()
+	s.SetAuth("user", "pwd")
+	s.Put("/zapp/group/key", []byte("v1"))
+
+	backupFile := filepath.Join(t.TempDir(), "etcd_backup.yaml")
+	p := newTestProvider(t, s, backupFile, false)
+
+	ch := make(chan changedData, 10)
+	err := p.Watch("group", "key", func(groupName, keyName string, oldData, newData []byte) {
+		ch <- changedData{groupName, keyName, string(oldData), string(newData)}
+	})
+	require.NoError(t, err)
+
+	s.Delete("/zapp/group/key")
+	require.Equal(t, changedData{"group", "key", "v1", ""}, waitChanged(t, ch))
+
+	// 删除后备份文件中不再有该key, 服务不可用时重启也不会加载到旧数据
+	s.SetUnavailable(true)
+	p2 := newTestProvider(t, s, backupFile, false)
+	_, err = p2.Get("group", "key")
+	require.Error(t, err)
+}
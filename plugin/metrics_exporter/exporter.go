@@ -0,0 +1,103 @@
+package metrics_exporter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/component/metrics"
+	"github.com/zly-app/zapp/log"
+)
+
+const (
+	defaultBind         = ":9464"
+	defaultPath         = "/metrics"
+	defaultCloseTimeout = 5 * time.Second
+)
+
+type Config struct {
+	Bind                    string // 监听地址, 默认 :9464
+	Path                    string // 指标路径, 默认 /metrics
+	DisableOpenMetrics      bool   // 禁用 OpenMetrics 格式, 总是输出 prometheus text 格式
+	DisableGoCollector      bool   // 不输出go运行时指标
+	DisableProcessCollector bool   // 不输出进程指标
+}
+
+func newConfig() *Config {
+	return &Config{}
+}
+
+func (c *Config) check() {
+	if c.Bind == "" {
+		c.Bind = defaultBind
+	}
+	if c.Path == "" {
+		c.Path = defaultPath
+	}
+}
+
+// 指标输出器
+type Exporter struct {
+	conf     *Config
+	registry *metrics.Registry
+	server   *http.Server
+}
+
+/*
+创建指标输出器
+
+	如果 metrics 的默认client已经是注册表则直接使用, 否则创建一个注册表并设为默认client
+*/
+func NewExporter(conf *Config) *Exporter {
+	conf.check()
+	registry, ok := metrics.GetClient().(*metrics.Registry)
+	if !ok {
+		registry = metrics.NewRegistry()
+		metrics.SetClient(registry)
+	}
+	if !conf.DisableGoCollector {
+		registry.RegistryCollector(metrics.NewGoCollector())
+	}
+	if !conf.DisableProcessCollector {
+		registry.RegistryCollector(metrics.NewProcessCollector())
+	}
+
+	e := &Exporter{conf: conf, registry: registry}
+	mux := http.NewServeMux()
+	mux.Handle(conf.Path, e.Handler())
+	e.server = &http.Server{Handler: mux}
+	return e
+}
+
+// 获取注册表
+func (e *Exporter) Registry() *metrics.Registry { return e.registry }
+
+// 指标的http处理器
+func (e *Exporter) Handler() http.Handler {
+	return metrics.HandlerWithOptions(e.registry, !e.conf.DisableOpenMetrics)
+}
+
+func (e *Exporter) Inject(a ...interface{}) {}
+
+func (e *Exporter) Start() error {
+	ln, err := net.Listen("tcp", e.conf.Bind)
+	if err != nil {
+		return err
+	}
+	log.Log.Info("指标服务启动", zap.String("bind", ln.Addr().String()), zap.String("path", e.conf.Path))
+	go func() {
+		if err := e.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Log.Error("指标服务异常退出", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (e *Exporter) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	return e.server.Shutdown(ctx)
+}
@@ -0,0 +1,34 @@
+package metrics_exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+func TestExporter(t *testing.T) {
+	defer metrics.SetClient(metrics.GetClient())
+
+	e := NewExporter(newConfig())
+	require.Equal(t, metrics.Client(e.Registry()), metrics.GetClient())
+	metrics.RegistryCounter("test_requests_total", "请求数", nil, "code").Inc(metrics.Labels{"code": "0"}, nil)
+
+	s := httptest.NewServer(e.Handler())
+	defer s.Close()
+	rsp, err := http.Get(s.URL)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	bs, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+
+	body := string(bs)
+	require.Equal(t, metrics.TextContentType, rsp.Header.Get("Content-Type"))
+	require.Contains(t, body, `test_requests_total{code="0"} 1`)
+	require.Contains(t, body, "go_goroutines ")
+	require.Contains(t, body, "process_start_time_seconds ")
+}
@@ -0,0 +1,28 @@
+package metrics_exporter
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/plugin"
+)
+
+// 默认插件类型
+const DefaultPluginType core.PluginType = "metrics_exporter"
+
+func init() {
+	plugin.RegisterCreatorFunc(DefaultPluginType, func(app core.IApp) core.IPlugin {
+		conf := newConfig()
+		err := app.GetConfig().ParsePluginConfig(DefaultPluginType, conf, true)
+		if err != nil {
+			app.Fatal("解析metrics_exporter插件配置失败", zap.Error(err))
+		}
+		return NewExporter(conf)
+	})
+}
+
+// 启用插件, 会将 metrics 的默认client设为进程内的注册表, 并通过http输出指标
+func WithPlugin() zapp.Option {
+	return zapp.WithPlugin(DefaultPluginType)
+}
@@ -0,0 +1,270 @@
+package metrics_pusher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/component/metrics"
+	"github.com/zly-app/zapp/log"
+)
+
+const (
+	// 推送到 pushgateway, 使用 prometheus text 格式
+	FormatPushgateway = "pushgateway"
+	// 推送到兼容 prometheus remote write 的接收端, 使用 snappy 压缩的 protobuf 格式
+	FormatRemoteWrite = "remote_write"
+)
+
+const (
+	defaultFormat   = FormatPushgateway
+	defaultInterval = 15000
+	defaultTimeout  = 5000
+)
+
+var invalidLabelCharRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+type Config struct {
+	Url                     string            // 推送地址, pushgateway 填写服务地址如 http://127.0.0.1:9091, remote_write 填写完整地址如 http://127.0.0.1:9090/api/v1/write
+	Format                  string            // 推送格式, 支持 pushgateway, remote_write, 默认 pushgateway
+	Job                     string            // job名, 默认为app名
+	Interval                int               // 推送间隔(毫秒), 默认 15000, 小于0表示只在app退出前推送
+	Timeout                 int               // 推送超时(毫秒), 默认 5000
+	Headers                 map[string]string // 推送时附加的请求头, 如 Authorization
+	DisableGoCollector      bool              // 不推送go运行时指标
+	DisableProcessCollector bool              // 不推送进程指标
+}
+
+func newConfig() *Config {
+	return &Config{}
+}
+
+func (c *Config) check() error {
+	if c.Url == "" {
+		return errors.New("Url is empty")
+	}
+	if c.Format == "" {
+		c.Format = defaultFormat
+	}
+	if c.Format != FormatPushgateway && c.Format != FormatRemoteWrite {
+		return fmt.Errorf("unsupported Format %q", c.Format)
+	}
+	if c.Interval == 0 {
+		c.Interval = defaultInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	return nil
+}
+
+/*
+生成分组标签, 包含 job, instance 和 labels
+
+	labels 中的标签名会将无效字符替换为 _, 和 job, instance 同名的标签会被忽略
+*/
+func MakeGrouping(job, instance string, labels map[string]string) metrics.Labels {
+	grouping := make(metrics.Labels, len(labels)+2)
+	for k, v := range labels {
+		k = invalidLabelCharRe.ReplaceAllString(k, "_")
+		if k == "" || (k[0] >= '0' && k[0] <= '9') {
+			k = "_" + k
+		}
+		grouping[k] = v
+	}
+	grouping["job"] = job
+	if instance != "" {
+		grouping["instance"] = instance
+	} else {
+		delete(grouping, "instance")
+	}
+	return grouping
+}
+
+// 指标推送器
+type Pusher struct {
+	conf     *Config
+	grouping metrics.Labels
+	registry *metrics.Registry
+	client   *http.Client
+
+	pushMx    sync.Mutex
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+/*
+创建指标推送器, grouping 为分组标签, 必须包含 job
+
+	如果 metrics 的默认client已经是注册表则直接使用, 否则创建一个注册表并设为默认client
+*/
+func NewPusher(conf *Config, grouping metrics.Labels) *Pusher {
+	registry, ok := metrics.GetClient().(*metrics.Registry)
+	if !ok {
+		registry = metrics.NewRegistry()
+		metrics.SetClient(registry)
+	}
+	if !conf.DisableGoCollector {
+		registry.RegistryCollector(metrics.NewGoCollector())
+	}
+	if !conf.DisableProcessCollector {
+		registry.RegistryCollector(metrics.NewProcessCollector())
+	}
+
+	return &Pusher{
+		conf:     conf,
+		grouping: grouping,
+		registry: registry,
+		client:   &http.Client{Timeout: time.Duration(conf.Timeout) * time.Millisecond},
+		stop:     make(chan struct{}),
+	}
+}
+
+// 获取注册表
+func (p *Pusher) Registry() *metrics.Registry { return p.registry }
+
+// 立即推送一次
+func (p *Pusher) Push() error {
+	p.pushMx.Lock()
+	defer p.pushMx.Unlock()
+
+	families := p.registry.Gather()
+	var req *http.Request
+	var err error
+	if p.conf.Format == FormatRemoteWrite {
+		req, err = p.makeRemoteWriteRequest(families)
+	} else {
+		req, err = p.makePushgatewayRequest(families)
+	}
+	if err != nil {
+		return err
+	}
+	for k, v := range p.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("push metrics got status %d: %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// 生成 pushgateway 的分组路径, 如 /metrics/job/myjob/instance/host1
+func (p *Pusher) pushgatewayPath() string {
+	names := make([]string, 0, len(p.grouping))
+	for k := range p.grouping {
+		if k != "job" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(p.conf.Url, "/"))
+	sb.WriteString("/metrics")
+	for _, name := range append([]string{"job"}, names...) {
+		v := p.grouping[name]
+		// 值为空或包含 / 时需要使用 base64 编码
+		if v == "" || strings.Contains(v, "/") {
+			sb.WriteString("/" + name + "@base64/")
+			if v == "" {
+				sb.WriteString("=")
+			} else {
+				sb.WriteString(base64.RawURLEncoding.EncodeToString([]byte(v)))
+			}
+			continue
+		}
+		sb.WriteString("/" + name + "/" + url.PathEscape(v))
+	}
+	return sb.String()
+}
+
+func (p *Pusher) makePushgatewayRequest(families []*metrics.MetricFamily) (*http.Request, error) {
+	var buf bytes.Buffer
+	if err := metrics.WriteText(&buf, families); err != nil {
+		return nil, err
+	}
+	// PUT 会替换该分组下的所有指标
+	req, err := http.NewRequest(http.MethodPut, p.pushgatewayPath(), &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", metrics.TextContentType)
+	return req, nil
+}
+
+func (p *Pusher) makeRemoteWriteRequest(families []*metrics.MetricFamily) (*http.Request, error) {
+	data := encodeWriteRequest(families, p.grouping, time.Now())
+	req, err := http.NewRequest(http.MethodPost, p.conf.Url, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	return req, nil
+}
+
+func (p *Pusher) loop() {
+	t := time.NewTicker(time.Duration(p.conf.Interval) * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			if err := p.Push(); err != nil {
+				log.Log.Error("推送指标失败", zap.String("url", p.conf.Url), zap.Error(err))
+			}
+		}
+	}
+}
+
+// 停止定期推送
+func (p *Pusher) stopLoop() {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// 停止定期推送并最后推送一次
+func (p *Pusher) finalPush() {
+	p.stopLoop()
+	if err := p.Push(); err != nil {
+		log.Log.Error("退出前推送指标失败", zap.String("url", p.conf.Url), zap.Error(err))
+	}
+}
+
+func (p *Pusher) Inject(a ...interface{}) {}
+
+func (p *Pusher) Start() error {
+	if p.conf.Interval < 0 {
+		return nil
+	}
+	log.Log.Info("指标推送启动", zap.String("url", p.conf.Url), zap.String("format", p.conf.Format))
+	go p.loop()
+	return nil
+}
+
+func (p *Pusher) Close() error {
+	p.stopLoop()
+	return nil
+}
@@ -0,0 +1,126 @@
+package metrics_pusher
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+type receivedRequest struct {
+	method  string
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+func newReceiver(t *testing.T) (*httptest.Server, <-chan receivedRequest) {
+	ch := make(chan receivedRequest, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		ch <- receivedRequest{method: r.Method, path: r.URL.EscapedPath(), headers: r.Header, body: body}
+	}))
+	t.Cleanup(s.Close)
+	return s, ch
+}
+
+func newTestPusher(t *testing.T, conf *Config) *Pusher {
+	old := metrics.GetClient()
+	metrics.SetClient(metrics.NewRegistry())
+	t.Cleanup(func() { metrics.SetClient(old) })
+
+	conf.DisableGoCollector = true
+	conf.DisableProcessCollector = true
+	require.NoError(t, conf.check())
+	p := NewPusher(conf, MakeGrouping("cron", "host1", map[string]string{"zone": "a/b", "env-name": "dev"}))
+	metrics.RegistryCounter("job_runs_total", "运行次数", nil, "result").Inc(metrics.Labels{"result": "ok"}, nil)
+	return p
+}
+
+func TestPushgateway(t *testing.T) {
+	s, ch := newReceiver(t)
+	p := newTestPusher(t, &Config{Url: s.URL, Headers: map[string]string{"Authorization": "Bearer x"}})
+
+	require.NoError(t, p.Push())
+	req := <-ch
+	require.Equal(t, http.MethodPut, req.method)
+	require.Equal(t, "/metrics/job/cron/env_name/dev/instance/host1/zone@base64/YS9i", req.path)
+	require.Equal(t, metrics.TextContentType, req.headers.Get("Content-Type"))
+	require.Equal(t, "Bearer x", req.headers.Get("Authorization"))
+	require.Contains(t, string(req.body), `job_runs_total{result="ok"} 1`)
+
+	// 退出前的推送
+	require.NoError(t, p.Start())
+	p.finalPush()
+	require.Contains(t, string((<-ch).body), `job_runs_total{result="ok"} 1`)
+	require.NoError(t, p.Close())
+}
+
+// 解析protobuf消息, 返回每个字段的值, 只支持 varint, fixed64 和 bytes
+func decodeMessage(t *testing.T, b []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		require.Greater(t, n, 0)
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			_, n = binary.Uvarint(b)
+			require.Greater(t, n, 0)
+		case wireFixed64:
+			n = 8
+		case wireBytes:
+			l, m := binary.Uvarint(b)
+			require.Greater(t, m, 0)
+			b = b[m:]
+			n = int(l)
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fields[field] = append(fields[field], b[:n])
+		b = b[n:]
+	}
+	return fields
+}
+
+func TestRemoteWrite(t *testing.T) {
+	s, ch := newReceiver(t)
+	p := newTestPusher(t, &Config{Url: s.URL + "/api/v1/write", Format: FormatRemoteWrite})
+	metrics.RegistryHistogram("job_cost_seconds", "耗时", []float64{1}, nil).Observe(0.5, nil, nil)
+
+	require.NoError(t, p.Push())
+	req := <-ch
+	require.Equal(t, http.MethodPost, req.method)
+	require.Equal(t, "/api/v1/write", req.path)
+	require.Equal(t, "snappy", req.headers.Get("Content-Encoding"))
+	require.Equal(t, "application/x-protobuf", req.headers.Get("Content-Type"))
+
+	data, err := snappy.Decode(nil, req.body)
+	require.NoError(t, err)
+	wr := decodeMessage(t, data)
+
+	series := make(map[string]float64)
+	for _, ts := range wr[1] {
+		msg := decodeMessage(t, ts)
+		var key string
+		for _, l := range msg[1] {
+			label := decodeMessage(t, l)
+			key += string(label[1][0]) + "=" + string(label[2][0]) + ","
+		}
+		sample := decodeMessage(t, msg[2][0])
+		series[key] = math.Float64frombits(binary.LittleEndian.Uint64(sample[1][0]))
+	}
+	require.Equal(t, 1.0, series["__name__=job_runs_total,env_name=dev,instance=host1,job=cron,result=ok,zone=a/b,"])
+	require.Equal(t, 1.0, series["__name__=job_cost_seconds_bucket,env_name=dev,instance=host1,job=cron,le=1,zone=a/b,"])
+	require.Equal(t, 0.5, series["__name__=job_cost_seconds_sum,env_name=dev,instance=host1,job=cron,zone=a/b,"])
+	require.Len(t, wr[3], 2) // 每个指标族一个元数据
+}
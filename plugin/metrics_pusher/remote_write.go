@@ -0,0 +1,146 @@
+package metrics_pusher
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+/*
+remote write 的 protobuf 编码, 对应 prometheus prompb 的以下结构
+
+	message WriteRequest { repeated TimeSeries timeseries = 1; repeated MetricMetadata metadata = 3; }
+	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+	message Label { string name = 1; string value = 2; }
+	message Sample { double value = 1; int64 timestamp = 2; }
+	message MetricMetadata { MetricType type = 1; string metric_family_name = 2; string help = 4; }
+*/
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// prompb.MetricMetadata.MetricType
+var metadataTypes = map[metrics.MetricType]uint64{
+	metrics.CounterType:   1,
+	metrics.GaugeType:     2,
+	metrics.HistogramType: 3,
+	metrics.SummaryType:   5,
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	return appendBytesField(b, field, []byte(s))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendDoubleField(b []byte, field int, v float64) []byte {
+	b = appendTag(b, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 序列编码器, 会在指标标签中补充分组标签, 指标自己的标签优先
+type seriesEncoder struct {
+	grouping metrics.Labels
+	ts       int64
+	buf      []byte
+	tmp      []byte
+}
+
+func (e *seriesEncoder) add(name string, labels []metrics.LabelPair, extraName, extraValue string, value float64) {
+	all := make(metrics.Labels, len(e.grouping)+len(labels)+2)
+	for k, v := range e.grouping {
+		all[k] = v
+	}
+	for _, l := range labels {
+		all[l.Name] = l.Value
+	}
+	if extraName != "" {
+		all[extraName] = extraValue
+	}
+	all["__name__"] = name
+
+	names := make([]string, 0, len(all))
+	for k := range all {
+		names = append(names, k)
+	}
+	sort.Strings(names) // remote write 要求标签按名称排序
+
+	series := e.tmp[:0]
+	var label []byte
+	for _, k := range names {
+		label = appendStringField(label[:0], 1, k)
+		label = appendStringField(label, 2, all[k])
+		series = appendBytesField(series, 1, label)
+	}
+	var sample []byte
+	sample = appendDoubleField(sample, 1, value)
+	sample = appendVarintField(sample, 2, uint64(e.ts))
+	series = appendBytesField(series, 2, sample)
+
+	e.buf = appendBytesField(e.buf, 1, series)
+	e.tmp = series
+}
+
+// 将指标编码为 WriteRequest
+func encodeWriteRequest(families []*metrics.MetricFamily, grouping metrics.Labels, now time.Time) []byte {
+	e := &seriesEncoder{grouping: grouping, ts: now.UnixMilli()}
+	for _, f := range families {
+		for _, m := range f.Metrics {
+			switch {
+			case f.Type == metrics.HistogramType && m.Histogram != nil:
+				for _, b := range m.Histogram.Buckets {
+					e.add(f.Name+"_bucket", m.Labels, "le", formatFloat(b.UpperBound), float64(b.Count))
+				}
+				e.add(f.Name+"_bucket", m.Labels, "le", "+Inf", float64(m.Histogram.Count))
+				e.add(f.Name+"_sum", m.Labels, "", "", m.Histogram.Sum)
+				e.add(f.Name+"_count", m.Labels, "", "", float64(m.Histogram.Count))
+			case f.Type == metrics.SummaryType && m.Summary != nil:
+				for _, q := range m.Summary.Quantiles {
+					e.add(f.Name, m.Labels, "quantile", formatFloat(q.Quantile), q.Value)
+				}
+				e.add(f.Name+"_sum", m.Labels, "", "", m.Summary.Sum)
+				e.add(f.Name+"_count", m.Labels, "", "", float64(m.Summary.Count))
+			default:
+				e.add(f.Name, m.Labels, "", "", m.Value)
+			}
+		}
+	}
+
+	for _, f := range families {
+		var meta []byte
+		meta = appendVarintField(meta, 1, metadataTypes[f.Type])
+		meta = appendStringField(meta, 2, f.Name)
+		if f.Help != "" {
+			meta = appendStringField(meta, 4, f.Help)
+		}
+		e.buf = appendBytesField(e.buf, 3, meta)
+	}
+	return e.buf
+}
@@ -0,0 +1,43 @@
+package metrics_pusher
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/handler"
+	"github.com/zly-app/zapp/plugin"
+)
+
+// 默认插件类型
+const DefaultPluginType core.PluginType = "metrics_pusher"
+
+func init() {
+	plugin.RegisterCreatorFunc(DefaultPluginType, func(app core.IApp) core.IPlugin {
+		conf := newConfig()
+		err := app.GetConfig().ParsePluginConfig(DefaultPluginType, conf, true)
+		if err == nil {
+			err = conf.check()
+		}
+		if err != nil {
+			app.Fatal("解析metrics_pusher插件配置失败", zap.Error(err))
+		}
+
+		frame := app.GetConfig().Config().Frame
+		job := conf.Job
+		if job == "" {
+			job = app.Name()
+		}
+		p := NewPusher(conf, MakeGrouping(job, frame.Instance, frame.Labels))
+		// app退出前最后推送一次
+		handler.AddHandler(handler.BeforeExitHandler, func(_ core.IApp, _ handler.HandlerType) {
+			p.finalPush()
+		})
+		return p
+	})
+}
+
+// 启用插件, 会将 metrics 的默认client设为进程内的注册表, 并定期推送指标, app退出前会最后推送一次
+func WithPlugin() zapp.Option {
+	return zapp.WithPlugin(DefaultPluginType)
+}
@@ -0,0 +1,295 @@
+package otel_metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+/*
+将 metrics.Client 映射到 otel 的 meter
+
+	Counter 映射为 Float64Counter, Add 负数会被忽略
+	Gauge 映射为 Float64ObservableGauge, 在收集时上报最后的值
+	Histogram 和 Summary 映射为 Float64Histogram, 注册时传入的 buckets 会被忽略, 使用 otel sdk 默认的桶边界, 需要自定义时在 MeterProvider 上配置 view
+	样例会转为包含 span 上下文的 ctx 传给 otel, 但当前依赖的 otel sdk/metric v0.36.0 不支持样例, 样例会被丢弃
+*/
+type Client struct {
+	meter metric.Meter
+
+	mx         sync.RWMutex
+	types      map[string]metrics.MetricType // 已注册的指标类型, 同名指标不能注册为不同的类型
+	counters   map[string]*counter
+	gauges     map[string]*gauge
+	histograms map[string]*histogram
+	summaries  map[string]*histogram
+}
+
+var _ metrics.Client = (*Client)(nil)
+
+// 创建 otel 指标客户端
+func NewClient(meter metric.Meter) *Client {
+	return &Client{
+		meter:      meter,
+		types:      make(map[string]metrics.MetricType),
+		counters:   make(map[string]*counter),
+		gauges:     make(map[string]*gauge),
+		histograms: make(map[string]*histogram),
+		summaries:  make(map[string]*histogram),
+	}
+}
+
+// 检查指标类型, 已注册为其它类型时panic, 需要加锁调用
+func (c *Client) checkType(name string, typ metrics.MetricType) {
+	if t, ok := c.types[name]; ok && t != typ {
+		panic(fmt.Sprintf("指标<%s>已注册为%s, 无法注册为%s", name, t, typ))
+	}
+	c.types[name] = typ
+}
+
+func (c *Client) RegistryCounter(name, help string, constLabels metrics.Labels, labels ...string) metrics.ICounter {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.checkType(name, metrics.CounterType)
+	if v, ok := c.counters[name]; ok {
+		return v
+	}
+	inst, err := c.meter.Float64Counter(name, instrument.WithDescription(help))
+	if err != nil {
+		panic(fmt.Sprintf("注册otel指标<%s>失败: %v", name, err))
+	}
+	v := &counter{attrs: newAttrMaker(constLabels, labels), inst: inst}
+	c.counters[name] = v
+	return v
+}
+
+func (c *Client) Counter(name string) metrics.ICounter {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	if v, ok := c.counters[name]; ok {
+		return v
+	}
+	return metrics.DefNoopCounter
+}
+
+func (c *Client) RegistryGauge(name, help string, constLabels metrics.Labels, labels ...string) metrics.IGauge {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.checkType(name, metrics.GaugeType)
+	if v, ok := c.gauges[name]; ok {
+		return v
+	}
+	v := &gauge{attrs: newAttrMaker(constLabels, labels), values: make(map[attribute.Distinct]*gaugeValue)}
+	_, err := c.meter.Float64ObservableGauge(name, instrument.WithDescription(help), instrument.WithFloat64Callback(v.observe))
+	if err != nil {
+		panic(fmt.Sprintf("注册otel指标<%s>失败: %v", name, err))
+	}
+	c.gauges[name] = v
+	return v
+}
+
+func (c *Client) Gauge(name string) metrics.IGauge {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	if v, ok := c.gauges[name]; ok {
+		return v
+	}
+	return metrics.DefNoopGauge
+}
+
+func (c *Client) registryHistogram(typ metrics.MetricType, store map[string]*histogram, name, help string, constLabels metrics.Labels, labels []string) *histogram {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.checkType(name, typ)
+	if v, ok := store[name]; ok {
+		return v
+	}
+	inst, err := c.meter.Float64Histogram(name, instrument.WithDescription(help))
+	if err != nil {
+		panic(fmt.Sprintf("注册otel指标<%s>失败: %v", name, err))
+	}
+	v := &histogram{attrs: newAttrMaker(constLabels, labels), inst: inst}
+	store[name] = v
+	return v
+}
+
+// 注册直方图, buckets 会被忽略, 使用 otel sdk 默认的桶边界或 MeterProvider 上配置的 view
+func (c *Client) RegistryHistogram(name, help string, buckets []float64, constLabels metrics.Labels, labels ...string) metrics.IHistogram {
+	return c.registryHistogram(metrics.HistogramType, c.histograms, name, help, constLabels, labels)
+}
+
+func (c *Client) Histogram(name string) metrics.IHistogram {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	if v, ok := c.histograms[name]; ok {
+		return v
+	}
+	return metrics.DefNoopHistogram
+}
+
+func (c *Client) RegistrySummary(name, help string, constLabels metrics.Labels, labels ...string) metrics.ISummary {
+	return c.registryHistogram(metrics.SummaryType, c.summaries, name, help, constLabels, labels)
+}
+
+func (c *Client) Summary(name string) metrics.ISummary {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	if v, ok := c.summaries[name]; ok {
+		return v
+	}
+	return metrics.DefNoopSummary
+}
+
+// 生成 otel 属性, 缺少的标签值为空字符串, 未注册的标签会被忽略
+type attrMaker struct {
+	constAttrs []attribute.KeyValue
+	labelNames []string
+}
+
+func newAttrMaker(constLabels metrics.Labels, labelNames []string) *attrMaker {
+	m := &attrMaker{labelNames: append([]string{}, labelNames...)}
+	for k, v := range constLabels {
+		m.constAttrs = append(m.constAttrs, attribute.String(k, v))
+	}
+	return m
+}
+
+func (m *attrMaker) make(labels metrics.Labels) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(m.constAttrs)+len(m.labelNames))
+	attrs = append(attrs, m.constAttrs...)
+	for _, name := range m.labelNames {
+		attrs = append(attrs, attribute.String(name, labels[name]))
+	}
+	return attrs
+}
+
+/*
+将样例转为 ctx
+
+	先使用全局的 propagator 从样例中提取 span 上下文, 失败时使用样例中的 traceID 和 spanID
+*/
+func exemplarContext(exemplar metrics.Labels) context.Context {
+	ctx := context.Background()
+	if len(exemplar) == 0 {
+		return ctx
+	}
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(exemplar))
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	traceID, err := trace.TraceIDFromHex(exemplar["traceID"])
+	if err != nil {
+		return ctx
+	}
+	spanID, err := trace.SpanIDFromHex(exemplar["spanID"])
+	if err != nil {
+		return ctx
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+type counter struct {
+	attrs *attrMaker
+	inst  instrument.Float64Counter
+}
+
+func (c *counter) Inc(labels metrics.Labels, exemplar metrics.Labels) { c.Add(1, labels, exemplar) }
+func (c *counter) Add(v float64, labels metrics.Labels, exemplar metrics.Labels) {
+	if v < 0 {
+		return
+	}
+	c.inst.Add(exemplarContext(exemplar), v, c.attrs.make(labels)...)
+}
+
+type gaugeValue struct {
+	attrs []attribute.KeyValue
+	bits  uint64
+}
+
+// 仪表保存每组标签最后的值, 由 otel 在收集时回调上报
+type gauge struct {
+	attrs *attrMaker
+
+	mx     sync.RWMutex
+	values map[attribute.Distinct]*gaugeValue
+}
+
+func (g *gauge) value(labels metrics.Labels) *gaugeValue {
+	attrs := g.attrs.make(labels)
+	set := attribute.NewSet(attrs...)
+	key := set.Equivalent()
+
+	g.mx.RLock()
+	v, ok := g.values[key]
+	g.mx.RUnlock()
+	if ok {
+		return v
+	}
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if v, ok = g.values[key]; !ok {
+		v = &gaugeValue{attrs: attrs}
+		g.values[key] = v
+	}
+	return v
+}
+
+func (g *gauge) add(v float64, labels metrics.Labels) {
+	bits := &g.value(labels).bits
+	for {
+		old := atomic.LoadUint64(bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(bits, old, n) {
+			return
+		}
+	}
+}
+
+func (g *gauge) observe(_ context.Context, o instrument.Float64Observer) error {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	for _, v := range g.values {
+		o.Observe(math.Float64frombits(atomic.LoadUint64(&v.bits)), v.attrs...)
+	}
+	return nil
+}
+
+func (g *gauge) Set(v float64, labels metrics.Labels) {
+	atomic.StoreUint64(&g.value(labels).bits, math.Float64bits(v))
+}
+func (g *gauge) Inc(labels metrics.Labels)            { g.add(1, labels) }
+func (g *gauge) Dec(labels metrics.Labels)            { g.add(-1, labels) }
+func (g *gauge) Add(v float64, labels metrics.Labels) { g.add(v, labels) }
+func (g *gauge) Sub(v float64, labels metrics.Labels) { g.add(-v, labels) }
+func (g *gauge) SetToCurrentTime(labels metrics.Labels) {
+	g.Set(float64(time.Now().UnixNano())/1e9, labels)
+}
+
+type histogram struct {
+	attrs *attrMaker
+	inst  instrument.Float64Histogram
+}
+
+func (h *histogram) Observe(v float64, labels metrics.Labels, exemplar metrics.Labels) {
+	h.inst.Record(exemplarContext(exemplar), v, h.attrs.make(labels)...)
+}
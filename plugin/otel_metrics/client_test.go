@@ -0,0 +1,71 @@
+package otel_metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zly-app/zapp/component/metrics"
+)
+
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	rm, err := reader.Collect(context.Background())
+	require.NoError(t, err)
+	out := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			out[m.Name] = m.Data
+		}
+	}
+	return out
+}
+
+func TestClient(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	c := NewClient(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+
+	counter := c.RegistryCounter("req_total", "请求数", metrics.Labels{"app": "a"}, "code")
+	require.Equal(t, counter, c.Counter("req_total"))
+	counter.Inc(metrics.Labels{"code": "0", "other": "x"}, nil)
+	counter.Add(2, metrics.Labels{"code": "0"}, nil)
+	counter.Add(-1, metrics.Labels{"code": "0"}, nil)
+	require.Equal(t, metrics.DefNoopCounter, c.Counter("not_exists"))
+
+	g := c.RegistryGauge("temp", "温度", nil)
+	g.Set(3, nil)
+	g.Sub(0.5, nil)
+
+	c.RegistryHistogram("cost", "耗时", nil, nil).Observe(1, nil, nil)
+	c.RegistrySummary("size", "大小", nil).Observe(5, nil, nil)
+
+	data := collect(t, reader)
+	sum := data["req_total"].(metricdata.Sum[float64])
+	require.Len(t, sum.DataPoints, 1)
+	require.Equal(t, 3.0, sum.DataPoints[0].Value)
+	require.Equal(t, attribute.NewSet(attribute.String("app", "a"), attribute.String("code", "0")), sum.DataPoints[0].Attributes)
+
+	require.Equal(t, 2.5, data["temp"].(metricdata.Gauge[float64]).DataPoints[0].Value)
+	require.Equal(t, uint64(1), data["cost"].(metricdata.Histogram).DataPoints[0].Count)
+	require.Equal(t, 5.0, data["size"].(metricdata.Histogram).DataPoints[0].Sum)
+
+	// 直方图和汇总分开获取, 同名指标不能注册为其它类型
+	require.Equal(t, metrics.DefNoopSummary, c.Summary("cost"))
+	require.Equal(t, metrics.DefNoopHistogram, c.Histogram("size"))
+	require.Panics(t, func() { c.RegistrySummary("cost", "", nil) })
+	require.Panics(t, func() { c.RegistryCounter("temp", "", nil) })
+}
+
+func TestExemplarContext(t *testing.T) {
+	require.False(t, trace.SpanContextFromContext(exemplarContext(nil)).IsValid())
+
+	ctx := exemplarContext(metrics.Labels{"traceID": "0102030405060708090a0b0c0d0e0f10", "spanID": "0102030405060708"})
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsValid())
+	require.Equal(t, "0102030405060708090a0b0c0d0e0f10", sc.TraceID().String())
+	require.Equal(t, "0102030405060708", sc.SpanID().String())
+}
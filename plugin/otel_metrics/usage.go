@@ -0,0 +1,61 @@
+package otel_metrics
+
+import (
+	"go.opentelemetry.io/otel/metric/global"
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp"
+	"github.com/zly-app/zapp/component/metrics"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/plugin"
+)
+
+// 默认插件类型
+const DefaultPluginType core.PluginType = "otel_metrics"
+
+// 默认的 meter 名
+const defaultMeterName = "github.com/zly-app/zapp"
+
+type Config struct {
+	MeterName string // meter 名, 默认 github.com/zly-app/zapp
+}
+
+func newConfig() *Config {
+	return &Config{}
+}
+
+func (c *Config) check() {
+	if c.MeterName == "" {
+		c.MeterName = defaultMeterName
+	}
+}
+
+type otelMetricsPlugin struct{}
+
+func (otelMetricsPlugin) Inject(a ...interface{}) {}
+func (otelMetricsPlugin) Start() error            { return nil }
+func (otelMetricsPlugin) Close() error            { return nil }
+
+func init() {
+	plugin.RegisterCreatorFunc(DefaultPluginType, func(app core.IApp) core.IPlugin {
+		conf := newConfig()
+		err := app.GetConfig().ParsePluginConfig(DefaultPluginType, conf, true)
+		if err != nil {
+			app.Fatal("解析otel_metrics插件配置失败", zap.Error(err))
+		}
+		conf.check()
+		metrics.SetClient(NewClient(global.Meter(conf.MeterName)))
+		return otelMetricsPlugin{}
+	})
+}
+
+/*
+启用插件, 会将 metrics 的默认client设为 otel 指标客户端
+
+	指标通过全局的 MeterProvider 上报, 需要自行使用 global.SetMeterProvider 设置 otel sdk
+	注册 Histogram 时传入的 buckets 会被忽略, 使用 otel sdk 默认的桶边界, 需要自定义时在 MeterProvider 上配置 view
+	当前依赖的 otel sdk/metric v0.36.0 不支持样例, 上报时传入的样例会被丢弃
+*/
+func WithPlugin() zapp.Option {
+	return zapp.WithPlugin(DefaultPluginType)
+}
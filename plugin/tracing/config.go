@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"fmt"
+)
+
+// 采样器
+const (
+	SamplerAlwaysOn    = "always_on"    // 全部采样
+	SamplerAlwaysOff   = "always_off"   // 全部不采样
+	SamplerRatio       = "ratio"        // 按 trace id 比例采样
+	SamplerRateLimited = "rate_limited" // 限制每秒采样的 trace 数
+)
+
+// 导出器
+const (
+	ExporterOtlpHttp = "otlp_http" // 通过 http 导出到 otlp 接收端
+	ExporterOtlpGrpc = "otlp_grpc" // 通过 grpc 导出到 otlp 接收端
+	ExporterStdout   = "stdout"    // 输出到标准输出
+	ExporterMemory   = "memory"    // 保存在内存中, 用于测试, 通过 MemoryExporter 获取
+)
+
+// 传播器
+const (
+	PropagatorTraceContext = "tracecontext" // W3C trace context
+	PropagatorBaggage      = "baggage"      // W3C baggage
+	PropagatorB3           = "b3"           // B3 单请求头
+	PropagatorB3Multi      = "b3multi"      // B3 多请求头
+)
+
+const (
+	defSampler            = SamplerAlwaysOn
+	defTimeout            = 10000
+	defBatchTimeout       = 5000
+	defMaxQueueSize       = 2048
+	defMaxExportBatchSize = 512
+	defShutdownTimeout    = 5000
+)
+
+var defPropagators = []string{PropagatorTraceContext, PropagatorBaggage}
+
+type Config struct {
+	Sampler            string  // 采样器, 支持 always_on, always_off, ratio, rate_limited, 默认 always_on
+	SampleRatio        float64 // ratio 采样器的采样率, 取值 [0, 1]
+	RateLimit          float64 // rate_limited 采样器每秒最多采样的 trace 数
+	DisableParentBased bool    // 不跟随父span的采样结果, 默认存在父span时使用父span的采样结果, 只对根span使用采样器
+
+	Exporter     string            // 导出器, 支持 otlp_http, otlp_grpc, stdout, memory, 为空表示不导出
+	Endpoint     string            // otlp 接收端地址, 如 127.0.0.1:4318(http), 127.0.0.1:4317(grpc), 为空时使用 otel 的默认值
+	UrlPath      string            // otlp_http 的路径, 默认 /v1/traces
+	Insecure     bool              // otlp 不使用tls
+	Headers      map[string]string // otlp 请求头
+	Compression  string            // otlp 压缩方式, 支持 gzip
+	Timeout      int               // otlp 导出超时(毫秒), 默认 10000
+	StdoutPretty bool              // stdout 导出器格式化输出
+
+	BatchTimeout       int // 批量导出的最大等待时间(毫秒), 默认 5000
+	MaxQueueSize       int // 等待导出的最大span数, 超过时丢弃, 默认 2048
+	MaxExportBatchSize int // 每批导出的最大span数, 默认 512
+	ShutdownTimeout    int // 关闭时等待导出剩余span的超时(毫秒), 默认 5000
+
+	TailSampling  bool // 开启尾部采样, 配合 base.trace 过滤器的 tail 模式, 按 trace 缓存span, 在本地根span结束时决定是否导出
+	TailMaxTraces int  // 尾部采样最多缓存的 trace 数, 超过时较早的 trace 会被提前决定, 默认 10000
+
+	Propagators        []string          // 传播器, 支持 tracecontext, baggage, b3, b3multi, 默认 tracecontext, baggage
+	ResourceAttributes map[string]string // 附加的资源属性, 会覆盖从框架配置中获取的同名属性
+}
+
+func newConfig() *Config {
+	return &Config{}
+}
+
+func (c *Config) check() error {
+	if c.Sampler == "" {
+		c.Sampler = defSampler
+	}
+	switch c.Sampler {
+	case SamplerAlwaysOn, SamplerAlwaysOff:
+	case SamplerRatio:
+		if c.SampleRatio < 0 || c.SampleRatio > 1 {
+			return fmt.Errorf("SampleRatio must be in [0, 1], got %v", c.SampleRatio)
+		}
+	case SamplerRateLimited:
+		if c.RateLimit <= 0 {
+			return fmt.Errorf("RateLimit must be greater than 0, got %v", c.RateLimit)
+		}
+	default:
+		return fmt.Errorf("unsupported Sampler %q", c.Sampler)
+	}
+
+	switch c.Exporter {
+	case "", ExporterOtlpHttp, ExporterOtlpGrpc, ExporterStdout, ExporterMemory:
+	default:
+		return fmt.Errorf("unsupported Exporter %q", c.Exporter)
+	}
+	if c.Compression != "" && c.Compression != "gzip" {
+		return fmt.Errorf("unsupported Compression %q", c.Compression)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defTimeout
+	}
+	if c.BatchTimeout <= 0 {
+		c.BatchTimeout = defBatchTimeout
+	}
+	if c.MaxQueueSize <= 0 {
+		c.MaxQueueSize = defMaxQueueSize
+	}
+	if c.MaxExportBatchSize <= 0 {
+		c.MaxExportBatchSize = defMaxExportBatchSize
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = defShutdownTimeout
+	}
+	if c.TailMaxTraces <= 0 {
+		c.TailMaxTraces = defTailMaxTraces
+	}
+
+	if len(c.Propagators) == 0 {
+		c.Propagators = defPropagators
+	}
+	for _, p := range c.Propagators {
+		switch p {
+		case PropagatorTraceContext, PropagatorBaggage, PropagatorB3, PropagatorB3Multi:
+		default:
+			return fmt.Errorf("unsupported Propagator %q", p)
+		}
+	}
+	return nil
+}
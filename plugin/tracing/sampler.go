@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 限流采样器, 使用令牌桶限制每秒采样的 trace 数
+type rateLimitedSampler struct {
+	rate float64
+
+	mx     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// 创建限流采样器, rate 为每秒最多采样的 trace 数
+func NewRateLimitedSampler(rate float64) sdktrace.Sampler {
+	return &rateLimitedSampler{rate: rate, tokens: math.Max(rate, 1), now: time.Now}
+}
+
+func (s *rateLimitedSampler) allow() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	now := s.now()
+	if !s.last.IsZero() {
+		s.tokens = math.Min(math.Max(s.rate, 1), s.tokens+now.Sub(s.last).Seconds()*s.rate)
+	}
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+func (s *rateLimitedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if s.allow() {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimitedSampler{%g}", s.rate)
+}
+
+// 根据配置创建采样器
+func makeSampler(conf *Config) sdktrace.Sampler {
+	var sampler sdktrace.Sampler
+	switch conf.Sampler {
+	case SamplerAlwaysOff:
+		sampler = sdktrace.NeverSample()
+	case SamplerRatio:
+		sampler = sdktrace.TraceIDRatioBased(conf.SampleRatio)
+	case SamplerRateLimited:
+		sampler = NewRateLimitedSampler(conf.RateLimit)
+	default:
+		sampler = sdktrace.AlwaysSample()
+	}
+	if conf.DisableParentBased {
+		return sampler
+	}
+	return sdktrace.ParentBased(sampler)
+}
@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zly-app/zapp/filter"
+)
+
+const (
+	defTailMaxTraces        = 10000
+	defTailMaxSpansPerTrace = 1000
+)
+
+// 等待决定的 trace
+type pendingTrace struct {
+	spans       []sdktrace.ReadOnlySpan
+	keep        bool // 是否有span需要保留
+	hasDecision bool // 是否有span带有保留标记
+}
+
+func (p *pendingTrace) add(s sdktrace.ReadOnlySpan) {
+	s, keep, ok := stripTailKeep(s)
+	if len(p.spans) < defTailMaxSpansPerTrace {
+		p.spans = append(p.spans, s)
+	}
+	if ok {
+		p.hasDecision = true
+		p.keep = p.keep || keep
+	}
+}
+
+// 去掉保留标记后的span
+type tailStrippedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s tailStrippedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+
+// 读取span的保留标记, 返回去掉保留标记后的span, 保留标记只用于决定是否导出
+func stripTailKeep(s sdktrace.ReadOnlySpan) (span sdktrace.ReadOnlySpan, keep bool, ok bool) {
+	attrs := s.Attributes()
+	for i, kv := range attrs {
+		if kv.Key != filter.TraceTailKeepKey {
+			continue
+		}
+		stripped := make([]attribute.KeyValue, 0, len(attrs)-1)
+		stripped = append(stripped, attrs[:i]...)
+		stripped = append(stripped, attrs[i+1:]...)
+		return tailStrippedSpan{ReadOnlySpan: s, attrs: stripped}, kv.Value.AsBool(), true
+	}
+	return s, false, false
+}
+
+// 是否导出, 没有span带有保留标记时说明不是由 base.trace 的尾部采样模式产生的, 总是导出
+func (p *pendingTrace) shouldExport() bool {
+	return p.keep || !p.hasDecision
+}
+
+/*
+尾部采样处理器, 配合 base.trace 的 tail 模式使用
+
+	结束的span会按 trace 缓存, 本地根span结束时, 只要 trace 中有一个span需要保留, 缓存的span都会交给 next 导出, 否则丢弃
+	本地根span结束后才结束的span会按之前的决定处理, 即使带有保留标记, 已丢弃的 trace 也不会导出
+	导出的span会去掉 filter.TraceTailKeepKey 属性
+	缓存的 trace 数达到 maxTraces 时, 较早的 trace 会被提前决定
+*/
+type tailSamplingProcessor struct {
+	next      sdktrace.SpanProcessor
+	maxTraces int
+
+	mx          sync.Mutex
+	pending     map[trace.TraceID]*pendingTrace
+	prevPending map[trace.TraceID]*pendingTrace
+	decided     map[trace.TraceID]bool
+	prevDecided map[trace.TraceID]bool
+}
+
+func newTailSamplingProcessor(next sdktrace.SpanProcessor, maxTraces int) *tailSamplingProcessor {
+	return &tailSamplingProcessor{
+		next:        next,
+		maxTraces:   maxTraces,
+		pending:     make(map[trace.TraceID]*pendingTrace),
+		prevPending: make(map[trace.TraceID]*pendingTrace),
+		decided:     make(map[trace.TraceID]bool),
+		prevDecided: make(map[trace.TraceID]bool),
+	}
+}
+
+// 是否为本地根span
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	parent := s.Parent()
+	return !parent.IsValid() || parent.IsRemote()
+}
+
+func (p *tailSamplingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *tailSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	for _, span := range p.process(s) {
+		p.next.OnEnd(span)
+	}
+}
+
+// 处理结束的span, 返回需要导出的span
+func (p *tailSamplingProcessor) process(s sdktrace.ReadOnlySpan) []sdktrace.ReadOnlySpan {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	traceID := s.SpanContext().TraceID()
+	if keep, ok := p.getDecided(traceID); ok {
+		if !keep { // 已丢弃的 trace 不会只导出后结束的span
+			return nil
+		}
+		s, _, _ = stripTailKeep(s)
+		return []sdktrace.ReadOnlySpan{s}
+	}
+
+	t, ok := p.pending[traceID]
+	if !ok {
+		if t, ok = p.prevPending[traceID]; ok {
+			delete(p.prevPending, traceID)
+		} else {
+			t = &pendingTrace{}
+		}
+		p.pending[traceID] = t
+	}
+	t.add(s)
+	if !isLocalRoot(s) {
+		return p.rotate()
+	}
+
+	delete(p.pending, traceID)
+	p.setDecided(traceID, t.shouldExport())
+	if t.shouldExport() {
+		return append(t.spans, p.rotate()...)
+	}
+	return p.rotate()
+}
+
+func (p *tailSamplingProcessor) getDecided(traceID trace.TraceID) (bool, bool) {
+	if keep, ok := p.decided[traceID]; ok {
+		return keep, true
+	}
+	keep, ok := p.prevDecided[traceID]
+	return keep, ok
+}
+
+func (p *tailSamplingProcessor) setDecided(traceID trace.TraceID, keep bool) {
+	if len(p.decided) >= p.maxTraces {
+		p.prevDecided = p.decided
+		p.decided = make(map[trace.TraceID]bool)
+	}
+	p.decided[traceID] = keep
+}
+
+// 缓存的 trace 过多时提前决定较早的 trace, 返回需要导出的span
+func (p *tailSamplingProcessor) rotate() []sdktrace.ReadOnlySpan {
+	if len(p.pending) < p.maxTraces {
+		return nil
+	}
+	spans := p.decideAll(p.prevPending)
+	p.prevPending = p.pending
+	p.pending = make(map[trace.TraceID]*pendingTrace)
+	return spans
+}
+
+// 决定所有 trace, 返回需要导出的span
+func (p *tailSamplingProcessor) decideAll(traces map[trace.TraceID]*pendingTrace) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for traceID, t := range traces {
+		p.setDecided(traceID, t.shouldExport())
+		if t.shouldExport() {
+			spans = append(spans, t.spans...)
+		}
+	}
+	return spans
+}
+
+// 决定所有缓存的 trace 并交给 next, 用于关闭时
+func (p *tailSamplingProcessor) flush() {
+	p.mx.Lock()
+	spans := p.decideAll(p.prevPending)
+	spans = append(spans, p.decideAll(p.pending)...)
+	p.prevPending = make(map[trace.TraceID]*pendingTrace)
+	p.pending = make(map[trace.TraceID]*pendingTrace)
+	p.mx.Unlock()
+
+	for _, s := range spans {
+		p.next.OnEnd(s)
+	}
+}
+
+func (p *tailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.flush()
+	return p.next.Shutdown(ctx)
+}
+
+// 只导出已决定的span, 缓存中的 trace 可能还未结束, 不会提前决定
+func (p *tailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zly-app/zapp/filter"
+)
+
+func newTailTestProvider(maxTraces int) (trace.Tracer, *tracetest.InMemoryExporter, *tailSamplingProcessor) {
+	e := tracetest.NewInMemoryExporter()
+	p := newTailSamplingProcessor(sdktrace.NewSimpleSpanProcessor(e), maxTraces)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p))
+	return tp.Tracer("test"), e, p
+}
+
+func startTailSpan(ctx context.Context, tracer trace.Tracer, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// 模拟 base.trace 结束一次调用, keep 为 nil 表示不设置保留标记
+func endTailSpan(span trace.Span, keep *bool) {
+	if keep != nil {
+		span.SetAttributes(filter.TraceTailKeepKey.Bool(*keep))
+	}
+	span.End()
+}
+
+func spanNames(e *tracetest.InMemoryExporter) []string {
+	var names []string
+	for _, s := range e.GetSpans() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestTailSamplingProcessor(t *testing.T) {
+	tracer, e, p := newTailTestProvider(100)
+	yes, no := true, false
+
+	// 子span需要保留时整个 trace 都会导出
+	ctx, root := startTailSpan(context.Background(), tracer, "root1")
+	_, child := startTailSpan(ctx, tracer, "child1")
+	endTailSpan(child, &yes)
+	require.Empty(t, e.GetSpans())
+	endTailSpan(root, &no)
+	require.Equal(t, []string{"child1", "root1"}, spanNames(e))
+	for _, s := range e.GetSpans() {
+		for _, kv := range s.Attributes {
+			require.NotEqual(t, filter.TraceTailKeepKey, kv.Key, "导出前去掉保留标记")
+		}
+	}
+	e.Reset()
+
+	// 都不需要保留时丢弃, 之后结束的span即使需要保留也会丢弃
+	ctx, root = startTailSpan(context.Background(), tracer, "root2")
+	_, late := startTailSpan(ctx, tracer, "late2")
+	_, lateKeep := startTailSpan(ctx, tracer, "lateKeep2")
+	endTailSpan(root, &no)
+	endTailSpan(late, &no)
+	endTailSpan(lateKeep, &yes)
+	require.Empty(t, e.GetSpans())
+
+	// 没有保留标记的 trace 总是导出
+	_, root = startTailSpan(context.Background(), tracer, "root3")
+	endTailSpan(root, nil)
+	require.Equal(t, []string{"root3"}, spanNames(e))
+	e.Reset()
+
+	// 关闭时决定缓存中的 trace
+	ctx, root = startTailSpan(context.Background(), tracer, "root4")
+	_, child = startTailSpan(ctx, tracer, "child4")
+	endTailSpan(child, &yes)
+	p.flush()
+	require.Equal(t, []string{"child4"}, spanNames(e))
+	root.End()
+}
+
+func TestTailSamplingProcessorRotate(t *testing.T) {
+	tracer, e, _ := newTailTestProvider(2)
+	yes := true
+
+	var roots []trace.Span
+	for i := 0; i < 4; i++ {
+		ctx, root := startTailSpan(context.Background(), tracer, "root")
+		roots = append(roots, root)
+		_, child := startTailSpan(ctx, tracer, "child")
+		endTailSpan(child, &yes)
+	}
+	// 缓存的 trace 数达到上限两次后, 最早的两个 trace 被提前决定
+	require.Len(t, e.GetSpans(), 2)
+	// 已决定的 trace 直接导出根span, 之后的 trace 在根span结束时决定
+	for _, root := range roots {
+		root.End()
+	}
+	require.Len(t, e.GetSpans(), 8)
+}
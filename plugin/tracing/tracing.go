@@ -0,0 +1,184 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/filter"
+	"github.com/zly-app/zapp/log"
+)
+
+var memoryExporter atomic.Pointer[tracetest.InMemoryExporter]
+
+// 获取导出器为 memory 时的内存导出器, 未使用时返回nil
+func MemoryExporter() *tracetest.InMemoryExporter {
+	return memoryExporter.Load()
+}
+
+// 链路追踪插件
+type Tracing struct {
+	conf *Config
+	tp   *sdktrace.TracerProvider
+}
+
+/*
+创建链路追踪, 会设置 otel 的全局 TracerProvider 和 TextMapPropagator
+
+	资源属性从框架配置中获取, 包括 service.name, service.instance.id, deployment.environment 和标签
+*/
+func NewTracing(frame core.FrameConfig, conf *Config) (*Tracing, error) {
+	if err := conf.check(); err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(makeSampler(conf)),
+		sdktrace.WithResource(makeResource(frame, conf)),
+	}
+	exporter, err := makeExporter(conf)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		var sp sdktrace.SpanProcessor
+		if conf.Exporter == ExporterMemory { // 同步导出, 使 span 结束后立即可见
+			sp = sdktrace.NewSimpleSpanProcessor(exporter)
+		} else {
+			sp = sdktrace.NewBatchSpanProcessor(exporter,
+				sdktrace.WithBatchTimeout(time.Duration(conf.BatchTimeout)*time.Millisecond),
+				sdktrace.WithMaxQueueSize(conf.MaxQueueSize),
+				sdktrace.WithMaxExportBatchSize(conf.MaxExportBatchSize),
+			)
+		}
+		if conf.TailSampling {
+			sp = newTailSamplingProcessor(sp, conf.TailMaxTraces)
+			filter.RegisterTraceTailProcessor()
+		}
+		opts = append(opts, sdktrace.WithSpanProcessor(sp))
+	}
+
+	t := &Tracing{conf: conf, tp: sdktrace.NewTracerProvider(opts...)}
+	otel.SetTracerProvider(t.tp)
+	otel.SetTextMapPropagator(makePropagator(conf))
+	return t, nil
+}
+
+func makeResource(frame core.FrameConfig, conf *Config) *resource.Resource {
+	attrs := make([]attribute.KeyValue, 0, len(frame.Labels)+len(conf.ResourceAttributes)+3)
+	for k, v := range frame.Labels {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	attrs = append(attrs, semconv.ServiceName(frame.Name))
+	if frame.Instance != "" {
+		attrs = append(attrs, semconv.ServiceInstanceID(frame.Instance))
+	}
+	if frame.Env != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(frame.Env))
+	}
+	for k, v := range conf.ResourceAttributes {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	// 同名属性以最后的为准
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...)
+}
+
+func makeExporter(conf *Config) (sdktrace.SpanExporter, error) {
+	timeout := time.Duration(conf.Timeout) * time.Millisecond
+	switch conf.Exporter {
+	case ExporterOtlpHttp:
+		opts := []otlptracehttp.Option{otlptracehttp.WithTimeout(timeout)}
+		if conf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.UrlPath != "" {
+			opts = append(opts, otlptracehttp.WithURLPath(conf.UrlPath))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+		}
+		if conf.Compression == "gzip" {
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	case ExporterOtlpGrpc:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithTimeout(timeout)}
+		if conf.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(conf.Headers))
+		}
+		if conf.Compression != "" {
+			opts = append(opts, otlptracegrpc.WithCompressor(conf.Compression))
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	case ExporterStdout:
+		opts := []stdouttrace.Option{stdouttrace.WithWriter(os.Stdout)}
+		if conf.StdoutPretty {
+			opts = append(opts, stdouttrace.WithPrettyPrint())
+		}
+		return stdouttrace.New(opts...)
+	case ExporterMemory:
+		e := tracetest.NewInMemoryExporter()
+		memoryExporter.Store(e)
+		return e, nil
+	}
+	return nil, nil
+}
+
+func makePropagator(conf *Config) propagation.TextMapPropagator {
+	propagators := make([]propagation.TextMapPropagator, 0, len(conf.Propagators))
+	for _, p := range conf.Propagators {
+		switch p {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...)
+}
+
+// 获取 TracerProvider
+func (t *Tracing) TracerProvider() *sdktrace.TracerProvider { return t.tp }
+
+func (t *Tracing) Inject(a ...interface{}) {}
+
+func (t *Tracing) Start() error { return nil }
+
+// 关闭时会导出剩余的span
+func (t *Tracing) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(t.conf.ShutdownTimeout)*time.Millisecond)
+	defer cancel()
+	if err := t.tp.Shutdown(ctx); err != nil {
+		log.Log.Error("关闭链路追踪失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
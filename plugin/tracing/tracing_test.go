@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zly-app/zapp/core"
+)
+
+func TestRateLimitedSampler(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewRateLimitedSampler(2).(*rateLimitedSampler)
+	s.now = func() time.Time { return now }
+
+	sample := func() bool {
+		return s.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background()}).Decision == sdktrace.RecordAndSample
+	}
+	require.True(t, sample())
+	require.True(t, sample())
+	require.False(t, sample())
+
+	now = now.Add(500 * time.Millisecond)
+	require.True(t, sample())
+	require.False(t, sample())
+
+	// 令牌不会超过桶容量
+	now = now.Add(10 * time.Second)
+	require.True(t, sample())
+	require.True(t, sample())
+	require.False(t, sample())
+}
+
+func TestCheckConfig(t *testing.T) {
+	conf := newConfig()
+	require.NoError(t, conf.check())
+	require.Equal(t, SamplerAlwaysOn, conf.Sampler)
+	require.Equal(t, defPropagators, conf.Propagators)
+
+	require.Error(t, (&Config{Sampler: SamplerRatio, SampleRatio: 2}).check())
+	require.Error(t, (&Config{Sampler: SamplerRateLimited}).check())
+	require.Error(t, (&Config{Exporter: "zipkin"}).check())
+	require.Error(t, (&Config{Propagators: []string{"jaeger"}}).check())
+}
+
+func TestMemoryExporter(t *testing.T) {
+	oldTP, oldProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldTP)
+		otel.SetTextMapPropagator(oldProp)
+	})
+
+	frame := core.FrameConfig{Name: "order", Instance: "host1", Env: "dev", Labels: map[string]string{"zone": "a"}}
+	tr, err := NewTracing(frame, &Config{
+		Exporter:           ExporterMemory,
+		Propagators:        []string{PropagatorB3},
+		ResourceAttributes: map[string]string{"zone": "b"},
+	})
+	require.NoError(t, err)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "op")
+	header := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	require.NotEmpty(t, header.Get("b3"))
+	span.End()
+
+	spans := MemoryExporter().GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "op", spans[0].Name)
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range spans[0].Resource.Attributes() {
+		attrs[kv.Key] = kv.Value.AsString()
+	}
+	require.Equal(t, "order", attrs["service.name"])
+	require.Equal(t, "host1", attrs["service.instance.id"])
+	require.Equal(t, "dev", attrs["deployment.environment"])
+	require.Equal(t, "b", attrs["zone"])
+
+	require.NoError(t, tr.Close())
+}
+
+func TestParentBased(t *testing.T) {
+	parent := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+	params := sdktrace.SamplingParameters{ParentContext: parent, TraceID: trace.TraceID{1}}
+
+	s := makeSampler(&Config{Sampler: SamplerAlwaysOff})
+	require.Equal(t, sdktrace.RecordAndSample, s.ShouldSample(params).Decision)
+	s = makeSampler(&Config{Sampler: SamplerAlwaysOff, DisableParentBased: true})
+	require.Equal(t, sdktrace.Drop, s.ShouldSample(params).Decision)
+}
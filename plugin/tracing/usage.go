@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zly-app/zapp"
+	"github.com/zly-app/zapp/core"
+	"github.com/zly-app/zapp/plugin"
+)
+
+// 默认插件类型, 配置位于 plugins.trace
+const DefaultPluginType core.PluginType = "trace"
+
+func init() {
+	plugin.RegisterCreatorFunc(DefaultPluginType, func(app core.IApp) core.IPlugin {
+		conf := newConfig()
+		err := app.GetConfig().ParsePluginConfig(DefaultPluginType, conf, true)
+		if err != nil {
+			app.Fatal("解析trace插件配置失败", zap.Error(err))
+		}
+		t, err := NewTracing(app.GetConfig().Config().Frame, conf)
+		if err != nil {
+			app.Fatal("创建链路追踪失败", zap.Error(err))
+		}
+		return t
+	})
+}
+
+// 启用链路追踪插件, 会设置 otel 的全局 TracerProvider 和 TextMapPropagator, app退出时会导出剩余的span
+func WithPlugin() zapp.Option {
+	return zapp.WithPlugin(DefaultPluginType)
+}